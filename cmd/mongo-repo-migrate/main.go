@@ -0,0 +1,31 @@
+// Command mongo-repo-migrate applies the migrations registered with the migrate package.
+//
+// Migrations are compiled in, so this command only runs the ones registered by the packages it imports. Copy it
+// into your project and blank import your migrations package:
+//
+//	import _ "example.com/app/migrations"
+//
+// usage:
+//
+//	mongo-repo-migrate -uri mongodb://localhost:27017 -database app up|down|redo|status
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/AISystemsInc/mongo-resource-repo/pkg/migrate"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := migrate.Run(ctx, os.Args, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		stop()
+		os.Exit(1)
+	}
+}
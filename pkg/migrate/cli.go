@@ -0,0 +1,150 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const usage = `usage: %s [flags] up|down|redo|status
+
+commands:
+  up      apply all pending migrations
+  down    revert the last applied migration
+  redo    revert the last applied migration and apply it again
+  status  list migrations and whether they are applied
+
+flags:
+`
+
+// Run runs the migrate command line with the registered migrations, for use in a main package that imports the
+// packages registering them:
+//
+//	import _ "example.com/app/migrations"
+//
+//	func main() {
+//		if err := migrate.Run(context.Background(), os.Args, os.Stdout); err != nil {
+//			fmt.Fprintln(os.Stderr, err)
+//			os.Exit(1)
+//		}
+//	}
+//
+// args includes the program name, like os.Args.
+func Run(ctx context.Context, args []string, out io.Writer) error {
+	var name = "migrate"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+
+	var uri = os.Getenv("MONGODB_URI")
+	if uri == "" {
+		uri = "mongodb://localhost:27017"
+	}
+
+	var flags = flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.Usage = func() {
+		fmt.Fprintf(out, usage, name)
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&uri, "uri", uri, "MongoDB connection string, defaults to $MONGODB_URI")
+	var database = flags.String("database", "", "database to record applied migrations in (required)")
+	var collection = flags.String("collection", "_migrations", "collection to record applied migrations in")
+	var lease = flags.Duration("lease", time.Minute, "how long the lock is held without being renewed")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 || *database == "" {
+		flags.Usage()
+		return errors.New("a command and -database are required")
+	}
+
+	if err := checkLease(*lease); err != nil {
+		return err
+	}
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer client.Disconnect(context.WithoutCancel(ctx))
+
+	var migrator = New(client, *database, WithCollection(*collection), WithLease(*lease))
+
+	switch command := flags.Arg(0); command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, version := range applied {
+			fmt.Fprintf(out, "applied %d\n", version)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(out, "no pending migrations")
+		}
+		return err
+
+	case "down":
+		reverted, err := migrator.Down(ctx)
+		if err == nil {
+			if reverted == 0 {
+				fmt.Fprintln(out, "no applied migrations")
+			} else {
+				fmt.Fprintf(out, "reverted %d\n", reverted)
+			}
+		}
+		return err
+
+	case "redo":
+		redone, err := migrator.Redo(ctx)
+		if err == nil {
+			if redone == 0 {
+				fmt.Fprintln(out, "no applied migrations")
+			} else {
+				fmt.Fprintf(out, "redone %d\n", redone)
+			}
+		}
+		return err
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		return printStatus(out, statuses)
+
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func printStatus(out io.Writer, statuses []Status) error {
+	var w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tAPPLIED AT\tDESCRIPTION\tNOTE")
+
+	for _, s := range statuses {
+		var appliedAt, note = "pending", ""
+		if s.Applied {
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+		switch {
+		case s.Missing:
+			note = "not registered"
+		case s.ChecksumMismatch:
+			note = "checksum mismatch"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, appliedAt, s.Description, note)
+	}
+
+	return w.Flush()
+}
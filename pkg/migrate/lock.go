@@ -0,0 +1,155 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// the lock is a single document in the lock collection, held by an owner until it expires:
+//
+//	{_id: "lock", owner: "host-1234", expiresAt: ISODate(...)}
+//
+// A migrator takes it over when it has expired, and renews it every third of the lease while it runs migrations,
+// so that a migrator that dies only blocks others until its lease expires.
+
+const lockID = "lock"
+
+// minLease is the shortest lease, so that renewals every third of it stay meaningful.
+const minLease = time.Second
+
+// checkLease returns an error for leases shorter than minLease.
+func checkLease(lease time.Duration) error {
+	if lease < minLease {
+		return fmt.Errorf("%w: lease must be at least %s, got %s", ErrMigrate, minLease, lease)
+	}
+	return nil
+}
+
+func defaultOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// withLock runs fn while holding the lock. The context passed to fn is cancelled with ErrLocked when the lease
+// cannot be renewed, since another migrator may have taken over.
+func (m *Migrator) withLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	err := checkLease(m.settings.lease)
+	if err != nil {
+		return err
+	}
+
+	err = m.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	lockCtx, cancel := context.WithCancelCause(ctx)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.renew(lockCtx, cancel)
+	}()
+
+	err = fn(lockCtx)
+	if cause := context.Cause(lockCtx); err != nil && cause != nil && ctx.Err() == nil {
+		err = fmt.Errorf("%w: %w", err, cause)
+	}
+
+	cancel(nil)
+	wg.Wait()
+
+	if releaseErr := m.release(context.WithoutCancel(ctx)); releaseErr != nil && err == nil {
+		err = releaseErr
+	}
+
+	return err
+}
+
+func (m *Migrator) acquire(ctx context.Context) error {
+	var now = time.Now().UTC()
+
+	_, err := m.lock.UpdateOne(
+		ctx,
+		bson.D{
+			{Key: "_id", Value: lockID},
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "expiresAt", Value: bson.D{{Key: "$lte", Value: now}}}},
+				bson.D{{Key: "owner", Value: m.settings.owner}},
+			}},
+		},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "owner", Value: m.settings.owner},
+			{Key: "expiresAt", Value: now.Add(m.settings.lease)},
+		}}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		// the lock document exists, is not expired and is held by someone else, so the upsert tried to insert it
+		var holder struct {
+			Owner     string    `bson:"owner"`
+			ExpiresAt time.Time `bson:"expiresAt"`
+		}
+		if m.lock.FindOne(ctx, bson.D{{Key: "_id", Value: lockID}}).Decode(&holder) == nil {
+			return fmt.Errorf("%w: held by %s until %s", ErrLocked, holder.Owner, holder.ExpiresAt.Format(time.RFC3339))
+		}
+		return ErrLocked
+	}
+	if err != nil {
+		return fmt.Errorf("%w: failed to acquire lock: %w", ErrMigrate, err)
+	}
+
+	return nil
+}
+
+// renew extends the lease until ctx is done, and cancels it when the lease was lost.
+func (m *Migrator) renew(ctx context.Context, cancel context.CancelCauseFunc) {
+	var ticker = time.NewTicker(m.settings.lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		result, err := m.lock.UpdateOne(
+			ctx,
+			bson.D{{Key: "_id", Value: lockID}, {Key: "owner", Value: m.settings.owner}},
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "expiresAt", Value: time.Now().UTC().Add(m.settings.lease)},
+			}}},
+		)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// a failed renewal is retried on the next tick, the lease covers two more attempts
+			continue
+		}
+		if result.MatchedCount == 0 {
+			cancel(fmt.Errorf("%w: lease lost", ErrLocked))
+			return
+		}
+	}
+}
+
+func (m *Migrator) release(ctx context.Context) error {
+	_, err := m.lock.DeleteOne(ctx, bson.D{{Key: "_id", Value: lockID}, {Key: "owner", Value: m.settings.owner}})
+	if err != nil {
+		return fmt.Errorf("%w: failed to release lock: %w", ErrMigrate, err)
+	}
+	return nil
+}
@@ -0,0 +1,392 @@
+// Package migrate applies versioned data migrations to MongoDB, once per environment.
+//
+// Migrations are Go functions registered with Register, usually from the init functions of a dedicated package.
+// A Migrator applies the ones that are not applied yet, in version order, and records each applied version in
+// a _migrations collection. A lease based lock makes sure that only one migrator runs at a time, so migrations can
+// safely be applied by every instance of a service on startup.
+//
+// example:
+//
+//	func init() {
+//		migrate.Register(migrate.Migration{
+//			Version:     20240102,
+//			Description: "backfill user status",
+//			Up: func(ctx context.Context, client *mongo.Client) error {
+//				_, err := client.Database("users_db").Collection("users_col").UpdateMany(ctx,
+//					bson.M{"status": bson.M{"$exists": false}},
+//					bson.M{"$set": bson.M{"status": "active"}},
+//				)
+//				return err
+//			},
+//		})
+//	}
+//
+//	applied, err := migrate.New(client, "app").Up(ctx)
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrMigrate        = fmt.Errorf("migrate error")
+	ErrLocked         = fmt.Errorf("migrations are locked by another migrator")
+	ErrIrreversible   = fmt.Errorf("migration has no down function")
+	ErrUnknownVersion = fmt.Errorf("applied migration is not registered")
+)
+
+// Migration is a versioned change to the data. Up must be idempotent: it is run again when it fails before its
+// version is recorded. Down reverts Up, and may be nil for migrations that cannot be reverted.
+type Migration struct {
+	Version     int64
+	Description string
+	Up          func(ctx context.Context, client *mongo.Client) error
+	Down        func(ctx context.Context, client *mongo.Client) error
+}
+
+// Checksum identifies the migration, and is recorded with its version. Since the code of a migration cannot
+// be hashed, it covers the version and description, which catches two migrations registered under the same
+// version in different environments.
+func (m Migration) Checksum() string {
+	var sum = sha256.Sum256([]byte(fmt.Sprintf("%d:%s", m.Version, m.Description)))
+	return hex.EncodeToString(sum[:])
+}
+
+var registry = struct {
+	sync.Mutex
+	migrations map[int64]Migration
+}{migrations: make(map[int64]Migration)}
+
+// Register registers a migration, to be applied by migrators created without WithMigrations.
+// It panics when the migration has no Up function or its version is already registered.
+func Register(migration Migration) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if migration.Up == nil {
+		panic(fmt.Sprintf("migrate: migration %d has no up function", migration.Version))
+	}
+
+	if _, ok := registry.migrations[migration.Version]; ok {
+		panic(fmt.Sprintf("migrate: migration %d is already registered", migration.Version))
+	}
+
+	registry.migrations[migration.Version] = migration
+}
+
+// Registered returns the registered migrations, in version order.
+func Registered() []Migration {
+	registry.Lock()
+	defer registry.Unlock()
+
+	var migrations = make([]Migration, 0, len(registry.migrations))
+	for _, m := range registry.migrations {
+		migrations = append(migrations, m)
+	}
+
+	return sorted(migrations)
+}
+
+func sorted(migrations []Migration) []Migration {
+	migrations = append([]Migration(nil), migrations...)
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations
+}
+
+// Option configures a Migrator.
+type Option func(*settings)
+
+type settings struct {
+	migrations     []Migration
+	collectionName string
+	lease          time.Duration
+	owner          string
+}
+
+// WithMigrations sets the migrations to apply instead of the registered ones.
+func WithMigrations(migrations ...Migration) Option {
+	return func(s *settings) {
+		s.migrations = migrations
+	}
+}
+
+// WithCollection sets the collection applied versions are recorded in. Defaults to "_migrations";
+// the lock is kept in the same collection name suffixed with "_lock".
+func WithCollection(name string) Option {
+	return func(s *settings) {
+		s.collectionName = name
+	}
+}
+
+// WithLease sets how long the lock is held without being renewed. The lock is renewed while migrations run,
+// and released when they are done, so the lease only matters when a migrator dies. Defaults to one minute;
+// Up, Down and Redo fail with ErrMigrate when the lease is shorter than a second.
+func WithLease(lease time.Duration) Option {
+	return func(s *settings) {
+		s.lease = lease
+	}
+}
+
+// WithOwner sets the name the lock is held under. Defaults to the host name and process ID.
+func WithOwner(owner string) Option {
+	return func(s *settings) {
+		s.owner = owner
+	}
+}
+
+// Migrator applies and reverts migrations.
+type Migrator struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+	lock       *mongo.Collection
+	settings   settings
+}
+
+// New creates a migrator that records applied versions in the given database.
+func New(client *mongo.Client, database string, opts ...Option) *Migrator {
+	var s = settings{
+		collectionName: "_migrations",
+		lease:          time.Minute,
+		owner:          defaultOwner(),
+	}
+
+	for _, opt := range opts {
+		opt(&s)
+	}
+
+	if s.migrations == nil {
+		s.migrations = Registered()
+	} else {
+		s.migrations = sorted(s.migrations)
+	}
+
+	return &Migrator{
+		client:     client,
+		collection: client.Database(database).Collection(s.collectionName),
+		lock:       client.Database(database).Collection(s.collectionName + "_lock"),
+		settings:   s,
+	}
+}
+
+// Status is the state of a migration.
+type Status struct {
+	Version          int64
+	Description      string
+	Applied          bool
+	AppliedAt        time.Time
+	ChecksumMismatch bool // The migration was applied with a different checksum than the registered one.
+	Missing          bool // The migration was applied but is not registered.
+}
+
+// record is the document recording an applied migration.
+type record struct {
+	Version     int64     `bson:"_id"`
+	Description string    `bson:"description"`
+	Checksum    string    `bson:"checksum"`
+	AppliedAt   time.Time `bson:"appliedAt"`
+}
+
+// Up applies the migrations that are not applied yet, in version order, and returns the versions it applied.
+// It stops at the first migration that fails.
+func (m *Migrator) Up(ctx context.Context) ([]int64, error) {
+	var applied []int64
+
+	err := m.withLock(ctx, func(ctx context.Context) error {
+		records, err := m.records(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range pending(m.settings.migrations, records) {
+			err := m.up(ctx, migration)
+			if err != nil {
+				return err
+			}
+
+			applied = append(applied, migration.Version)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts the last applied migration, and returns its version, or 0 when no migration is applied.
+func (m *Migrator) Down(ctx context.Context) (int64, error) {
+	var reverted int64
+
+	err := m.withLock(ctx, func(ctx context.Context) error {
+		var err error
+		reverted, err = m.down(ctx)
+		return err
+	})
+
+	return reverted, err
+}
+
+// Redo reverts the last applied migration and applies it again, and returns its version.
+func (m *Migrator) Redo(ctx context.Context) (int64, error) {
+	var redone int64
+
+	err := m.withLock(ctx, func(ctx context.Context) error {
+		var err error
+		redone, err = m.down(ctx)
+		if err != nil || redone == 0 {
+			return err
+		}
+
+		migration, _ := m.migration(redone)
+		return m.up(ctx, migration)
+	})
+
+	return redone, err
+}
+
+// up applies a migration and records it.
+func (m *Migrator) up(ctx context.Context, migration Migration) error {
+	err := migration.Up(ctx, m.client)
+	if err != nil {
+		return fmt.Errorf("%w: migration %d (%s) failed: %w", ErrMigrate, migration.Version, migration.Description, err)
+	}
+
+	_, err = m.collection.InsertOne(ctx, record{
+		Version:     migration.Version,
+		Description: migration.Description,
+		Checksum:    migration.Checksum(),
+		AppliedAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: failed to record migration %d: %w", ErrMigrate, migration.Version, err)
+	}
+
+	return nil
+}
+
+// down reverts the last applied migration and unrecords it.
+func (m *Migrator) down(ctx context.Context) (int64, error) {
+	records, err := m.records(ctx)
+	if err != nil || len(records) == 0 {
+		return 0, err
+	}
+
+	var last = records[len(records)-1]
+
+	migration, ok := m.migration(last.Version)
+	if !ok {
+		return 0, fmt.Errorf("%w: %w: %d (%s)", ErrMigrate, ErrUnknownVersion, last.Version, last.Description)
+	}
+
+	if migration.Down == nil {
+		return 0, fmt.Errorf("%w: %w: %d (%s)", ErrMigrate, ErrIrreversible, migration.Version, migration.Description)
+	}
+
+	err = migration.Down(ctx, m.client)
+	if err != nil {
+		return 0, fmt.Errorf("%w: reverting migration %d (%s) failed: %w", ErrMigrate, migration.Version, migration.Description, err)
+	}
+
+	_, err = m.collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: migration.Version}})
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to unrecord migration %d: %w", ErrMigrate, migration.Version, err)
+	}
+
+	return migration.Version, nil
+}
+
+// Status returns the state of every registered or applied migration, in version order.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	records, err := m.records(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return status(m.settings.migrations, records), nil
+}
+
+func (m *Migrator) migration(version int64) (Migration, bool) {
+	for _, migration := range m.settings.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+// records returns the applied migrations, in version order.
+func (m *Migrator) records(ctx context.Context) ([]record, error) {
+	cursor, err := m.collection.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to list applied migrations: %w", ErrMigrate, err)
+	}
+
+	var records []record
+	err = cursor.All(ctx, &records)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode applied migrations: %w", ErrMigrate, err)
+	}
+
+	return records, nil
+}
+
+// pending returns the migrations that are not applied, in version order.
+func pending(migrations []Migration, records []record) []Migration {
+	var applied = make(map[int64]bool, len(records))
+	for _, r := range records {
+		applied[r.Version] = true
+	}
+
+	var result []Migration
+	for _, migration := range migrations {
+		if !applied[migration.Version] {
+			result = append(result, migration)
+		}
+	}
+	return result
+}
+
+func status(migrations []Migration, records []record) []Status {
+	var applied = make(map[int64]record, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+
+	var result []Status
+	for _, migration := range migrations {
+		var s = Status{Version: migration.Version, Description: migration.Description}
+		if r, ok := applied[migration.Version]; ok {
+			s.Applied, s.AppliedAt = true, r.AppliedAt
+			s.ChecksumMismatch = r.Checksum != migration.Checksum()
+			delete(applied, migration.Version)
+		}
+		result = append(result, s)
+	}
+
+	for _, r := range applied {
+		result = append(result, Status{
+			Version:     r.Version,
+			Description: r.Description,
+			Applied:     true,
+			AppliedAt:   r.AppliedAt,
+			Missing:     true,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+
+	return result
+}
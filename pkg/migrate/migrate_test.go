@@ -0,0 +1,229 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func noop(context.Context, *mongo.Client) error { return nil }
+
+func TestPending(t *testing.T) {
+	var migrations = []Migration{{Version: 1, Up: noop}, {Version: 2, Up: noop}, {Version: 3, Up: noop}}
+
+	tests := []struct {
+		name    string
+		records []record
+		want    []int64
+	}{
+		{name: "none applied", want: []int64{1, 2, 3}},
+		{name: "some applied", records: []record{{Version: 1}}, want: []int64{2, 3}},
+		{name: "gap applied", records: []record{{Version: 1}, {Version: 3}}, want: []int64{2}},
+		{name: "all applied", records: []record{{Version: 1}, {Version: 2}, {Version: 3}}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int64
+			for _, m := range pending(migrations, tt.records) {
+				got = append(got, m.Version)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pending() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	var appliedAt = time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	var one = Migration{Version: 1, Description: "one", Up: noop}
+	var two = Migration{Version: 2, Description: "two", Up: noop}
+
+	got := status([]Migration{one, two}, []record{
+		{Version: 1, Description: "one", Checksum: "other", AppliedAt: appliedAt},
+		{Version: 3, Description: "three", Checksum: "x", AppliedAt: appliedAt},
+	})
+
+	want := []Status{
+		{Version: 1, Description: "one", Applied: true, AppliedAt: appliedAt, ChecksumMismatch: true},
+		{Version: 2, Description: "two"},
+		{Version: 3, Description: "three", Applied: true, AppliedAt: appliedAt, Missing: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("status() = %+v, want %+v", got, want)
+	}
+}
+
+func TestMigration_Checksum(t *testing.T) {
+	var a = Migration{Version: 1, Description: "a"}
+
+	if a.Checksum() != (Migration{Version: 1, Description: "a"}).Checksum() {
+		t.Errorf("Checksum() is not stable")
+	}
+	if a.Checksum() == (Migration{Version: 1, Description: "b"}).Checksum() {
+		t.Errorf("Checksum() does not cover the description")
+	}
+	if a.Checksum() == (Migration{Version: 2, Description: "a"}).Checksum() {
+		t.Errorf("Checksum() does not cover the version")
+	}
+}
+
+func TestLease(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+	defer mongoClient.Disconnect(context.Background())
+
+	tests := []struct {
+		name    string
+		lease   time.Duration
+		wantErr bool
+	}{
+		{name: "negative", lease: -time.Second, wantErr: true},
+		{name: "zero", lease: 0, wantErr: true},
+		{name: "nanoseconds", lease: 2 * time.Nanosecond, wantErr: true},
+		{name: "minimum", lease: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkLease(tt.lease); (err != nil) != tt.wantErr {
+				t.Errorf("checkLease() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr {
+				return
+			}
+
+			// invalid leases fail before the lock is acquired, without panicking.
+			var migrator = New(mongoClient, "migrate_db", WithMigrations(), WithLease(tt.lease))
+			if _, err := migrator.Up(context.Background()); !errors.Is(err, ErrMigrate) {
+				t.Errorf("Up() error = %v, want %v", err, ErrMigrate)
+			}
+
+			var out bytes.Buffer
+			err := Run(context.Background(), []string{"migrate", "-database", "migrate_db", "-lease", tt.lease.String(), "up"}, &out)
+			if !errors.Is(err, ErrMigrate) {
+				t.Errorf("Run() error = %v, want %v", err, ErrMigrate)
+			}
+		})
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		err := mongoClient.Database("migrate_db").Drop(context.Background())
+		if err != nil {
+			t.Errorf("error dropping database: %v", err)
+		}
+	}()
+
+	var data = mongoClient.Database("migrate_db").Collection("data")
+	var step = func(version int64) Migration {
+		return Migration{
+			Version:     version,
+			Description: "step",
+			Up: func(ctx context.Context, client *mongo.Client) error {
+				_, err := data.InsertOne(ctx, bson.M{"_id": version})
+				return err
+			},
+			Down: func(ctx context.Context, client *mongo.Client) error {
+				_, err := data.DeleteOne(ctx, bson.M{"_id": version})
+				return err
+			},
+		}
+	}
+
+	var migrator = New(mongoClient, "migrate_db", WithMigrations(step(2), step(1)), WithOwner("a"))
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Errorf("Up() error = %v", err)
+		return
+	}
+	if !reflect.DeepEqual(applied, []int64{1, 2}) {
+		t.Errorf("Up() = %v, want [1 2]", applied)
+	}
+
+	applied, err = migrator.Up(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("second Up() = %v, %v, want nothing applied", applied, err)
+	}
+
+	redone, err := migrator.Redo(ctx)
+	if err != nil || redone != 2 {
+		t.Errorf("Redo() = %v, %v, want 2", redone, err)
+	}
+
+	reverted, err := migrator.Down(ctx)
+	if err != nil || reverted != 2 {
+		t.Errorf("Down() = %v, %v, want 2", reverted, err)
+	}
+
+	count, _ := data.CountDocuments(ctx, bson.M{})
+	if count != 1 {
+		t.Errorf("data has %d documents after Down(), want 1", count)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Errorf("Status() error = %v", err)
+		return
+	}
+	if len(statuses) != 2 || !statuses[0].Applied || statuses[1].Applied {
+		t.Errorf("Status() = %+v, want 1 applied and 2 pending", statuses)
+	}
+
+	// a lock held by another migrator blocks until it expires
+	_, err = mongoClient.Database("migrate_db").Collection("_migrations_lock").InsertOne(ctx, bson.M{
+		"_id":       lockID,
+		"owner":     "b",
+		"expiresAt": time.Now().Add(time.Minute),
+	})
+	if err != nil {
+		t.Errorf("error inserting lock: %v", err)
+		return
+	}
+
+	_, err = migrator.Up(ctx)
+	if !errors.Is(err, ErrLocked) {
+		t.Errorf("Up() error = %v, want ErrLocked", err)
+	}
+
+	_, err = mongoClient.Database("migrate_db").Collection("_migrations_lock").UpdateByID(ctx, lockID, bson.M{
+		"$set": bson.M{"expiresAt": time.Now().Add(-time.Second)},
+	})
+	if err != nil {
+		t.Errorf("error expiring lock: %v", err)
+		return
+	}
+
+	applied, err = migrator.Up(ctx)
+	if err != nil || !reflect.DeepEqual(applied, []int64{2}) {
+		t.Errorf("Up() after expiry = %v, %v, want [2]", applied, err)
+	}
+}
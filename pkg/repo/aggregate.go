@@ -0,0 +1,114 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Aggregate runs an aggregation pipeline on the repository's collection and decodes the results into R.
+// Since Go methods cannot have type parameters, Aggregate is a function; the model and ID types are inferred
+// from the repository.
+//
+// example:
+//
+//	type UsersPerCountry struct {
+//		Country string `bson:"_id"`
+//		Count   int64  `bson:"count"`
+//	}
+//
+//	results, err := repo.Aggregate[UsersPerCountry](ctx, usersRepo, mongo.Pipeline{
+//		{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$country"}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+//	})
+func Aggregate[R any, M Model, I any](
+	ctx context.Context,
+	r *Repository[M, I],
+	pipeline any,
+	opts ...*options.AggregateOptions,
+) ([]R, error) {
+	ctx, span := r.startSpan(ctx, "Aggregate", nil)
+	values, err := aggregate[R](ctx, r, pipeline, opts...)
+	err = r.classify(ctx, "Aggregate", err)
+	span.end(err, returnedKey.Int(len(values)))
+	return values, err
+}
+
+func aggregate[R any, M Model, I any](
+	ctx context.Context,
+	r *Repository[M, I],
+	pipeline any,
+	opts ...*options.AggregateOptions,
+) ([]R, error) {
+	pipeline, err := r.scopedPipeline(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAggregate, err)
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAggregate, err)
+	}
+
+	cursor, err := collection.Aggregate(
+		ctx,
+		pipeline,
+		opts...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAggregate, err)
+	}
+
+	var values []R
+	err = cursor.All(ctx, &values)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode results: %w", ErrAggregate, &decodeError{err})
+	}
+
+	return values, nil
+}
+
+// AggregateStream works like Aggregate, but returns a Cursor that decodes the results one at a time.
+func AggregateStream[R any, M Model, I any](
+	ctx context.Context,
+	r *Repository[M, I],
+	pipeline any,
+	opts ...*options.AggregateOptions,
+) (*Cursor[R], error) {
+	ctx, span := r.startSpan(ctx, "AggregateStream", nil)
+	cursor, err := aggregateStream[R](ctx, r, pipeline, opts...)
+	err = r.classify(ctx, "AggregateStream", err)
+	if cursor != nil {
+		cursor.op, cursor.namespace = "AggregateStream", r.operationNamespace(ctx)
+	}
+	span.end(err)
+	return cursor, err
+}
+
+func aggregateStream[R any, M Model, I any](
+	ctx context.Context,
+	r *Repository[M, I],
+	pipeline any,
+	opts ...*options.AggregateOptions,
+) (*Cursor[R], error) {
+	pipeline, err := r.scopedPipeline(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAggregate, err)
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAggregate, err)
+	}
+
+	cursor, err := collection.Aggregate(
+		ctx,
+		pipeline,
+		opts...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAggregate, err)
+	}
+
+	return newCursor[R](cursor, ErrAggregate, false), nil
+}
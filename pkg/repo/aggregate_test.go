@@ -0,0 +1,113 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AggregateModel struct {
+	ID    primitive.ObjectID `bson:"_id"`
+	Group string             `bson:"group"`
+}
+
+func (a *AggregateModel) GetDatabaseName() string {
+	return "aggregate_model_db"
+}
+
+func (a *AggregateModel) GetCollectionName() string {
+	return "aggregate_model_col"
+}
+
+type AggregateResult struct {
+	Group string `bson:"_id"`
+	Count int64  `bson:"count"`
+}
+
+func TestAggregate(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var repository = NewRepository[*AggregateModel, primitive.ObjectID](mongoClient)
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		err := mongoClient.Database("aggregate_model_db").Collection("aggregate_model_col").Drop(context.Background())
+		if err != nil {
+			t.Errorf("error dropping collection: %v", err)
+		}
+	}()
+
+	_, err = repository.InsertMany(ctx, []*AggregateModel{
+		{ID: primitive.NewObjectID(), Group: "a"},
+		{ID: primitive.NewObjectID(), Group: "b"},
+		{ID: primitive.NewObjectID(), Group: "a"},
+	})
+	if err != nil {
+		t.Errorf("error inserting models: %v", err)
+		return
+	}
+
+	var pipeline = mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$group"}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+	}
+	var want = []AggregateResult{{Group: "a", Count: 2}, {Group: "b", Count: 1}}
+
+	t.Run("should decode results into the result type", func(t *testing.T) {
+		got, err := Aggregate[AggregateResult](ctx, repository, pipeline)
+		if err != nil {
+			t.Errorf("Aggregate() error = %v", err)
+			return
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Aggregate() got = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("should stream results", func(t *testing.T) {
+		cursor, err := AggregateStream[AggregateResult](ctx, repository, pipeline)
+		if err != nil {
+			t.Errorf("AggregateStream() error = %v", err)
+			return
+		}
+
+		var got []AggregateResult
+		for result, err := range cursor.All(ctx) {
+			if err != nil {
+				t.Errorf("AggregateStream() error = %v", err)
+				return
+			}
+			got = append(got, result)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("AggregateStream() got = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("should return an error for an invalid pipeline", func(t *testing.T) {
+		_, err := Aggregate[AggregateResult](ctx, repository, mongo.Pipeline{{{Key: "$notAStage", Value: 1}}})
+		if !errors.Is(err, ErrAggregate) {
+			t.Errorf("Aggregate() error = %v, wantErr %v", err, ErrAggregate)
+		}
+	})
+}
@@ -0,0 +1,787 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"time"
+
+	"github.com/AISystemsInc/mongo-resource-repo/pkg/repo/internal/meta"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditEntry records a write made through an Audited repository.
+type AuditEntry[M Model, I any] struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Time      time.Time          `bson:"time"`
+	Actor     string             `bson:"actor"`
+	Operation string             `bson:"operation"`        // The name of the method, e.g. "UpdateOne".
+	Filter    any                `bson:"filter,omitempty"` // The filter the write was called with, if any.
+	Update    any                `bson:"update,omitempty"` // The update the write was called with, if any.
+	IDs       []I                `bson:"ids"`              // The IDs of the affected documents.
+	Before    M                  `bson:"before,omitempty"` // The document before a single document write.
+	After     M                  `bson:"after,omitempty"`  // The document after a single document write.
+}
+
+// AuditOption configures an Audited repository.
+type AuditOption func(*auditSettings)
+
+type auditSettings struct {
+	collectionName     string
+	actor              func(ctx context.Context) string
+	transaction        bool
+	transactionOptions []*TransactionOptions
+}
+
+// WithAuditActor sets the function that extracts the actor of a write from its context.
+// Defaults to ActorFromContext.
+func WithAuditActor(actor func(ctx context.Context) string) AuditOption {
+	return func(s *auditSettings) {
+		s.actor = actor
+	}
+}
+
+// WithAuditCollection sets the collection audit entries are written to. Defaults to "<collection>_audit".
+// The audit collection is in the database of the audited collection, which depends on the tenant when
+// tenant routing is enabled.
+func WithAuditCollection(name string) AuditOption {
+	return func(s *auditSettings) {
+		s.collectionName = name
+	}
+}
+
+// WithAuditTransaction writes each audit entry in the same transaction as the write it records, so that neither
+// is applied without the other. Writes made with a context that already carries a transaction always join it.
+func WithAuditTransaction(opts ...*TransactionOptions) AuditOption {
+	return func(s *auditSettings) {
+		s.transaction = true
+		s.transactionOptions = opts
+	}
+}
+
+type actorKey struct{}
+
+// ContextWithActor returns a context carrying the actor of the writes made with it.
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by ContextWithActor, or an empty string.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// Audited decorates a Repository so that every write is recorded as an AuditEntry in a companion collection,
+// holding the actor, the operation, its filter and update, the IDs of the affected documents, and before and after
+// snapshots for single document writes. Reads are passed through to the Repository.
+//
+// Writes are narrowed to the documents that were snapshotted or whose IDs were collected beforehand, so the audit
+// entry always matches what was written. Unless WithAuditTransaction is set, a write that succeeds is not rolled back
+// when its audit entry cannot be written; the error then wraps ErrAudit.
+//
+// example:
+//
+//	usersRepo := repo.NewAudited(repo.NewRepository[*User, primitive.ObjectID](client), repo.WithAuditTransaction())
+//	_, err := usersRepo.UpdateByID(repo.ContextWithActor(ctx, "alice"), id, bson.M{"$set": bson.M{"name": "Bob"}})
+type Audited[M Model, I any] struct {
+	*Repository[M, I]
+	audit auditSettings
+}
+
+var _ Store[Model, any] = (*Audited[Model, any])(nil)
+
+// NewAudited creates an Audited repository around the given repository.
+func NewAudited[M Model, I any](repository *Repository[M, I], opts ...AuditOption) *Audited[M, I] {
+	var a = &Audited[M, I]{
+		Repository: repository,
+		audit: auditSettings{
+			actor: ActorFromContext,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(&a.audit)
+	}
+
+	return a
+}
+
+// FindAudit returns the audit entries that match the filter.
+func (a *Audited[M, I]) FindAudit(
+	ctx context.Context,
+	filter any,
+	opts ...*options.FindOptions,
+) ([]AuditEntry[M, I], error) {
+	collection, err := a.auditCollection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAudit, err)
+	}
+
+	cursor, err := collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAudit, err)
+	}
+
+	var entries []AuditEntry[M, I]
+	err = cursor.All(ctx, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode results: %w", ErrAudit, err)
+	}
+
+	return entries, nil
+}
+
+// InsertOne inserts a single document and records it.
+func (a *Audited[M, I]) InsertOne(
+	ctx context.Context,
+	document M,
+	opts ...*options.InsertOneOptions,
+) (I, error) {
+	var insertedID I
+
+	err := a.record(ctx, "InsertOne", func(ctx context.Context, entry *AuditEntry[M, I]) error {
+		var err error
+		insertedID, err = a.Repository.InsertOne(ctx, document, opts...)
+		if err != nil {
+			return err
+		}
+
+		entry.IDs = []I{insertedID}
+		entry.After, _, err = a.snapshot(ctx, bson.D{{Key: "_id", Value: insertedID}})
+		return err
+	})
+
+	return insertedID, err
+}
+
+// InsertMany inserts multiple documents and records their IDs, including those of the documents that were inserted
+// when others failed.
+func (a *Audited[M, I]) InsertMany(
+	ctx context.Context,
+	documents []M,
+	opts ...*options.InsertManyOptions,
+) ([]I, error) {
+	var insertedIDs []I
+	var insertErr error
+
+	err := a.record(ctx, "InsertMany", func(ctx context.Context, entry *AuditEntry[M, I]) error {
+		var err error
+		insertedIDs, err = a.Repository.InsertMany(ctx, documents, opts...)
+
+		entry.IDs = writtenIDs(insertedIDs, err)
+		if len(entry.IDs) == 0 {
+			return err
+		}
+
+		// the documents that were inserted are recorded, and the failures reported after.
+		insertErr = err
+		return nil
+	})
+	if err != nil {
+		return insertedIDs, err
+	}
+
+	return insertedIDs, insertErr
+}
+
+// InsertStream inserts documents read from a sequence and records the IDs of each batch in an entry of its own,
+// including the documents of batches that partially failed.
+func (a *Audited[M, I]) InsertStream(
+	ctx context.Context,
+	documents iter.Seq[M],
+	opts ...*InsertStreamOptions,
+) (InsertStreamStats, error) {
+	return a.streamInserts(ctx, documents, func(ctx context.Context, batch []M) error {
+		var insertErr error
+
+		err := a.record(ctx, "InsertStream", func(ctx context.Context, entry *AuditEntry[M, I]) error {
+			insertedIDs, err := a.Repository.InsertMany(ctx, batch, options.InsertMany().SetOrdered(false))
+
+			entry.IDs = writtenIDs(insertedIDs, err)
+			if len(entry.IDs) == 0 {
+				return err
+			}
+
+			// the documents that were inserted are recorded, and the failures reported after.
+			insertErr = err
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return insertErr
+	}, opts...)
+}
+
+// UpdateByID updates a single document by its ID and records it.
+func (a *Audited[M, I]) UpdateByID(
+	ctx context.Context,
+	id I,
+	update any,
+	opts ...*options.UpdateOptions,
+) (*UpdateResult[I], error) {
+	return a.updateOne(ctx, "UpdateByID", bson.D{{Key: "_id", Value: id}}, update, func(ctx context.Context, _ any) (*UpdateResult[I], error) {
+		return a.Repository.UpdateByID(ctx, id, update, opts...)
+	})
+}
+
+// UpdateOne updates a single document by its filter and records it.
+func (a *Audited[M, I]) UpdateOne(
+	ctx context.Context,
+	filter any,
+	update any,
+	opts ...*options.UpdateOptions,
+) (*UpdateResult[I], error) {
+	return a.updateOne(ctx, "UpdateOne", filter, update, func(ctx context.Context, filter any) (*UpdateResult[I], error) {
+		return a.Repository.UpdateOne(ctx, filter, update, opts...)
+	})
+}
+
+func (a *Audited[M, I]) updateOne(
+	ctx context.Context,
+	operation string,
+	filter any,
+	update any,
+	write func(ctx context.Context, filter any) (*UpdateResult[I], error),
+) (*UpdateResult[I], error) {
+	var result *UpdateResult[I]
+
+	err := a.record(ctx, operation, func(ctx context.Context, entry *AuditEntry[M, I]) error {
+		entry.Filter, entry.Update = filter, update
+
+		before, id, err := a.snapshot(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		var narrowed = filter
+		if id != nil {
+			entry.Before, entry.IDs = before, []I{*id}
+			narrowed = andFilters(filter, bson.D{{Key: "_id", Value: *id}})
+		}
+
+		result, err = write(ctx, narrowed)
+		if err != nil {
+			return err
+		}
+
+		if result.UpsertedCount > 0 {
+			id = result.UpsertedID
+			entry.IDs = []I{*id}
+		}
+
+		if id != nil {
+			entry.After, _, err = a.snapshot(ctx, bson.D{{Key: "_id", Value: *id}})
+		}
+		return err
+	})
+
+	return result, err
+}
+
+// UpdateMany updates multiple documents by their filter and records their IDs.
+func (a *Audited[M, I]) UpdateMany(
+	ctx context.Context,
+	filter any,
+	update any,
+	opts ...*options.UpdateOptions,
+) (*UpdateResult[I], error) {
+	var result *UpdateResult[I]
+
+	err := a.record(ctx, "UpdateMany", func(ctx context.Context, entry *AuditEntry[M, I]) error {
+		entry.Filter, entry.Update = filter, update
+
+		ids, err := a.ids(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		// an upsert matching nothing runs with the filter as given, so that it inserts the document it describes.
+		var narrowed = andFilters(filter, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+		if o := options.MergeUpdateOptions(opts...); len(ids) == 0 && o.Upsert != nil && *o.Upsert {
+			narrowed = filter
+		}
+
+		result, err = a.Repository.UpdateMany(ctx, narrowed, update, opts...)
+		if err != nil {
+			return err
+		}
+
+		entry.IDs = ids
+		if result.UpsertedCount > 0 {
+			entry.IDs = append(entry.IDs, *result.UpsertedID)
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// BulkWrite applies the writes and records the IDs of the documents they affect in a single entry, including those
+// of the writes that were applied when others failed.
+func (a *Audited[M, I]) BulkWrite(
+	ctx context.Context,
+	models []WriteModel[M, I],
+	opts ...*options.BulkWriteOptions,
+) (*BulkWriteResult[I], error) {
+	var result *BulkWriteResult[I]
+	var writeErr error
+
+	err := a.record(ctx, "BulkWrite", func(ctx context.Context, entry *AuditEntry[M, I]) error {
+		var narrowed = make([]WriteModel[M, I], len(models))
+		var affected = make([][]I, len(models))
+		for i, model := range models {
+			narrowed[i] = model
+
+			filter, many, ok := model.target()
+			if !ok {
+				continue
+			}
+
+			var ids = []I{}
+			if many {
+				var err error
+				ids, err = a.ids(ctx, filter)
+				if err != nil {
+					return err
+				}
+			} else {
+				_, id, err := a.snapshot(ctx, filter)
+				if err != nil {
+					return err
+				}
+				if id != nil {
+					ids = []I{*id}
+				}
+			}
+
+			affected[i] = ids
+			if len(ids) > 0 || model.deletes() {
+				narrowed[i] = model.withFilter(andFilters(model.filter, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}))
+			}
+		}
+
+		var err error
+		result, err = a.Repository.BulkWrite(ctx, narrowed, opts...)
+
+		var written = make([]bool, len(models))
+		var bulkErr *BulkError
+		switch {
+		case err == nil:
+			for i := range written {
+				written[i] = true
+			}
+		case errors.As(err, &bulkErr) && result != nil:
+			// the writes that were applied are recorded, and the failures reported after.
+			written, writeErr = bulkErr.written(len(models)), err
+		default:
+			return err
+		}
+
+		for i := range models {
+			if !written[i] {
+				continue
+			}
+			entry.IDs = append(entry.IDs, affected[i]...)
+			if id, ok := result.InsertedIDs[int64(i)]; ok {
+				entry.IDs = append(entry.IDs, id)
+			}
+			if id, ok := result.UpsertedIDs[int64(i)]; ok {
+				entry.IDs = append(entry.IDs, id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	return result, writeErr
+}
+
+// FindOneAndUpdate updates a single document by its filter, returns it and records it.
+func (a *Audited[M, I]) FindOneAndUpdate(
+	ctx context.Context,
+	filter any,
+	update any,
+	opts ...*options.FindOneAndUpdateOptions,
+) (M, error) {
+	var value M
+
+	o := options.MergeFindOneAndUpdateOptions(opts...)
+	err := a.record(ctx, "FindOneAndUpdate", func(ctx context.Context, entry *AuditEntry[M, I]) error {
+		entry.Filter, entry.Update = filter, update
+
+		var err error
+		value, err = a.Repository.FindOneAndUpdate(ctx, filter, update, opts...)
+		if err != nil {
+			return err
+		}
+
+		return a.recordReturned(ctx, entry, value, o.ReturnDocument)
+	})
+
+	return value, err
+}
+
+// FindOneAndReplace replaces a single document by its filter, returns it and records it.
+func (a *Audited[M, I]) FindOneAndReplace(
+	ctx context.Context,
+	filter any,
+	replacement M,
+	opts ...*options.FindOneAndReplaceOptions,
+) (M, error) {
+	var value M
+
+	o := options.MergeFindOneAndReplaceOptions(opts...)
+	err := a.record(ctx, "FindOneAndReplace", func(ctx context.Context, entry *AuditEntry[M, I]) error {
+		entry.Filter = filter
+
+		var err error
+		value, err = a.Repository.FindOneAndReplace(ctx, filter, replacement, opts...)
+		if err != nil {
+			return err
+		}
+
+		return a.recordReturned(ctx, entry, value, o.ReturnDocument)
+	})
+
+	return value, err
+}
+
+// FindOneAndDelete deletes a single document by its filter, returns it and records it.
+func (a *Audited[M, I]) FindOneAndDelete(
+	ctx context.Context,
+	filter any,
+	opts ...*options.FindOneAndDeleteOptions,
+) (M, error) {
+	var value M
+
+	err := a.record(ctx, "FindOneAndDelete", func(ctx context.Context, entry *AuditEntry[M, I]) error {
+		entry.Filter = filter
+
+		var err error
+		value, err = a.Repository.FindOneAndDelete(ctx, filter, opts...)
+		if err != nil {
+			return err
+		}
+
+		id, ok := modelID[I](value)
+		if !ok {
+			return fmt.Errorf("%w: the returned document has no _id", ErrAudit)
+		}
+
+		entry.Before, entry.IDs = value, []I{id}
+		return nil
+	})
+
+	return value, err
+}
+
+// recordReturned records the document returned by a FindOneAnd update or replace, as it was before the write unless
+// returnDocument is options.After, and snapshots it after the write.
+func (a *Audited[M, I]) recordReturned(
+	ctx context.Context,
+	entry *AuditEntry[M, I],
+	value M,
+	returnDocument *options.ReturnDocument,
+) error {
+	id, ok := modelID[I](value)
+	if !ok {
+		return fmt.Errorf("%w: the returned document has no _id", ErrAudit)
+	}
+
+	entry.IDs = []I{id}
+	if returnDocument == nil || *returnDocument == options.Before {
+		entry.Before = value
+	}
+
+	var err error
+	entry.After, _, err = a.snapshot(ctx, bson.D{{Key: "_id", Value: id}})
+	return err
+}
+
+// DeleteOne deletes a single document by its filter and records it.
+func (a *Audited[M, I]) DeleteOne(
+	ctx context.Context,
+	filter any,
+	opts ...*options.DeleteOptions,
+) (*mongo.DeleteResult, error) {
+	var result *mongo.DeleteResult
+
+	err := a.record(ctx, "DeleteOne", func(ctx context.Context, entry *AuditEntry[M, I]) error {
+		entry.Filter = filter
+
+		before, id, err := a.snapshot(ctx, a.visible(filter))
+		if err != nil {
+			return err
+		}
+
+		var narrowed = filter
+		if id != nil {
+			entry.Before, entry.IDs = before, []I{*id}
+			narrowed = andFilters(filter, bson.D{{Key: "_id", Value: *id}})
+		}
+
+		result, err = a.Repository.DeleteOne(ctx, narrowed, opts...)
+		return err
+	})
+
+	return result, err
+}
+
+// DeleteMany deletes multiple documents by their filter and records their IDs.
+func (a *Audited[M, I]) DeleteMany(
+	ctx context.Context,
+	filter any,
+	opts ...*options.DeleteOptions,
+) (*mongo.DeleteResult, error) {
+	var result *mongo.DeleteResult
+
+	err := a.record(ctx, "DeleteMany", func(ctx context.Context, entry *AuditEntry[M, I]) error {
+		entry.Filter = filter
+
+		ids, err := a.ids(ctx, a.visible(filter))
+		if err != nil {
+			return err
+		}
+
+		entry.IDs = ids
+		result, err = a.Repository.DeleteMany(
+			ctx,
+			andFilters(filter, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}),
+			opts...,
+		)
+		return err
+	})
+
+	return result, err
+}
+
+// Restore restores the soft deleted documents that match the filter and records their IDs.
+func (a *Audited[M, I]) Restore(
+	ctx context.Context,
+	filter any,
+	opts ...*options.UpdateOptions,
+) (int64, error) {
+	var restored int64
+
+	err := a.record(ctx, "Restore", func(ctx context.Context, entry *AuditEntry[M, I]) error {
+		entry.Filter = filter
+
+		var m = meta.For[M]()
+		if !m.SoftDelete() {
+			return fmt.Errorf("%w: %w", ErrRestore, ErrNoSoftDelete)
+		}
+
+		ids, err := a.ids(ctx, andFilters(filter, bson.D{{Key: m.DeletedAt.Name, Value: bson.D{{Key: "$exists", Value: true}}}}))
+		if err != nil {
+			return err
+		}
+
+		entry.IDs = ids
+		restored, err = a.Repository.Restore(
+			ctx,
+			andFilters(filter, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}),
+			opts...,
+		)
+		return err
+	})
+
+	return restored, err
+}
+
+// PurgeDeleted permanently deletes the documents soft deleted more than olderThan ago and records their IDs.
+func (a *Audited[M, I]) PurgeDeleted(
+	ctx context.Context,
+	olderThan time.Duration,
+	opts ...*options.DeleteOptions,
+) (int64, error) {
+	var purged int64
+
+	err := a.record(ctx, "PurgeDeleted", func(ctx context.Context, entry *AuditEntry[M, I]) error {
+		var err error
+		purged, err = a.Repository.purgeNarrowed(ctx, olderThan, func(ctx context.Context, filter any) (any, error) {
+			entry.Filter = filter
+
+			ids, err := a.ids(ctx, filter)
+			if err != nil {
+				return nil, err
+			}
+
+			entry.IDs = ids
+			return andFilters(filter, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}), nil
+		}, opts...)
+		return err
+	})
+
+	return purged, err
+}
+
+// SaveVersioned saves a versioned model and records it.
+func (a *Audited[M, I]) SaveVersioned(
+	ctx context.Context,
+	document M,
+	opts ...*options.UpdateOptions,
+) error {
+	return a.record(ctx, "SaveVersioned", func(ctx context.Context, entry *AuditEntry[M, I]) error {
+		raw, err := bson.Marshal(document)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrSaveVersioned, err)
+		}
+
+		var filter = bson.D{{Key: "_id", Value: bson.Raw(raw).Lookup("_id")}}
+		entry.Filter = filter
+
+		before, id, err := a.snapshot(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		err = a.Repository.SaveVersioned(ctx, document, opts...)
+		if err != nil {
+			return err
+		}
+
+		if id != nil {
+			entry.Before, entry.IDs = before, []I{*id}
+		}
+
+		entry.After, id, err = a.snapshot(ctx, filter)
+		if id != nil {
+			entry.IDs = []I{*id}
+		}
+		return err
+	})
+}
+
+// record runs the write and records the entry it fills, in a transaction when configured to.
+func (a *Audited[M, I]) record(
+	ctx context.Context,
+	operation string,
+	write func(ctx context.Context, entry *AuditEntry[M, I]) error,
+) error {
+	var run = func(ctx context.Context) error {
+		var entry = &AuditEntry[M, I]{Operation: operation}
+
+		err := write(ctx, entry)
+		if err != nil {
+			return err
+		}
+
+		entry.ID = primitive.NewObjectID()
+		entry.Time = a.Repository.settings.now()
+		entry.Actor = a.audit.actor(ctx)
+
+		collection, err := a.auditCollection(ctx)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrAudit, err)
+		}
+
+		_, err = collection.InsertOne(ctx, entry)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrAudit, err)
+		}
+
+		return nil
+	}
+
+	if a.audit.transaction {
+		return WithTransaction(ctx, a.client, run, a.audit.transactionOptions...)
+	}
+
+	return run(ctx)
+}
+
+// snapshot returns the stored document that matches the filter and its ID, or a nil ID when there is none.
+func (a *Audited[M, I]) snapshot(ctx context.Context, filter any) (M, *I, error) {
+	var value M
+
+	filter, err := a.scoped(ctx, filter)
+	if err != nil {
+		return value, nil, fmt.Errorf("%w: %w", ErrAudit, err)
+	}
+
+	collection, err := a.collection(ctx)
+	if err != nil {
+		return value, nil, fmt.Errorf("%w: %w", ErrAudit, err)
+	}
+
+	raw, err := collection.FindOne(ctx, filter).DecodeBytes()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return value, nil, nil
+	}
+	if err != nil {
+		return value, nil, fmt.Errorf("%w: failed to snapshot document: %w", ErrAudit, err)
+	}
+
+	var id I
+	err = bson.Unmarshal(raw, &value)
+	if err == nil {
+		err = raw.Lookup("_id").Unmarshal(&id)
+	}
+	if err != nil {
+		return value, nil, fmt.Errorf("%w: failed to decode snapshot: %w", ErrAudit, err)
+	}
+
+	return value, &id, nil
+}
+
+// ids returns the IDs of the documents that match the filter.
+func (a *Audited[M, I]) ids(ctx context.Context, filter any) ([]I, error) {
+	filter, err := a.scoped(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAudit, err)
+	}
+
+	collection, err := a.collection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAudit, err)
+	}
+
+	cursor, err := collection.Find(
+		ctx,
+		filter,
+		options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to find affected documents: %w", ErrAudit, err)
+	}
+	defer cursor.Close(ctx)
+
+	var ids = []I{}
+	for cursor.Next(ctx) {
+		var id I
+		err := cursor.Current.Lookup("_id").Unmarshal(&id)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decode affected document ID: %w", ErrAudit, err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to find affected documents: %w", ErrAudit, err)
+	}
+
+	return ids, nil
+}
+
+func (a *Audited[M, I]) auditCollection(ctx context.Context) (*mongo.Collection, error) {
+	namespace, err := a.namespace(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var name = a.audit.collectionName
+	if name == "" {
+		name = namespace.Collection + "_audit"
+	}
+
+	return a.client.Database(namespace.Database).Collection(name), nil
+}
@@ -0,0 +1,355 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AuditModel struct {
+	ID   primitive.ObjectID `bson:"_id"`
+	Name string             `bson:"name"`
+}
+
+func (a *AuditModel) GetDatabaseName() string {
+	return "audit_model_db"
+}
+
+func (a *AuditModel) GetCollectionName() string {
+	return "audit_model_col"
+}
+
+func TestAudited(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var repository = NewAudited(NewRepository[*AuditModel, primitive.ObjectID](mongoClient))
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ctx = ContextWithActor(ctx, "alice")
+
+	defer func() {
+		for _, collection := range []string{"audit_model_col", "audit_model_col_audit"} {
+			err := mongoClient.Database("audit_model_db").Collection(collection).Drop(context.Background())
+			if err != nil {
+				t.Errorf("error dropping collection: %v", err)
+			}
+		}
+	}()
+
+	var apple = &AuditModel{ID: primitive.NewObjectID(), Name: "apple"}
+	var banana = &AuditModel{ID: primitive.NewObjectID(), Name: "banana"}
+
+	_, err = repository.InsertMany(ctx, []*AuditModel{apple, banana})
+	if err != nil {
+		t.Errorf("InsertMany() error = %v", err)
+		return
+	}
+
+	_, err = repository.UpdateOne(ctx, bson.M{"name": "apple"}, bson.M{"$set": bson.M{"name": "pear"}})
+	if err != nil {
+		t.Errorf("UpdateOne() error = %v", err)
+		return
+	}
+
+	_, err = repository.DeleteMany(ctx, bson.M{})
+	if err != nil {
+		t.Errorf("DeleteMany() error = %v", err)
+		return
+	}
+
+	entries, err := repository.FindAudit(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		t.Errorf("FindAudit() error = %v", err)
+		return
+	}
+
+	if len(entries) != 3 {
+		t.Errorf("FindAudit() got %d entries, want 3", len(entries))
+		return
+	}
+
+	var update = entries[1]
+	if update.Operation != "UpdateOne" || update.Actor != "alice" || len(update.IDs) != 1 || update.IDs[0] != apple.ID {
+		t.Errorf("FindAudit() update entry = %+v", update)
+	}
+	if update.Before == nil || update.Before.Name != "apple" || update.After == nil || update.After.Name != "pear" {
+		t.Errorf("FindAudit() update snapshots = %+v, %+v", update.Before, update.After)
+	}
+
+	if entries[2].Operation != "DeleteMany" || len(entries[2].IDs) != 2 {
+		t.Errorf("FindAudit() delete entry = %+v", entries[2])
+	}
+}
+
+func TestAudited_InsertStream(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var repository = NewAudited(NewRepository[*AuditModel, primitive.ObjectID](mongoClient))
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		for _, collection := range []string{"audit_model_col", "audit_model_col_audit"} {
+			err := mongoClient.Database("audit_model_db").Collection(collection).Drop(context.Background())
+			if err != nil {
+				t.Errorf("error dropping collection: %v", err)
+			}
+		}
+	}()
+
+	var existing = &AuditModel{ID: primitive.NewObjectID(), Name: "apple"}
+	_, err = repository.Repository.InsertOne(ctx, existing)
+	if err != nil {
+		t.Errorf("InsertOne() error = %v", err)
+		return
+	}
+
+	var documents = []*AuditModel{
+		{ID: primitive.NewObjectID(), Name: "banana"},
+		{ID: primitive.NewObjectID(), Name: "cherry"},
+		existing,
+		{ID: primitive.NewObjectID(), Name: "plum"},
+	}
+
+	_, err = repository.InsertStream(ctx, slices.Values(documents), &InsertStreamOptions{BatchSize: 2, Concurrency: 1})
+	if !errors.Is(err, ErrInsertStream) || !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("InsertStream() error = %v, want a duplicate key", err)
+		return
+	}
+
+	entries, err := repository.FindAudit(ctx, bson.M{"operation": "InsertStream"}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		t.Errorf("FindAudit() error = %v", err)
+		return
+	}
+
+	var recorded []primitive.ObjectID
+	for _, entry := range entries {
+		recorded = append(recorded, entry.IDs...)
+	}
+	slices.SortFunc(recorded, func(a, b primitive.ObjectID) int { return bytes.Compare(a[:], b[:]) })
+
+	var want = []primitive.ObjectID{documents[0].ID, documents[1].ID, documents[3].ID}
+	slices.SortFunc(want, func(a, b primitive.ObjectID) int { return bytes.Compare(a[:], b[:]) })
+
+	if len(entries) != 2 || !slices.Equal(recorded, want) {
+		t.Errorf("FindAudit() got %d entries recording %v, want 2 entries recording %v", len(entries), recorded, want)
+	}
+}
+
+func TestAudited_UpdateMany(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var repository = NewAudited(NewRepository[*AuditModel, primitive.ObjectID](mongoClient))
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		for _, collection := range []string{"audit_model_col", "audit_model_col_audit"} {
+			err := mongoClient.Database("audit_model_db").Collection(collection).Drop(context.Background())
+			if err != nil {
+				t.Errorf("error dropping collection: %v", err)
+			}
+		}
+	}()
+
+	var apple = &AuditModel{ID: primitive.NewObjectID(), Name: "apple"}
+	_, err = repository.InsertOne(ctx, apple)
+	if err != nil {
+		t.Errorf("InsertOne() error = %v", err)
+		return
+	}
+
+	result, err := repository.UpdateMany(ctx, bson.M{"name": "banana"}, bson.M{"$set": bson.M{"name": "cherry"}})
+	if err != nil || result.MatchedCount != 0 {
+		t.Errorf("UpdateMany() = %+v, %v, want nothing matched", result, err)
+		return
+	}
+
+	result, err = repository.UpdateMany(
+		ctx,
+		bson.M{"name": "banana"},
+		bson.M{"$set": bson.M{"size": 1}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil || result.UpsertedCount != 1 {
+		t.Errorf("UpdateMany() upsert = %+v, %v, want 1 upserted", result, err)
+		return
+	}
+
+	entries, err := repository.FindAudit(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil || len(entries) != 3 {
+		t.Errorf("FindAudit() = %d entries, %v, want 3", len(entries), err)
+		return
+	}
+
+	if len(entries[1].IDs) != 0 {
+		t.Errorf("FindAudit() update entry IDs = %v, want none", entries[1].IDs)
+	}
+	if len(entries[2].IDs) != 1 || entries[2].IDs[0] != *result.UpsertedID {
+		t.Errorf("FindAudit() upsert entry IDs = %v, want %v", entries[2].IDs, *result.UpsertedID)
+	}
+}
+
+func TestAudited_InsertMany_partial(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var repository = NewAudited(NewRepository[*AuditModel, primitive.ObjectID](mongoClient))
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		for _, collection := range []string{"audit_model_col", "audit_model_col_audit"} {
+			err := mongoClient.Database("audit_model_db").Collection(collection).Drop(context.Background())
+			if err != nil {
+				t.Errorf("error dropping collection: %v", err)
+			}
+		}
+	}()
+
+	var existing = &AuditModel{ID: primitive.NewObjectID(), Name: "apple"}
+	_, err = repository.Repository.InsertOne(ctx, existing)
+	if err != nil {
+		t.Errorf("InsertOne() error = %v", err)
+		return
+	}
+
+	var documents = []*AuditModel{
+		{ID: primitive.NewObjectID(), Name: "banana"},
+		existing,
+		{ID: primitive.NewObjectID(), Name: "cherry"},
+	}
+
+	_, err = repository.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	if !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("InsertMany() error = %v, want a duplicate key", err)
+		return
+	}
+
+	entries, err := repository.FindAudit(ctx, bson.M{"operation": "InsertMany"})
+	if err != nil || len(entries) != 1 {
+		t.Errorf("FindAudit() = %d entries, %v, want 1", len(entries), err)
+		return
+	}
+
+	var want = []primitive.ObjectID{documents[0].ID, documents[2].ID}
+	if !slices.Equal(entries[0].IDs, want) {
+		t.Errorf("FindAudit() IDs = %v, want %v", entries[0].IDs, want)
+	}
+}
+
+func TestAudited_BulkWrite_partial(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var repository = NewAudited(NewRepository[*AuditModel, primitive.ObjectID](mongoClient))
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		for _, collection := range []string{"audit_model_col", "audit_model_col_audit"} {
+			err := mongoClient.Database("audit_model_db").Collection(collection).Drop(context.Background())
+			if err != nil {
+				t.Errorf("error dropping collection: %v", err)
+			}
+		}
+	}()
+
+	var existing = &AuditModel{ID: primitive.NewObjectID(), Name: "apple"}
+	_, err = repository.Repository.InsertOne(ctx, existing)
+	if err != nil {
+		t.Errorf("InsertOne() error = %v", err)
+		return
+	}
+
+	var inserted = &AuditModel{ID: primitive.NewObjectID(), Name: "banana"}
+	_, err = repository.BulkWrite(ctx, []WriteModel[*AuditModel, primitive.ObjectID]{
+		InsertOneModel[*AuditModel, primitive.ObjectID](existing),
+		UpdateOneModel[*AuditModel, primitive.ObjectID](bson.M{"_id": existing.ID}, bson.M{"$set": bson.M{"name": "pear"}}),
+		InsertOneModel[*AuditModel, primitive.ObjectID](inserted),
+	}, options.BulkWrite().SetOrdered(false))
+
+	var bulkErr *BulkError
+	if !errors.As(err, &bulkErr) || !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("BulkWrite() error = %v, want a *BulkError", err)
+		return
+	}
+
+	entries, err := repository.FindAudit(ctx, bson.M{"operation": "BulkWrite"})
+	if err != nil || len(entries) != 1 {
+		t.Errorf("FindAudit() = %d entries, %v, want 1", len(entries), err)
+		return
+	}
+
+	var want = []primitive.ObjectID{existing.ID, inserted.ID}
+	if !slices.Equal(entries[0].IDs, want) {
+		t.Errorf("FindAudit() IDs = %v, want %v", entries[0].IDs, want)
+	}
+}
@@ -0,0 +1,109 @@
+package repo
+
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// BulkError reports the documents a bulk write failed to write. InsertMany returns it, wrapped in a *RepoError,
+// along with the IDs of the documents that were inserted, so that only the failed documents need to be retried:
+//
+//	ids, err := usersRepo.InsertMany(ctx, users, options.InsertMany().SetOrdered(false))
+//
+//	var bulkErr *repo.BulkError
+//	if errors.As(err, &bulkErr) {
+//		for _, i := range bulkErr.Failed() {
+//			retry = append(retry, users[i])
+//		}
+//	}
+type BulkError struct {
+	Failures []BulkFailure // The documents the server rejected, in input order.
+	Skipped  []int         // The input indexes of the documents after the failure of an ordered write, which were not attempted.
+	Err      error         // The driver error.
+}
+
+// BulkFailure is a document of a bulk write that the server rejected.
+type BulkFailure struct {
+	Index int       // The input index of the document.
+	Kind  ErrorKind // The kind of the failure.
+	Err   error     // The failure, a *RepoError carrying the index and key values of duplicate keys.
+}
+
+// NewBulkError reports which of the documents of a bulk write failed and which were skipped, given the exception of
+// the driver. It is meant for implementations of Store that return the same errors as Repository.
+func NewBulkError(
+	op string,
+	namespace Namespace,
+	documents int,
+	ordered bool,
+	exception mongo.BulkWriteException,
+) *BulkError {
+	var bulkErr = &BulkError{Err: exception}
+
+	var last = -1
+	for _, e := range exception.WriteErrors {
+		var failure = NewRepoError(op, namespace, e.WriteError)
+		bulkErr.Failures = append(bulkErr.Failures, BulkFailure{Index: e.Index, Kind: failure.Kind, Err: failure})
+		last = max(last, e.Index)
+	}
+
+	if ordered && last >= 0 {
+		for i := last + 1; i < documents; i++ {
+			bulkErr.Skipped = append(bulkErr.Skipped, i)
+		}
+	}
+
+	return bulkErr
+}
+
+func (e *BulkError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *BulkError) Unwrap() error {
+	return e.Err
+}
+
+// Failed returns the input indexes of the documents that were not written, whether they failed or were skipped,
+// in order.
+func (e *BulkError) Failed() []int {
+	var failed = make([]int, 0, len(e.Failures)+len(e.Skipped))
+	for _, f := range e.Failures {
+		failed = append(failed, f.Index)
+	}
+	return append(failed, e.Skipped...)
+}
+
+// written reports which of the documents of a bulk write were written.
+func (e *BulkError) written(documents int) []bool {
+	var written = make([]bool, documents)
+	for i := range written {
+		written[i] = true
+	}
+	for _, i := range e.Failed() {
+		if i >= 0 && i < documents {
+			written[i] = false
+		}
+	}
+	return written
+}
+
+// writtenIDs returns the IDs returned by InsertMany of the documents that were inserted.
+func writtenIDs[I any](ids []I, err error) []I {
+	var bulkErr *BulkError
+	if !errors.As(err, &bulkErr) {
+		if err != nil {
+			return nil
+		}
+		return ids
+	}
+
+	var inserted []I
+	for i, written := range bulkErr.written(len(ids)) {
+		if written {
+			inserted = append(inserted, ids[i])
+		}
+	}
+	return inserted
+}
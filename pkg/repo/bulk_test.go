@@ -0,0 +1,164 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type BulkModel struct {
+	ID   primitive.ObjectID `bson:"_id"`
+	Name string             `bson:"name"`
+}
+
+func (b *BulkModel) GetDatabaseName() string {
+	return "bulk_model_db"
+}
+
+func (b *BulkModel) GetCollectionName() string {
+	return "bulk_model_col"
+}
+
+func TestNewBulkError(t *testing.T) {
+	var exception = mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+		{WriteError: mongo.WriteError{Index: 1, Code: 11000, Message: "E11000 duplicate key error index: _id_ dup key: { _id: 1 }"}},
+		{WriteError: mongo.WriteError{Index: 3, Code: 121, Message: "Document failed validation"}},
+	}}
+
+	tests := []struct {
+		name     string
+		ordered  bool
+		kinds    []ErrorKind
+		skipped  []int
+		failed   []int
+		inserted []bool
+	}{
+		{
+			name:     "unordered",
+			ordered:  false,
+			kinds:    []ErrorKind{KindDuplicateKey, KindValidation},
+			failed:   []int{1, 3},
+			inserted: []bool{true, false, true, false, true},
+		},
+		{
+			name:     "ordered",
+			ordered:  true,
+			kinds:    []ErrorKind{KindDuplicateKey, KindValidation},
+			skipped:  []int{4},
+			failed:   []int{1, 3, 4},
+			inserted: []bool{true, false, true, false, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bulkErr = NewBulkError("InsertMany", Namespace{Database: "db", Collection: "col"}, 5, tt.ordered, exception)
+
+			var kinds []ErrorKind
+			for _, f := range bulkErr.Failures {
+				kinds = append(kinds, f.Kind)
+			}
+			if !reflect.DeepEqual(kinds, tt.kinds) {
+				t.Errorf("kinds = %v, want %v", kinds, tt.kinds)
+			}
+			if !reflect.DeepEqual(bulkErr.Skipped, tt.skipped) {
+				t.Errorf("Skipped = %v, want %v", bulkErr.Skipped, tt.skipped)
+			}
+			if !reflect.DeepEqual(bulkErr.Failed(), tt.failed) {
+				t.Errorf("Failed() = %v, want %v", bulkErr.Failed(), tt.failed)
+			}
+			if got := bulkErr.written(5); !reflect.DeepEqual(got, tt.inserted) {
+				t.Errorf("written() = %v, want %v", got, tt.inserted)
+			}
+
+			var repoErr *RepoError
+			if !errors.As(bulkErr.Failures[0].Err, &repoErr) || repoErr.Index != "_id_" {
+				t.Errorf("failure error = %+v, want the _id_ index", bulkErr.Failures[0].Err)
+			}
+		})
+	}
+}
+
+func TestRepository_InsertMany_partial(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var repository = NewRepository[*BulkModel, primitive.ObjectID](mongoClient)
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		err := mongoClient.Database("bulk_model_db").Collection("bulk_model_col").Drop(context.Background())
+		if err != nil {
+			t.Errorf("error dropping collection: %v", err)
+		}
+	}()
+
+	var existing = &BulkModel{ID: primitive.NewObjectID(), Name: "apple"}
+	_, err = repository.InsertOne(ctx, existing)
+	if err != nil {
+		t.Errorf("InsertOne() error = %v", err)
+		return
+	}
+
+	var documents = []*BulkModel{
+		{ID: primitive.NewObjectID(), Name: "banana"},
+		existing,
+		{ID: primitive.NewObjectID(), Name: "cherry"},
+	}
+
+	ids, err := repository.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+
+	var bulkErr *BulkError
+	if !errors.Is(err, ErrInsertMany) || !errors.Is(err, ErrDuplicateKey) || !errors.As(err, &bulkErr) {
+		t.Errorf("InsertMany() error = %v, want a *BulkError", err)
+		return
+	}
+	if !reflect.DeepEqual(bulkErr.Failed(), []int{1}) || bulkErr.Failures[0].Kind != KindDuplicateKey {
+		t.Errorf("InsertMany() failures = %+v, want a duplicate key at 1", bulkErr.Failures)
+	}
+
+	var want = []primitive.ObjectID{documents[0].ID, primitive.NilObjectID, documents[2].ID}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("InsertMany() ids = %v, want %v", ids, want)
+	}
+}
+
+func TestWrittenIDs(t *testing.T) {
+	var ids = []int{1, 0, 3}
+	var bulkErr = &BulkError{Failures: []BulkFailure{{Index: 1}}}
+
+	tests := []struct {
+		name string
+		err  error
+		want []int
+	}{
+		{name: "no error", want: []int{1, 0, 3}},
+		{name: "partial", err: fmt.Errorf("%w: %w", ErrInsertMany, bulkErr), want: []int{1, 3}},
+		{name: "failed", err: ErrInsertMany},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := writtenIDs(ids, tt.err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("writtenIDs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,433 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/AISystemsInc/mongo-resource-repo/pkg/repo/internal/meta"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type writeKind int
+
+const (
+	insertOneWrite writeKind = iota
+	updateOneWrite
+	updateManyWrite
+	replaceOneWrite
+	deleteOneWrite
+	deleteManyWrite
+)
+
+// WriteModel is a write of a BulkWrite, created with InsertOneModel, UpdateOneModel, UpdateManyModel,
+// ReplaceOneModel, DeleteOneModel or DeleteManyModel. Each write gets the same treatment as the equivalent
+// repository method: hooks, timestamps, scope and soft delete.
+type WriteModel[M Model, I any] struct {
+	kind           writeKind
+	document       M
+	filter         any
+	update         any
+	updateOptions  []*options.UpdateOptions
+	replaceOptions []*options.ReplaceOptions
+	deleteOptions  []*options.DeleteOptions
+}
+
+// InsertOneModel inserts a document, like InsertOne.
+func InsertOneModel[M Model, I any](document M) WriteModel[M, I] {
+	return WriteModel[M, I]{kind: insertOneWrite, document: document}
+}
+
+// UpdateOneModel updates the first document that matches the filter, like UpdateOne.
+func UpdateOneModel[M Model, I any](filter any, update any, opts ...*options.UpdateOptions) WriteModel[M, I] {
+	return WriteModel[M, I]{kind: updateOneWrite, filter: filter, update: update, updateOptions: opts}
+}
+
+// UpdateManyModel updates the documents that match the filter, like UpdateMany.
+func UpdateManyModel[M Model, I any](filter any, update any, opts ...*options.UpdateOptions) WriteModel[M, I] {
+	return WriteModel[M, I]{kind: updateManyWrite, filter: filter, update: update, updateOptions: opts}
+}
+
+// ReplaceOneModel replaces the first document that matches the filter. Like SaveVersioned, the replacement is
+// validated, its updatedAt timestamp is set, it is stamped with the scope of the context and the BeforeUpdate hook is
+// called with it as the update. The createdAt timestamp of the stored document is kept, and set on upserts.
+func ReplaceOneModel[M Model, I any](filter any, replacement M, opts ...*options.ReplaceOptions) WriteModel[M, I] {
+	return WriteModel[M, I]{kind: replaceOneWrite, filter: filter, document: replacement, replaceOptions: opts}
+}
+
+// DeleteOneModel deletes the first document that matches the filter, like DeleteOne.
+func DeleteOneModel[M Model, I any](filter any, opts ...*options.DeleteOptions) WriteModel[M, I] {
+	return WriteModel[M, I]{kind: deleteOneWrite, filter: filter, deleteOptions: opts}
+}
+
+// DeleteManyModel deletes the documents that match the filter, like DeleteMany.
+func DeleteManyModel[M Model, I any](filter any, opts ...*options.DeleteOptions) WriteModel[M, I] {
+	return WriteModel[M, I]{kind: deleteManyWrite, filter: filter, deleteOptions: opts}
+}
+
+// target returns the filter of the documents an update, replace or delete may write, excluding soft deleted
+// documents for deletes, and whether it may write several. ok is false for inserts.
+func (w WriteModel[M, I]) target() (filter any, many bool, ok bool) {
+	switch w.kind {
+	case updateOneWrite, replaceOneWrite:
+		return w.filter, false, true
+	case updateManyWrite:
+		return w.filter, true, true
+	case deleteOneWrite:
+		return andFilters(w.filter, meta.For[M]().NotDeleted()), false, true
+	case deleteManyWrite:
+		return andFilters(w.filter, meta.For[M]().NotDeleted()), true, true
+	}
+	return nil, false, false
+}
+
+// deletes returns whether the write is a delete.
+func (w WriteModel[M, I]) deletes() bool {
+	return w.kind == deleteOneWrite || w.kind == deleteManyWrite
+}
+
+// withFilter returns the write with its filter replaced.
+func (w WriteModel[M, I]) withFilter(filter any) WriteModel[M, I] {
+	w.filter = filter
+	return w
+}
+
+// BulkWriteResult is the result of a BulkWrite.
+type BulkWriteResult[I any] struct {
+	InsertedCount int64       // The number of documents inserted.
+	MatchedCount  int64       // The number of documents matched by updates and replaces.
+	ModifiedCount int64       // The number of documents modified by updates and replaces, and soft deleted.
+	DeletedCount  int64       // The number of documents deleted.
+	UpsertedCount int64       // The number of documents upserted.
+	InsertedIDs   map[int64]I // The _id of the inserted documents, by index of their write model.
+	UpsertedIDs   map[int64]I // The _id of the upserted documents, by index of their write model.
+}
+
+// BulkWrite applies inserts, updates, replaces and deletes in a single round trip:
+//
+//	result, err := usersRepo.BulkWrite(ctx, []repo.WriteModel[*User, primitive.ObjectID]{
+//		repo.InsertOneModel[*User, primitive.ObjectID](newUser),
+//		repo.UpdateOneModel[*User, primitive.ObjectID](bson.M{"_id": id}, bson.M{"$set": bson.M{"name": "Bob"}}),
+//		repo.DeleteManyModel[*User, primitive.ObjectID](bson.M{"active": false}),
+//	})
+//
+// Writes are ordered unless the Ordered option is set to false. When some writes fail, BulkWrite returns the result
+// of the others along with an error wrapping a *BulkError indexed by write model. AfterInsert hooks only run when
+// every write succeeded, and BeforeDelete hooks run while the writes are prepared.
+func (r *Repository[M, I]) BulkWrite(
+	ctx context.Context,
+	models []WriteModel[M, I],
+	opts ...*options.BulkWriteOptions,
+) (*BulkWriteResult[I], error) {
+	ctx, span := r.startSpan(ctx, "BulkWrite", nil)
+	result, err := r.bulkWrite(ctx, models, opts...)
+	err = r.classify(ctx, "BulkWrite", err)
+	span.end(err, bulkWriteAttributes(result)...)
+	return result, err
+}
+
+func (r *Repository[M, I]) bulkWrite(
+	ctx context.Context,
+	models []WriteModel[M, I],
+	opts ...*options.BulkWriteOptions,
+) (*BulkWriteResult[I], error) {
+	var writes = make([]mongo.WriteModel, len(models))
+	var inserted = make([]*M, len(models))
+	var insertedIDs = make(map[int64]I)
+	for i, model := range models {
+		var err error
+		switch model.kind {
+		case insertOneWrite:
+			var document = model.document
+			var id I
+			writes[i], id, err = r.prepareInsert(ctx, &document)
+			inserted[i], insertedIDs[int64(i)] = &document, id
+		case updateOneWrite, updateManyWrite:
+			writes[i], err = r.prepareUpdate(ctx, model)
+		case replaceOneWrite:
+			writes[i], err = r.prepareReplace(ctx, model)
+		case deleteOneWrite, deleteManyWrite:
+			writes[i], err = r.prepareDelete(ctx, model)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: model %d: %w", ErrBulkWrite, i, err)
+		}
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBulkWrite, err)
+	}
+
+	result, err := collection.BulkWrite(ctx, writes, opts...)
+
+	var exception mongo.BulkWriteException
+	if err != nil && (result == nil || !errors.As(err, &exception)) {
+		return nil, fmt.Errorf("%w: %w", ErrBulkWrite, err)
+	}
+
+	var bulkErr *BulkError
+	if err != nil {
+		var ordered = options.MergeBulkWriteOptions(opts...).Ordered
+		bulkErr = NewBulkError("BulkWrite", r.operationNamespace(ctx), len(models), ordered == nil || *ordered, exception)
+
+		var written = bulkErr.written(len(models))
+		for i := range insertedIDs {
+			if !written[i] {
+				delete(insertedIDs, i)
+			}
+		}
+	}
+
+	var upsertedIDs = make(map[int64]I, len(result.UpsertedIDs))
+	for i, id := range result.UpsertedIDs {
+		if upsertedID, ok := id.(I); ok {
+			upsertedIDs[i] = upsertedID
+		} else {
+			return nil, fmt.Errorf("%w: failed to convert upserted ID (type %T) to type %T", ErrBulkWrite, id, upsertedID)
+		}
+	}
+
+	var bulkResult = &BulkWriteResult[I]{
+		InsertedCount: result.InsertedCount,
+		MatchedCount:  result.MatchedCount,
+		ModifiedCount: result.ModifiedCount,
+		DeletedCount:  result.DeletedCount,
+		UpsertedCount: result.UpsertedCount,
+		InsertedIDs:   insertedIDs,
+		UpsertedIDs:   upsertedIDs,
+	}
+
+	if bulkErr != nil {
+		return bulkResult, fmt.Errorf("%w: %w", ErrBulkWrite, bulkErr)
+	}
+
+	for i, document := range inserted {
+		if document == nil {
+			continue
+		}
+		err := afterInsert(ctx, document)
+		if err != nil {
+			return bulkResult, fmt.Errorf("%w: model %d: %w", ErrBulkWrite, i, err)
+		}
+	}
+
+	return bulkResult, nil
+}
+
+// prepareInsert prepares an insert like InsertOne does. The document is encoded, and given an _id when it has none,
+// so that its ID is known before it is written.
+func (r *Repository[M, I]) prepareInsert(ctx context.Context, document *M) (mongo.WriteModel, I, error) {
+	var id I
+
+	err := r.stampInsert(document)
+	if err != nil {
+		return nil, id, err
+	}
+
+	err = r.stampScope(ctx, document)
+	if err != nil {
+		return nil, id, err
+	}
+
+	err = beforeInsert(ctx, document)
+	if err != nil {
+		return nil, id, err
+	}
+
+	raw, err := bson.Marshal(*document)
+	if err != nil {
+		return nil, id, err
+	}
+
+	// like the driver, an _id is generated for documents that have none.
+	value, err := bson.Raw(raw).LookupErr("_id")
+	if err != nil {
+		elements, err := bson.Raw(raw).Elements()
+		if err != nil {
+			return nil, id, err
+		}
+
+		var generated = bson.D{{Key: "_id", Value: primitive.NewObjectID()}}
+		for _, e := range elements {
+			generated = append(generated, bson.E{Key: e.Key(), Value: e.Value()})
+		}
+
+		raw, err = bson.Marshal(generated)
+		if err != nil {
+			return nil, id, err
+		}
+		value = bson.Raw(raw).Lookup("_id")
+	}
+
+	err = value.Unmarshal(&id)
+	if err != nil {
+		return nil, id, fmt.Errorf("failed to convert inserted ID to type %T: %w", id, err)
+	}
+
+	return mongo.NewInsertOneModel().SetDocument(bson.Raw(raw)), id, nil
+}
+
+// prepareUpdate prepares an update like UpdateOne and UpdateMany do.
+func (r *Repository[M, I]) prepareUpdate(ctx context.Context, model WriteModel[M, I]) (mongo.WriteModel, error) {
+	err := beforeUpdate[M](ctx, model.filter, model.update)
+	if err != nil {
+		return nil, err
+	}
+
+	update, err := r.stampUpdate(model.update, model.updateOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := r.scoped(ctx, model.filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return updateWrite(filter, update, model.kind == updateManyWrite, options.MergeUpdateOptions(model.updateOptions...)), nil
+}
+
+// updateWrite returns the driver model of an update.
+func updateWrite(filter any, update any, many bool, o *options.UpdateOptions) mongo.WriteModel {
+	if many {
+		var write = mongo.NewUpdateManyModel().SetFilter(filter).SetUpdate(update)
+		if o.Upsert != nil {
+			write.SetUpsert(*o.Upsert)
+		}
+		if o.ArrayFilters != nil {
+			write.SetArrayFilters(*o.ArrayFilters)
+		}
+		if o.Collation != nil {
+			write.SetCollation(o.Collation)
+		}
+		if o.Hint != nil {
+			write.SetHint(o.Hint)
+		}
+		return write
+	}
+
+	var write = mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update)
+	if o.Upsert != nil {
+		write.SetUpsert(*o.Upsert)
+	}
+	if o.ArrayFilters != nil {
+		write.SetArrayFilters(*o.ArrayFilters)
+	}
+	if o.Collation != nil {
+		write.SetCollation(o.Collation)
+	}
+	if o.Hint != nil {
+		write.SetHint(o.Hint)
+	}
+	return write
+}
+
+// prepareReplace prepares a replace, which is validated, timestamped, scoped and hooked like SaveVersioned.
+func (r *Repository[M, I]) prepareReplace(ctx context.Context, model WriteModel[M, I]) (mongo.WriteModel, error) {
+	var m = meta.For[M]()
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	var document = model.document
+	if v, ok := hook[Validator](&document); ok {
+		if err := v.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrValidation, err)
+		}
+	}
+
+	err := r.stampScope(ctx, &document)
+	if err != nil {
+		return nil, err
+	}
+
+	replacement, err := m.StampReplace(&document, r.settings.now())
+	if err != nil {
+		return nil, err
+	}
+
+	err = beforeUpdate[M](ctx, model.filter, replacement)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := r.scoped(ctx, model.filter)
+	if err != nil {
+		return nil, err
+	}
+
+	o := options.MergeReplaceOptions(model.replaceOptions...)
+
+	// models with a createdAt field are replaced by an update pipeline, which keeps the stored createdAt.
+	if pipeline, ok := replacement.(mongo.Pipeline); ok {
+		return updateWrite(filter, pipeline, false, &options.UpdateOptions{
+			Upsert:    o.Upsert,
+			Collation: o.Collation,
+			Hint:      o.Hint,
+		}), nil
+	}
+
+	var write = mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(replacement)
+	if o.Upsert != nil {
+		write.SetUpsert(*o.Upsert)
+	}
+	if o.Collation != nil {
+		write.SetCollation(o.Collation)
+	}
+	if o.Hint != nil {
+		write.SetHint(o.Hint)
+	}
+	return write, nil
+}
+
+// prepareDelete prepares a delete like DeleteOne and DeleteMany do, which is an update of models that are soft deleted.
+func (r *Repository[M, I]) prepareDelete(ctx context.Context, model WriteModel[M, I]) (mongo.WriteModel, error) {
+	var many = model.kind == deleteManyWrite
+
+	filter, err := r.scoped(ctx, r.visible(model.filter))
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err = r.beforeDelete(ctx, filter, many, model.deleteOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	o := options.MergeDeleteOptions(model.deleteOptions...)
+
+	var m = meta.For[M]()
+	if m.SoftDelete() {
+		var now = r.settings.now()
+		update, err := m.StampUpdate(m.DeleteUpdate(now), now, false)
+		if err != nil {
+			return nil, err
+		}
+
+		return updateWrite(filter, update, many, &options.UpdateOptions{Collation: o.Collation, Hint: o.Hint}), nil
+	}
+
+	if many {
+		var write = mongo.NewDeleteManyModel().SetFilter(filter)
+		if o.Collation != nil {
+			write.SetCollation(o.Collation)
+		}
+		if o.Hint != nil {
+			write.SetHint(o.Hint)
+		}
+		return write, nil
+	}
+
+	var write = mongo.NewDeleteOneModel().SetFilter(filter)
+	if o.Collation != nil {
+		write.SetCollation(o.Collation)
+	}
+	if o.Hint != nil {
+		write.SetHint(o.Hint)
+	}
+	return write, nil
+}
@@ -0,0 +1,295 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type BulkWriteModel struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Name      string             `bson:"name"`
+	DeletedAt *time.Time         `bson:"deletedAt,omitempty" repo:"deletedAt"`
+}
+
+func (b *BulkWriteModel) GetDatabaseName() string {
+	return "bulk_write_model_db"
+}
+
+func (b *BulkWriteModel) GetCollectionName() string {
+	return "bulk_write_model_col"
+}
+
+type BulkReplaceModel struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Name      string             `bson:"name"`
+	CreatedAt time.Time          `bson:"createdAt" repo:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt" repo:"updatedAt"`
+}
+
+func (b *BulkReplaceModel) GetDatabaseName() string {
+	return "bulk_write_model_db"
+}
+
+func (b *BulkReplaceModel) GetCollectionName() string {
+	return "bulk_replace_model_col"
+}
+
+func (b *BulkReplaceModel) BeforeUpdate(_ context.Context, _ any, update any) error {
+	if pipeline, ok := update.(mongo.Pipeline); ok && strings.Contains(fmt.Sprint(pipeline), "forbidden") {
+		return errors.New("forbidden name")
+	}
+	return nil
+}
+
+func TestRepository_prepareInsert(t *testing.T) {
+	var repository = NewRepository[*BulkWriteModel, primitive.ObjectID](nil)
+	var id = primitive.NewObjectID()
+
+	tests := []struct {
+		name     string
+		document *BulkWriteModel
+		wantID   bool
+	}{
+		{
+			name:     "with ID",
+			document: &BulkWriteModel{ID: id, Name: "apple"},
+			wantID:   true,
+		},
+		{
+			name:     "without ID",
+			document: &BulkWriteModel{Name: "apple"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			write, gotID, err := repository.prepareInsert(context.Background(), &tt.document)
+			if err != nil {
+				t.Fatalf("prepareInsert() error = %v", err)
+			}
+
+			if tt.wantID && gotID != id {
+				t.Errorf("prepareInsert() id = %v, want %v", gotID, id)
+			}
+			if gotID.IsZero() {
+				t.Errorf("prepareInsert() id is zero")
+			}
+
+			var document = write.(*mongo.InsertOneModel).Document.(bson.Raw)
+			var stored primitive.ObjectID
+			if err := document.Lookup("_id").Unmarshal(&stored); err != nil || stored != gotID {
+				t.Errorf("document _id = %v, want %v", stored, gotID)
+			}
+			if name := document.Lookup("name").StringValue(); name != "apple" {
+				t.Errorf("document name = %s, want apple", name)
+			}
+		})
+	}
+}
+
+func TestRepository_prepareDelete(t *testing.T) {
+	var repository = NewRepository[*BulkWriteModel, primitive.ObjectID](nil)
+
+	write, err := repository.prepareDelete(context.Background(), DeleteOneModel[*BulkWriteModel, primitive.ObjectID](bson.M{"name": "apple"}))
+	if err != nil {
+		t.Fatalf("prepareDelete() error = %v", err)
+	}
+
+	update, ok := write.(*mongo.UpdateOneModel)
+	if !ok {
+		t.Fatalf("prepareDelete() = %T, want a soft delete update", write)
+	}
+
+	raw, err := bson.Marshal(update.Update)
+	if err != nil {
+		t.Fatalf("failed to marshal update: %v", err)
+	}
+	if _, err := bson.Raw(raw).LookupErr("$set", "deletedAt"); err != nil {
+		t.Errorf("update = %v, want deletedAt to be set", bson.Raw(raw))
+	}
+}
+
+func TestRepository_prepareReplace(t *testing.T) {
+	var repository = NewRepository[*BulkReplaceModel, primitive.ObjectID](nil)
+	var id = primitive.NewObjectID()
+
+	write, err := repository.prepareReplace(context.Background(), ReplaceOneModel[*BulkReplaceModel, primitive.ObjectID](
+		bson.M{"_id": id},
+		&BulkReplaceModel{ID: id, Name: "apple"},
+		options.Replace().SetUpsert(true),
+	))
+	if err != nil {
+		t.Fatalf("prepareReplace() error = %v", err)
+	}
+
+	update, ok := write.(*mongo.UpdateOneModel)
+	if !ok || update.Upsert == nil || !*update.Upsert {
+		t.Fatalf("prepareReplace() = %+v, want an upserting update keeping createdAt", write)
+	}
+	if _, ok := update.Update.(mongo.Pipeline); !ok {
+		t.Errorf("prepareReplace() update = %T, want a pipeline", update.Update)
+	}
+
+	_, err = repository.prepareReplace(context.Background(), ReplaceOneModel[*BulkReplaceModel, primitive.ObjectID](
+		bson.M{"_id": id},
+		&BulkReplaceModel{ID: id, Name: "forbidden"},
+	))
+	if !errors.Is(err, ErrHook) {
+		t.Errorf("prepareReplace() error = %v, want %v", err, ErrHook)
+	}
+}
+
+func TestRepository_BulkWrite_replace(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var now = time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	var repository = NewRepository[*BulkReplaceModel, primitive.ObjectID](mongoClient, WithClock(func() time.Time { return now }))
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		err := mongoClient.Database("bulk_write_model_db").Collection("bulk_replace_model_col").Drop(context.Background())
+		if err != nil {
+			t.Errorf("error dropping collection: %v", err)
+		}
+	}()
+
+	var created = now
+	var existing = &BulkReplaceModel{ID: primitive.NewObjectID(), Name: "apple"}
+	_, err = repository.InsertOne(ctx, existing)
+	if err != nil {
+		t.Errorf("InsertOne() error = %v", err)
+		return
+	}
+
+	now = now.Add(time.Hour)
+	var upserted = primitive.NewObjectID()
+	_, err = repository.BulkWrite(ctx, []WriteModel[*BulkReplaceModel, primitive.ObjectID]{
+		ReplaceOneModel[*BulkReplaceModel, primitive.ObjectID](bson.M{"_id": existing.ID}, &BulkReplaceModel{ID: existing.ID, Name: "pear"}),
+		ReplaceOneModel[*BulkReplaceModel, primitive.ObjectID](
+			bson.M{"_id": upserted},
+			&BulkReplaceModel{ID: upserted, Name: "cherry"},
+			options.Replace().SetUpsert(true),
+		),
+	})
+	if err != nil {
+		t.Errorf("BulkWrite() error = %v", err)
+		return
+	}
+
+	replaced, err := repository.FindByID(ctx, existing.ID)
+	if err != nil || replaced.Name != "pear" || !replaced.CreatedAt.Equal(created) || !replaced.UpdatedAt.Equal(now) {
+		t.Errorf("FindByID() = %+v, %v, want pear created at %v and updated at %v", replaced, err, created, now)
+	}
+
+	inserted, err := repository.FindByID(ctx, upserted)
+	if err != nil || inserted.Name != "cherry" || !inserted.CreatedAt.Equal(now) {
+		t.Errorf("FindByID() = %+v, %v, want cherry created at %v", inserted, err, now)
+	}
+
+	_, err = repository.BulkWrite(ctx, []WriteModel[*BulkReplaceModel, primitive.ObjectID]{
+		ReplaceOneModel[*BulkReplaceModel, primitive.ObjectID](bson.M{"_id": existing.ID}, &BulkReplaceModel{ID: existing.ID, Name: "forbidden"}),
+	})
+	if !errors.Is(err, ErrHook) {
+		t.Errorf("BulkWrite() error = %v, want %v", err, ErrHook)
+	}
+}
+
+func TestRepository_BulkWrite(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var repository = NewRepository[*BulkWriteModel, primitive.ObjectID](mongoClient)
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		err := mongoClient.Database("bulk_write_model_db").Collection("bulk_write_model_col").Drop(context.Background())
+		if err != nil {
+			t.Errorf("error dropping collection: %v", err)
+		}
+	}()
+
+	var existing = &BulkWriteModel{ID: primitive.NewObjectID(), Name: "apple"}
+	_, err = repository.InsertOne(ctx, existing)
+	if err != nil {
+		t.Errorf("InsertOne() error = %v", err)
+		return
+	}
+
+	result, err := repository.BulkWrite(ctx, []WriteModel[*BulkWriteModel, primitive.ObjectID]{
+		InsertOneModel[*BulkWriteModel, primitive.ObjectID](&BulkWriteModel{Name: "banana"}),
+		UpdateOneModel[*BulkWriteModel, primitive.ObjectID](bson.M{"_id": existing.ID}, bson.M{"$set": bson.M{"name": "pear"}}),
+		UpdateOneModel[*BulkWriteModel, primitive.ObjectID](bson.M{"name": "cherry"}, bson.M{"$set": bson.M{"name": "cherry"}}, options.Update().SetUpsert(true)),
+		DeleteManyModel[*BulkWriteModel, primitive.ObjectID](bson.M{"name": "banana"}),
+	})
+	if err != nil {
+		t.Errorf("BulkWrite() error = %v", err)
+		return
+	}
+
+	if result.InsertedCount != 1 || result.MatchedCount != 2 || result.UpsertedCount != 1 {
+		t.Errorf("BulkWrite() result = %+v", result)
+	}
+	if _, ok := result.InsertedIDs[0]; !ok || len(result.InsertedIDs) != 1 {
+		t.Errorf("BulkWrite() inserted IDs = %v, want model 0", result.InsertedIDs)
+	}
+	if _, ok := result.UpsertedIDs[2]; !ok || len(result.UpsertedIDs) != 1 {
+		t.Errorf("BulkWrite() upserted IDs = %v, want model 2", result.UpsertedIDs)
+	}
+
+	count, err := repository.Count(ctx, bson.M{})
+	if err != nil || count != 2 {
+		t.Errorf("Count() = %d, %v, want 2 after the soft delete", count, err)
+	}
+
+	result, err = repository.BulkWrite(ctx, []WriteModel[*BulkWriteModel, primitive.ObjectID]{
+		InsertOneModel[*BulkWriteModel, primitive.ObjectID](&BulkWriteModel{Name: "plum"}),
+		InsertOneModel[*BulkWriteModel, primitive.ObjectID](existing),
+		InsertOneModel[*BulkWriteModel, primitive.ObjectID](&BulkWriteModel{Name: "kiwi"}),
+	}, options.BulkWrite().SetOrdered(false))
+
+	var bulkErr *BulkError
+	if !errors.Is(err, ErrBulkWrite) || !errors.Is(err, ErrDuplicateKey) || !errors.As(err, &bulkErr) {
+		t.Errorf("BulkWrite() error = %v, want a *BulkError", err)
+		return
+	}
+	if !reflect.DeepEqual(bulkErr.Failed(), []int{1}) {
+		t.Errorf("BulkWrite() failures = %+v, want model 1", bulkErr.Failures)
+	}
+	if _, ok := result.InsertedIDs[1]; ok || len(result.InsertedIDs) != 2 {
+		t.Errorf("BulkWrite() inserted IDs = %v, want models 0 and 2", result.InsertedIDs)
+	}
+}
@@ -0,0 +1,685 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Cache stores encoded documents for Cached repositories, e.g. in memory with LRUCache, or in Redis.
+type Cache interface {
+	// Get returns the value set for the key, and whether there is one.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set sets the value of the key, expiring after ttl, or never when ttl is 0.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes the keys.
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// CacheFlusher is implemented by caches that can remove every key with a prefix. Cached repositories watching their
+// collection use it to flush the documents of the collection when it is dropped or renamed. LRUCache implements it.
+type CacheFlusher interface {
+	// DeletePrefix removes the keys starting with prefix.
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+// CacheOption configures a Cached repository.
+type CacheOption func(*cacheSettings)
+
+type cacheSettings struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	watchCtx    context.Context
+	watchError  func(err error)
+}
+
+// WithCacheTTL sets how long documents are cached. Defaults to 5 minutes; 0 caches them until they are invalidated
+// or evicted.
+func WithCacheTTL(ttl time.Duration) CacheOption {
+	return func(s *cacheSettings) {
+		s.ttl = ttl
+	}
+}
+
+// WithNegativeCaching caches that no document has an ID for ttl, so that lookups of missing documents do not reach
+// the database either. Disabled by default.
+func WithNegativeCaching(ttl time.Duration) CacheOption {
+	return func(s *cacheSettings) {
+		s.negativeTTL = ttl
+	}
+}
+
+// WithCacheWatch invalidates the documents changed by other processes, by watching the collection with a change
+// stream until ctx is done. ctx also selects the tenant of the watched collection when tenant routing is enabled.
+// Errors of the change stream are passed to onError, if not nil, and the stream is reopened where it stopped.
+// Dropping or renaming the collection flushes its documents from caches implementing CacheFlusher; other caches keep
+// them until they expire, and the error is passed to onError.
+//
+// Change streams require a replica set or a sharded cluster.
+func WithCacheWatch(ctx context.Context, onError func(err error)) CacheOption {
+	return func(s *cacheSettings) {
+		s.watchCtx = ctx
+		s.watchError = onError
+	}
+}
+
+// Cached decorates a Repository so that documents looked up by ID are served from a Cache.
+//
+// FindByID, and FindOne with a filter on _id only and no options, read through the cache. Writes made through the
+// Cached repository invalidate the documents they affect, which costs an extra query to find their IDs for writes by
+// filter; use WithCacheWatch to also invalidate the documents written by other processes. Reads are not cached when
+// the repository has a scope that applies to the context, or in transactions.
+//
+// The cache is best effort: failing to read or fill it falls back to the database, but failing to invalidate it
+// fails the write with an error wrapping ErrCache, since the write was applied but the cache may be stale. A read
+// racing with a write may still cache the document as it was before the write, until the TTL expires.
+//
+// example:
+//
+//	usersRepo := repo.NewCached(repo.NewRepository[*User, primitive.ObjectID](client), repo.NewLRUCache(10_000))
+//	user, err := usersRepo.FindByID(ctx, id)
+type Cached[M Model, I any] struct {
+	*Repository[M, I]
+	cache    Cache
+	settings cacheSettings
+}
+
+var _ Store[Model, any] = (*Cached[Model, any])(nil)
+
+// NewCached creates a Cached repository around the given repository.
+func NewCached[M Model, I any](repository *Repository[M, I], cache Cache, opts ...CacheOption) *Cached[M, I] {
+	var c = &Cached[M, I]{
+		Repository: repository,
+		cache:      cache,
+		settings:   cacheSettings{ttl: 5 * time.Minute},
+	}
+
+	for _, opt := range opts {
+		opt(&c.settings)
+	}
+
+	if c.settings.watchCtx != nil {
+		go c.watch(c.settings.watchCtx)
+	}
+
+	return c
+}
+
+// FindByID returns the document with the given ID, from the cache when it is there.
+func (c *Cached[M, I]) FindByID(
+	ctx context.Context,
+	id I,
+	opts ...*options.FindOneOptions,
+) (M, error) {
+	if len(opts) > 0 {
+		return c.Repository.FindByID(ctx, id, opts...)
+	}
+	value, err := c.findByID(ctx, id)
+	return value, c.classify(ctx, "FindOne", err)
+}
+
+// FindOne returns the first document that matches the filter, from the cache when the filter is on _id only.
+func (c *Cached[M, I]) FindOne(
+	ctx context.Context,
+	filter any,
+	opts ...*options.FindOneOptions,
+) (M, error) {
+	if id, ok := idFilter[I](filter); ok && len(opts) == 0 {
+		value, err := c.findByID(ctx, id)
+		return value, c.classify(ctx, "FindOne", err)
+	}
+	return c.Repository.FindOne(ctx, filter, opts...)
+}
+
+func (c *Cached[M, I]) findByID(ctx context.Context, id I) (M, error) {
+	var value M
+
+	conditions, err := c.scopeFilter(ctx)
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOne, err)
+	}
+	if conditions != nil || mongo.SessionFromContext(ctx) != nil {
+		return c.Repository.FindByID(ctx, id)
+	}
+
+	key, err := c.key(ctx, id)
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOne, err)
+	}
+
+	raw, ok, err := c.cache.Get(ctx, key)
+	if err != nil || !ok {
+		raw, err = c.load(ctx, id)
+		if errors.Is(err, mongo.ErrNoDocuments) && c.settings.negativeTTL > 0 {
+			_ = c.cache.Set(ctx, key, []byte{}, c.settings.negativeTTL)
+		}
+		if err != nil {
+			return value, fmt.Errorf("%w: %w", ErrFindOne, err)
+		}
+
+		_ = c.cache.Set(ctx, key, raw, c.settings.ttl)
+	}
+
+	// an empty value caches that there is no document.
+	if len(raw) == 0 {
+		return value, fmt.Errorf("%w: %w", ErrFindOne, mongo.ErrNoDocuments)
+	}
+
+	err = bson.Unmarshal(raw, &value)
+	if err != nil {
+		return value, fmt.Errorf("%w: failed to decode result: %w", ErrFindOne, &decodeError{err})
+	}
+
+	err = afterFind(ctx, &value)
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOne, err)
+	}
+
+	return value, nil
+}
+
+// load reads the stored document, which is cached before the AfterFind hook runs.
+func (c *Cached[M, I]) load(ctx context.Context, id I) (bson.Raw, error) {
+	collection, err := c.collection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return collection.FindOne(ctx, c.visible(bson.D{{Key: "_id", Value: id}})).DecodeBytes()
+}
+
+// InsertOne inserts a single document, and invalidates a cached absence of it.
+func (c *Cached[M, I]) InsertOne(
+	ctx context.Context,
+	document M,
+	opts ...*options.InsertOneOptions,
+) (I, error) {
+	insertedID, err := c.Repository.InsertOne(ctx, document, opts...)
+	if err != nil {
+		return insertedID, err
+	}
+	return insertedID, c.invalidate(ctx, ErrInsertOne, insertedID)
+}
+
+// InsertMany inserts multiple documents, and invalidates cached absences of them.
+func (c *Cached[M, I]) InsertMany(
+	ctx context.Context,
+	documents []M,
+	opts ...*options.InsertManyOptions,
+) ([]I, error) {
+	insertedIDs, err := c.Repository.InsertMany(ctx, documents, opts...)
+	if ierr := c.invalidate(ctx, ErrInsertMany, insertedIDs...); ierr != nil && err == nil {
+		err = ierr
+	}
+	return insertedIDs, err
+}
+
+// InsertStream inserts documents read from a sequence and invalidates the documents of each batch, so that their
+// absence is no longer cached.
+func (c *Cached[M, I]) InsertStream(
+	ctx context.Context,
+	documents iter.Seq[M],
+	opts ...*InsertStreamOptions,
+) (InsertStreamStats, error) {
+	return c.streamInserts(ctx, documents, func(ctx context.Context, batch []M) error {
+		insertedIDs, err := c.Repository.InsertMany(ctx, batch, options.InsertMany().SetOrdered(false))
+		if ierr := c.invalidate(ctx, ErrInsertStream, writtenIDs(insertedIDs, err)...); ierr != nil && err == nil {
+			err = ierr
+		}
+		return err
+	}, opts...)
+}
+
+// UpdateByID updates a single document by its ID and invalidates it.
+func (c *Cached[M, I]) UpdateByID(
+	ctx context.Context,
+	id I,
+	update any,
+	opts ...*options.UpdateOptions,
+) (*UpdateResult[I], error) {
+	result, err := c.Repository.UpdateByID(ctx, id, update, opts...)
+	if ierr := c.invalidate(ctx, ErrUpdateByID, id); ierr != nil && err == nil {
+		err = ierr
+	}
+	return result, err
+}
+
+// UpdateOne updates a single document by its filter and invalidates it.
+func (c *Cached[M, I]) UpdateOne(
+	ctx context.Context,
+	filter any,
+	update any,
+	opts ...*options.UpdateOptions,
+) (*UpdateResult[I], error) {
+	return c.update(ctx, ErrUpdateOne, filter, false, func(filter any) (*UpdateResult[I], error) {
+		return c.Repository.UpdateOne(ctx, filter, update, opts...)
+	})
+}
+
+// UpdateMany updates multiple documents by their filter and invalidates them.
+func (c *Cached[M, I]) UpdateMany(
+	ctx context.Context,
+	filter any,
+	update any,
+	opts ...*options.UpdateOptions,
+) (*UpdateResult[I], error) {
+	return c.update(ctx, ErrUpdateMany, filter, true, func(filter any) (*UpdateResult[I], error) {
+		return c.Repository.UpdateMany(ctx, filter, update, opts...)
+	})
+}
+
+func (c *Cached[M, I]) update(
+	ctx context.Context,
+	sentinel error,
+	filter any,
+	many bool,
+	write func(filter any) (*UpdateResult[I], error),
+) (*UpdateResult[I], error) {
+	ids, narrowed, err := c.affected(ctx, filter, many)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", sentinel, err)
+	}
+
+	result, err := write(narrowed)
+	if result != nil && result.UpsertedCount > 0 {
+		ids = append(ids, *result.UpsertedID)
+	}
+
+	if ierr := c.invalidate(ctx, sentinel, ids...); ierr != nil && err == nil {
+		err = ierr
+	}
+	return result, err
+}
+
+// BulkWrite applies the writes and invalidates the documents they affect.
+func (c *Cached[M, I]) BulkWrite(
+	ctx context.Context,
+	models []WriteModel[M, I],
+	opts ...*options.BulkWriteOptions,
+) (*BulkWriteResult[I], error) {
+	var ids []I
+	var narrowed = make([]WriteModel[M, I], len(models))
+	for i, model := range models {
+		narrowed[i] = model
+
+		filter, many, ok := model.target()
+		if !ok {
+			continue
+		}
+
+		affected, filter, err := c.affected(ctx, filter, many)
+		if err != nil {
+			return nil, fmt.Errorf("%w: model %d: %w", ErrBulkWrite, i, err)
+		}
+		ids = append(ids, affected...)
+		narrowed[i] = model.withFilter(filter)
+	}
+
+	result, err := c.Repository.BulkWrite(ctx, narrowed, opts...)
+	if result != nil {
+		for _, id := range result.InsertedIDs {
+			ids = append(ids, id)
+		}
+		for _, id := range result.UpsertedIDs {
+			ids = append(ids, id)
+		}
+	}
+
+	if ierr := c.invalidate(ctx, ErrBulkWrite, ids...); ierr != nil && err == nil {
+		err = ierr
+	}
+	return result, err
+}
+
+// FindOneAndUpdate updates a single document by its filter, returns it and invalidates it. The document is
+// identified by its _id, which the Projection option must not exclude.
+func (c *Cached[M, I]) FindOneAndUpdate(
+	ctx context.Context,
+	filter any,
+	update any,
+	opts ...*options.FindOneAndUpdateOptions,
+) (M, error) {
+	value, err := c.Repository.FindOneAndUpdate(ctx, filter, update, opts...)
+	return value, c.invalidateReturned(ctx, ErrFindOneAndUpdate, value, err)
+}
+
+// FindOneAndReplace replaces a single document by its filter, returns it and invalidates it. The document is
+// identified by its _id, which the Projection option must not exclude.
+func (c *Cached[M, I]) FindOneAndReplace(
+	ctx context.Context,
+	filter any,
+	replacement M,
+	opts ...*options.FindOneAndReplaceOptions,
+) (M, error) {
+	value, err := c.Repository.FindOneAndReplace(ctx, filter, replacement, opts...)
+	return value, c.invalidateReturned(ctx, ErrFindOneAndReplace, value, err)
+}
+
+// FindOneAndDelete deletes a single document by its filter, returns it and invalidates it. The document is
+// identified by its _id, which the Projection option must not exclude.
+func (c *Cached[M, I]) FindOneAndDelete(
+	ctx context.Context,
+	filter any,
+	opts ...*options.FindOneAndDeleteOptions,
+) (M, error) {
+	value, err := c.Repository.FindOneAndDelete(ctx, filter, opts...)
+	return value, c.invalidateReturned(ctx, ErrFindOneAndDelete, value, err)
+}
+
+// invalidateReturned invalidates the document returned by a FindOneAnd write, and returns the error of the write.
+func (c *Cached[M, I]) invalidateReturned(ctx context.Context, sentinel error, value M, err error) error {
+	if err != nil {
+		return err
+	}
+
+	id, ok := modelID[I](value)
+	if !ok {
+		return fmt.Errorf("%w: %w: the returned document has no _id", sentinel, ErrCache)
+	}
+
+	return c.invalidate(ctx, sentinel, id)
+}
+
+// DeleteOne deletes a single document by its filter and invalidates it.
+func (c *Cached[M, I]) DeleteOne(
+	ctx context.Context,
+	filter any,
+	opts ...*options.DeleteOptions,
+) (*mongo.DeleteResult, error) {
+	return c.delete(ctx, ErrDeleteOne, c.visible(filter), false, func(filter any) (*mongo.DeleteResult, error) {
+		return c.Repository.DeleteOne(ctx, filter, opts...)
+	})
+}
+
+// DeleteMany deletes multiple documents by their filter and invalidates them.
+func (c *Cached[M, I]) DeleteMany(
+	ctx context.Context,
+	filter any,
+	opts ...*options.DeleteOptions,
+) (*mongo.DeleteResult, error) {
+	return c.delete(ctx, ErrDeleteMany, c.visible(filter), true, func(filter any) (*mongo.DeleteResult, error) {
+		return c.Repository.DeleteMany(ctx, filter, opts...)
+	})
+}
+
+// Restore restores soft deleted documents and invalidates them.
+func (c *Cached[M, I]) Restore(
+	ctx context.Context,
+	filter any,
+	opts ...*options.UpdateOptions,
+) (int64, error) {
+	ids, narrowed, err := c.affected(ctx, filter, true)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrRestore, err)
+	}
+
+	restored, err := c.Repository.Restore(ctx, narrowed, opts...)
+	if ierr := c.invalidate(ctx, ErrRestore, ids...); ierr != nil && err == nil {
+		err = ierr
+	}
+	return restored, err
+}
+
+// SaveVersioned saves a versioned model and invalidates it.
+func (c *Cached[M, I]) SaveVersioned(
+	ctx context.Context,
+	document M,
+	opts ...*options.UpdateOptions,
+) error {
+	raw, err := bson.Marshal(document)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSaveVersioned, err)
+	}
+
+	var id I
+	err = bson.Raw(raw).Lookup("_id").Unmarshal(&id)
+	if err != nil {
+		return fmt.Errorf("%w: failed to decode ID: %w", ErrSaveVersioned, err)
+	}
+
+	err = c.Repository.SaveVersioned(ctx, document, opts...)
+	if ierr := c.invalidate(ctx, ErrSaveVersioned, id); ierr != nil && err == nil {
+		err = ierr
+	}
+	return err
+}
+
+func (c *Cached[M, I]) delete(
+	ctx context.Context,
+	sentinel error,
+	filter any,
+	many bool,
+	write func(filter any) (*mongo.DeleteResult, error),
+) (*mongo.DeleteResult, error) {
+	ids, narrowed, err := c.affected(ctx, filter, many)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", sentinel, err)
+	}
+
+	result, err := write(narrowed)
+	if ierr := c.invalidate(ctx, sentinel, ids...); ierr != nil && err == nil {
+		err = ierr
+	}
+	return result, err
+}
+
+// affected returns the IDs of the documents a write by filter affects, and the filter narrowed to them, so that
+// documents matching the filter in the meantime are not written without being invalidated. The filter is returned
+// as is when no document matches, so that upserts still apply.
+func (c *Cached[M, I]) affected(ctx context.Context, filter any, many bool) ([]I, any, error) {
+	scoped, err := c.scoped(ctx, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	collection, err := c.collection(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var findOptions = options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}})
+	if !many {
+		findOptions.SetLimit(1)
+	}
+
+	cursor, err := collection.Find(ctx, scoped, findOptions)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to find affected documents: %w", ErrCache, err)
+	}
+	defer cursor.Close(ctx)
+
+	var ids []I
+	for cursor.Next(ctx) {
+		var id I
+		err := cursor.Current.Lookup("_id").Unmarshal(&id)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: failed to decode affected document ID: %w", ErrCache, err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to find affected documents: %w", ErrCache, err)
+	}
+
+	if len(ids) == 0 {
+		return nil, filter, nil
+	}
+
+	return ids, andFilters(filter, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}), nil
+}
+
+// invalidate removes the documents with the given IDs from the cache.
+func (c *Cached[M, I]) invalidate(ctx context.Context, sentinel error, ids ...I) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var keys = make([]string, len(ids))
+	for i, id := range ids {
+		key, err := c.key(ctx, id)
+		if err != nil {
+			return fmt.Errorf("%w: %w: %w", sentinel, ErrCache, err)
+		}
+		keys[i] = key
+	}
+
+	err := c.cache.Delete(ctx, keys...)
+	if err != nil {
+		return fmt.Errorf("%w: %w: %w", sentinel, ErrCache, err)
+	}
+
+	return nil
+}
+
+// key returns the cache key of the document with the given ID, in the namespace of the context.
+func (c *Cached[M, I]) key(ctx context.Context, id I) (string, error) {
+	prefix, err := c.keyPrefix(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%v", prefix, id), nil
+}
+
+// keyPrefix returns the prefix of the cache keys of the documents in the namespace of the context.
+func (c *Cached[M, I]) keyPrefix(ctx context.Context) (string, error) {
+	namespace, err := c.namespace(ctx)
+	if err != nil {
+		return "", err
+	}
+	return namespace.String() + ":", nil
+}
+
+// flush removes every document of the namespace of the context from the cache.
+func (c *Cached[M, I]) flush(ctx context.Context) error {
+	flusher, ok := c.cache.(CacheFlusher)
+	if !ok {
+		return fmt.Errorf("%w: %w: the cache does not implement CacheFlusher, documents stay cached until they expire", ErrWatch, ErrCache)
+	}
+
+	prefix, err := c.keyPrefix(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w: %w", ErrWatch, ErrCache, err)
+	}
+
+	err = flusher.DeletePrefix(ctx, prefix)
+	if err != nil {
+		return fmt.Errorf("%w: %w: %w", ErrWatch, ErrCache, err)
+	}
+
+	return nil
+}
+
+// watch invalidates the documents of the change events of the collection until ctx is done,
+// reopening the stream where it stopped after errors. The cache is flushed when the collection is dropped or renamed,
+// and a new stream is opened after the invalidate event that ends the stream then.
+func (c *Cached[M, I]) watch(ctx context.Context) {
+	var pipeline = mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "operationType", Value: bson.D{{Key: "$in", Value: bson.A{
+			"insert", "update", "replace", "delete", "drop", "rename", "dropDatabase", "invalidate",
+		}}}}}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "operationType", Value: 1},
+			{Key: "documentKey", Value: 1},
+		}}},
+	}
+
+	var resumeToken bson.Raw
+	var invalidated bool
+	for ctx.Err() == nil {
+		var opts = options.ChangeStream()
+		if resumeToken != nil {
+			opts.SetStartAfter(resumeToken)
+		}
+
+		err := func() error {
+			stream, err := c.Repository.Watch(ctx, pipeline, opts)
+			if err != nil {
+				return err
+			}
+			defer stream.Close(context.WithoutCancel(ctx))
+
+			// documents cached between the invalidate event and the new stream are flushed too.
+			if invalidated {
+				if err := c.flush(ctx); err != nil {
+					return err
+				}
+				invalidated = false
+			}
+
+			for stream.Next(ctx) {
+				event, err := stream.Decode()
+				if err != nil {
+					return err
+				}
+				resumeToken = stream.ResumeToken()
+
+				switch event.OperationType {
+				case "drop", "rename", "dropDatabase":
+					err = c.flush(ctx)
+				case "invalidate":
+					// the stream cannot be resumed after an invalidate event, so a new one is opened.
+					resumeToken, invalidated = nil, true
+					return nil
+				default:
+					err = c.invalidate(ctx, ErrWatch, event.DocumentKey)
+				}
+				if err != nil {
+					return err
+				}
+			}
+
+			return stream.Err()
+		}()
+
+		if err != nil && ctx.Err() == nil && c.settings.watchError != nil {
+			c.settings.watchError(err)
+		}
+
+		if invalidated && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// idFilter returns the ID a filter matches when it is a filter on _id only, e.g. {_id: id}.
+func idFilter[I any](filter any) (I, bool) {
+	var value any
+	switch f := filter.(type) {
+	case bson.D:
+		if len(f) != 1 || f[0].Key != "_id" {
+			break
+		}
+		value = f[0].Value
+	case bson.M:
+		if len(f) != 1 {
+			break
+		}
+		value = f["_id"]
+	case map[string]any:
+		if len(f) != 1 {
+			break
+		}
+		value = f["_id"]
+	}
+
+	switch value.(type) {
+	case bson.D, bson.M, map[string]any, bson.A:
+		// a query on _id, e.g. {_id: {$in: [...]}}, when I is an interface type.
+		return *new(I), false
+	}
+
+	id, ok := value.(I)
+	return id, ok
+}
@@ -0,0 +1,307 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CachedModel struct {
+	ID   primitive.ObjectID `bson:"_id"`
+	Name string             `bson:"name"`
+}
+
+func (m *CachedModel) GetDatabaseName() string {
+	return "cached_model_db"
+}
+
+func (m *CachedModel) GetCollectionName() string {
+	return "cached_model_col"
+}
+
+func TestIDFilter(t *testing.T) {
+	var id = primitive.NewObjectID()
+
+	tests := []struct {
+		name   string
+		filter any
+		ok     bool
+	}{
+		{name: "bson.D", filter: bson.D{{Key: "_id", Value: id}}, ok: true},
+		{name: "bson.M", filter: bson.M{"_id": id}, ok: true},
+		{name: "map", filter: map[string]any{"_id": id}, ok: true},
+		{name: "other field", filter: bson.M{"name": "apple"}},
+		{name: "more fields", filter: bson.M{"_id": id, "name": "apple"}},
+		{name: "other ID type", filter: bson.M{"_id": id.Hex()}},
+		{name: "query on ID", filter: bson.M{"_id": bson.M{"$in": bson.A{id}}}},
+		{name: "nil", filter: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := idFilter[primitive.ObjectID](tt.filter)
+			if ok != tt.ok || (ok && got != id) {
+				t.Errorf("idFilter() = %v, %v, want ok %v", got, ok, tt.ok)
+			}
+		})
+	}
+
+	if _, ok := idFilter[any](bson.M{"_id": bson.M{"$in": bson.A{id}}}); ok {
+		t.Errorf("idFilter[any]() matched a query on _id")
+	}
+}
+
+func TestCached(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var cache = NewLRUCache(10)
+	var repository = NewCached(
+		NewRepository[*CachedModel, primitive.ObjectID](mongoClient),
+		cache,
+		WithNegativeCaching(time.Minute),
+	)
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var collection = mongoClient.Database("cached_model_db").Collection("cached_model_col")
+	defer func() {
+		err := collection.Drop(context.Background())
+		if err != nil {
+			t.Errorf("error dropping collection: %v", err)
+		}
+	}()
+
+	var id = primitive.NewObjectID()
+
+	_, err = repository.FindByID(ctx, id)
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("FindByID() missing error = %v, want ErrNoDocuments", err)
+	}
+	if cache.Len() != 1 {
+		t.Errorf("cache has %d entries, want the absence cached", cache.Len())
+	}
+
+	_, err = repository.InsertOne(ctx, &CachedModel{ID: id, Name: "apple"})
+	if err != nil {
+		t.Errorf("InsertOne() error = %v", err)
+		return
+	}
+
+	found, err := repository.FindOne(ctx, bson.M{"_id": id})
+	if err != nil || found.Name != "apple" {
+		t.Errorf("FindOne() = %v, %v, want apple", found, err)
+	}
+
+	// a write bypassing the repository is not seen until the document is invalidated
+	_, err = collection.UpdateByID(ctx, id, bson.M{"$set": bson.M{"name": "banana"}})
+	if err != nil {
+		t.Errorf("error updating document: %v", err)
+		return
+	}
+
+	found, err = repository.FindByID(ctx, id)
+	if err != nil || found.Name != "apple" {
+		t.Errorf("FindByID() = %v, %v, want cached apple", found, err)
+	}
+
+	_, err = repository.UpdateOne(ctx, bson.M{"name": "banana"}, bson.M{"$set": bson.M{"name": "cherry"}})
+	if err != nil {
+		t.Errorf("UpdateOne() error = %v", err)
+		return
+	}
+
+	found, err = repository.FindByID(ctx, id)
+	if err != nil || found.Name != "cherry" {
+		t.Errorf("FindByID() = %v, %v, want cherry", found, err)
+	}
+
+	_, err = repository.DeleteMany(ctx, bson.M{})
+	if err != nil {
+		t.Errorf("DeleteMany() error = %v", err)
+		return
+	}
+
+	_, err = repository.FindByID(ctx, id)
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("FindByID() deleted error = %v, want ErrNoDocuments", err)
+	}
+}
+
+func TestCached_InsertStream(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var cache = NewLRUCache(10)
+	var repository = NewCached(
+		NewRepository[*CachedModel, primitive.ObjectID](mongoClient),
+		cache,
+		WithNegativeCaching(time.Minute),
+	)
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		err := mongoClient.Database("cached_model_db").Collection("cached_model_col").Drop(context.Background())
+		if err != nil {
+			t.Errorf("error dropping collection: %v", err)
+		}
+	}()
+
+	var documents = []*CachedModel{
+		{ID: primitive.NewObjectID(), Name: "apple"},
+		{ID: primitive.NewObjectID(), Name: "banana"},
+		{ID: primitive.NewObjectID(), Name: "cherry"},
+	}
+
+	for _, document := range documents {
+		_, err = repository.FindByID(ctx, document.ID)
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("FindByID() error = %v, want %v", err, ErrNotFound)
+		}
+	}
+	if cache.Len() != len(documents) {
+		t.Errorf("cache has %d entries, want the absences cached", cache.Len())
+	}
+
+	stats, err := repository.InsertStream(ctx, slices.Values(documents), &InsertStreamOptions{BatchSize: 2})
+	if err != nil || stats.Inserted != 3 {
+		t.Errorf("InsertStream() = %+v, %v, want 3 inserted", stats, err)
+		return
+	}
+
+	for _, document := range documents {
+		found, err := repository.FindByID(ctx, document.ID)
+		if err != nil || found.Name != document.Name {
+			t.Errorf("FindByID() = %v, %v, want %s", found, err, document.Name)
+		}
+	}
+}
+
+func TestCached_watchDrop(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	var watchErrors = make(chan error, 10)
+	var cache = NewLRUCache(10)
+	var repository = NewCached(
+		NewRepository[*CachedModel, primitive.ObjectID](mongoClient),
+		cache,
+		WithCacheWatch(ctx, func(err error) {
+			select {
+			case watchErrors <- err:
+			default:
+			}
+		}),
+	)
+
+	var collection = mongoClient.Database("cached_model_db").Collection("cached_model_col")
+	defer func() {
+		err := collection.Drop(context.Background())
+		if err != nil {
+			t.Errorf("error dropping collection: %v", err)
+		}
+	}()
+
+	var eventually = func(what string, condition func() bool) bool {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+			if condition() {
+				return true
+			}
+		}
+		t.Errorf("%s did not happen", what)
+		return false
+	}
+
+	var cacheDocument = func(name string) primitive.ObjectID {
+		var id = primitive.NewObjectID()
+		// inserted past the repository, so the cache only learns about it through the reads and the watch.
+		_, err := collection.InsertOne(ctx, &CachedModel{ID: id, Name: name})
+		if err != nil {
+			t.Fatalf("error inserting document: %v", err)
+		}
+		_, err = repository.FindByID(ctx, id)
+		if err != nil {
+			t.Fatalf("FindByID() error = %v", err)
+		}
+		return id
+	}
+
+	// the stream is opened asynchronously, so wait for it to see an insert before dropping.
+	var first = cacheDocument("apple")
+	var watching = eventually("invalidating the updated document", func() bool {
+		_, err := collection.UpdateByID(ctx, first, bson.M{"$set": bson.M{"name": primitive.NewObjectID().Hex()}})
+		if err != nil {
+			t.Fatalf("error updating document: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		return cache.Len() == 0
+	})
+	if !watching {
+		return
+	}
+
+	cacheDocument("cherry")
+	err = collection.Drop(ctx)
+	if err != nil {
+		t.Fatalf("error dropping collection: %v", err)
+	}
+	if !eventually("flushing the dropped collection", func() bool { return cache.Len() == 0 }) {
+		return
+	}
+
+	// the watch reopens after the invalidate event that follows the drop.
+	var second = cacheDocument("damson")
+	_, err = collection.UpdateByID(ctx, second, bson.M{"$set": bson.M{"name": "elderberry"}})
+	if err != nil {
+		t.Fatalf("error updating document: %v", err)
+	}
+	eventually("invalidating after the drop", func() bool { return cache.Len() == 0 })
+
+	select {
+	case err := <-watchErrors:
+		t.Errorf("watch error = %v", err)
+	default:
+	}
+}
@@ -0,0 +1,170 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"iter"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Cursor iterates over the results of a query, decoding each document into T.
+// The underlying mongo cursor is closed as soon as the results are exhausted, an error occurs or the context is done,
+// so calling Close is only required when the caller stops iterating early. Close can safely be called more than once.
+//
+// example:
+//
+//	cursor, err := usersRepo.Iterate(ctx, bson.M{})
+//	if err != nil {
+//		return err
+//	}
+//	defer cursor.Close(ctx)
+//
+//	for cursor.Next(ctx) {
+//		user, err := cursor.Decode()
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(user.Username)
+//	}
+//
+//	return cursor.Err()
+type Cursor[T any] struct {
+	cursor    *mongo.Cursor
+	sentinel  error
+	afterFind bool
+	op        string
+	namespace Namespace
+	ctx       context.Context
+	err       error
+	closed    bool
+}
+
+// NewCursor wraps a mongo cursor so that its documents are decoded into T.
+// When T implements AfterFinder, AfterFind is called on every decoded document.
+func NewCursor[T any](cursor *mongo.Cursor) *Cursor[T] {
+	return newCursor[T](cursor, ErrIterate, true)
+}
+
+func newCursor[T any](cursor *mongo.Cursor, sentinel error, afterFind bool) *Cursor[T] {
+	return &Cursor[T]{
+		cursor:    cursor,
+		sentinel:  sentinel,
+		afterFind: afterFind,
+		ctx:       context.Background(),
+	}
+}
+
+// Next advances the cursor to the next document, and reports whether there is one.
+// Next returns false when the results are exhausted, an error occurred or the context is done, after which Err
+// reports the error, if any.
+func (c *Cursor[T]) Next(ctx context.Context) bool {
+	if c.closed {
+		return false
+	}
+
+	if err := ctx.Err(); err != nil {
+		c.err = c.classify(fmt.Errorf("%w: %w", c.sentinel, err))
+		c.close(ctx)
+		return false
+	}
+
+	if c.cursor.Next(ctx) {
+		c.ctx = ctx
+		return true
+	}
+
+	if err := c.cursor.Err(); err != nil {
+		c.err = c.classify(fmt.Errorf("%w: cursor ended with errors: %w", c.sentinel, err))
+	}
+
+	c.close(ctx)
+	return false
+}
+
+// Decode decodes the current document.
+// AfterFind hooks are called with the context passed to the last call to Next.
+func (c *Cursor[T]) Decode() (T, error) {
+	var value T
+
+	err := c.cursor.Decode(&value)
+	if err != nil {
+		return value, c.classify(fmt.Errorf("%w: failed to decode result: %w", c.sentinel, &decodeError{err}))
+	}
+
+	if c.afterFind {
+		err := afterFind(c.ctx, &value)
+		if err != nil {
+			return value, c.classify(fmt.Errorf("%w: %w", c.sentinel, err))
+		}
+	}
+
+	return value, nil
+}
+
+// classify wraps the error in a *RepoError when the cursor was returned by a repository operation.
+func (c *Cursor[T]) classify(err error) error {
+	if c.op == "" {
+		return err
+	}
+	return NewRepoError(c.op, c.namespace, err)
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (c *Cursor[T]) Err() error {
+	return c.err
+}
+
+// Close closes the underlying mongo cursor.
+func (c *Cursor[T]) Close(ctx context.Context) error {
+	if c.closed {
+		return nil
+	}
+
+	c.closed = true
+
+	err := c.cursor.Close(ctx)
+	if err != nil {
+		return c.classify(fmt.Errorf("%w: failed to close cursor: %w", c.sentinel, err))
+	}
+
+	return nil
+}
+
+// close closes the cursor once iteration has stopped. The context may already be done at this point,
+// which must not prevent the server side cursor from being killed.
+func (c *Cursor[T]) close(ctx context.Context) {
+	err := c.Close(context.WithoutCancel(ctx))
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+}
+
+// All returns an iterator over the remaining documents, for use with range-over-func.
+// A document that fails to decode is yielded with its error and iteration continues;
+// an error that stops the cursor is yielded last. The cursor is closed when the loop ends, including on break.
+//
+// example:
+//
+//	for user, err := range cursor.All(ctx) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(user.Username)
+//	}
+func (c *Cursor[T]) All(ctx context.Context) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		defer c.close(ctx)
+
+		for c.Next(ctx) {
+			if !yield(c.Decode()) {
+				return
+			}
+		}
+
+		if err := c.Err(); err != nil {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
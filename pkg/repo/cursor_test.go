@@ -0,0 +1,175 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type CursorModel struct {
+	ID   primitive.ObjectID `bson:"_id"`
+	Name string             `bson:"name"`
+}
+
+func (c *CursorModel) GetDatabaseName() string {
+	return "cursor_model_db"
+}
+
+func (c *CursorModel) GetCollectionName() string {
+	return "cursor_model_col"
+}
+
+func newTestCursor(t *testing.T, documents ...any) *Cursor[*CursorModel] {
+	cursor, err := mongo.NewCursorFromDocuments(documents, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating cursor: %v", err)
+	}
+	return NewCursor[*CursorModel](cursor)
+}
+
+func TestCursor_Next(t *testing.T) {
+	var firstID = primitive.NewObjectID()
+	var secondID = primitive.NewObjectID()
+
+	var cursor = newTestCursor(t,
+		bson.M{"_id": firstID, "name": "model 1"},
+		bson.M{"_id": secondID, "name": true},
+	)
+
+	var ctx = context.Background()
+
+	if !cursor.Next(ctx) {
+		t.Errorf("Next() = false, want true")
+		return
+	}
+	got, err := cursor.Decode()
+	if err != nil {
+		t.Errorf("Decode() error = %v", err)
+		return
+	}
+	if !reflect.DeepEqual(got, &CursorModel{ID: firstID, Name: "model 1"}) {
+		t.Errorf("Decode() got = %v", got)
+	}
+
+	if !cursor.Next(ctx) {
+		t.Errorf("Next() = false, want true")
+		return
+	}
+	_, err = cursor.Decode()
+	if !errors.Is(err, ErrIterate) {
+		t.Errorf("Decode() error = %v, wantErr %v", err, ErrIterate)
+	}
+
+	if cursor.Next(ctx) {
+		t.Errorf("Next() = true after the last document")
+	}
+	if cursor.Err() != nil {
+		t.Errorf("Err() = %v, want nil", cursor.Err())
+	}
+	if !cursor.closed {
+		t.Errorf("expected the cursor to be closed once exhausted")
+	}
+	if err := cursor.Close(ctx); err != nil {
+		t.Errorf("Close() error = %v, want closing twice to be a no-op", err)
+	}
+}
+
+func TestCursor_NextCancelledContext(t *testing.T) {
+	var cursor = newTestCursor(t, bson.M{"_id": primitive.NewObjectID()})
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	if cursor.Next(ctx) {
+		t.Errorf("Next() = true with a cancelled context")
+	}
+	if !errors.Is(cursor.Err(), context.Canceled) || !errors.Is(cursor.Err(), ErrIterate) {
+		t.Errorf("Err() = %v, want %v", cursor.Err(), context.Canceled)
+	}
+	if !cursor.closed {
+		t.Errorf("expected the cursor to be closed")
+	}
+}
+
+func TestCursor_All(t *testing.T) {
+	var ids = []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()}
+
+	t.Run("should yield every document", func(t *testing.T) {
+		var cursor = newTestCursor(t, bson.M{"_id": ids[0]}, bson.M{"_id": ids[1]}, bson.M{"_id": ids[2]})
+
+		var got []primitive.ObjectID
+		for model, err := range cursor.All(context.Background()) {
+			if err != nil {
+				t.Errorf("All() error = %v", err)
+				return
+			}
+			got = append(got, model.ID)
+		}
+
+		if !reflect.DeepEqual(got, ids) {
+			t.Errorf("All() got = %v, want %v", got, ids)
+		}
+	})
+
+	t.Run("should close the cursor on break", func(t *testing.T) {
+		var cursor = newTestCursor(t, bson.M{"_id": ids[0]}, bson.M{"_id": ids[1]}, bson.M{"_id": ids[2]})
+
+		for range cursor.All(context.Background()) {
+			break
+		}
+
+		if !cursor.closed {
+			t.Errorf("expected the cursor to be closed")
+		}
+	})
+}
+
+func TestStream(t *testing.T) {
+	t.Run("should stop when the cancel channel is closed", func(t *testing.T) {
+		var cursor = newTestCursor(t, bson.M{"_id": primitive.NewObjectID()}, bson.M{"_id": "not an object id"})
+
+		values, errs, cancel := stream(context.Background(), cursor)
+		<-values
+		close(cancel)
+
+		select {
+		case <-errs:
+		case <-time.After(time.Second):
+			t.Errorf("expected the errors channel to be closed")
+		}
+		if !cursor.closed {
+			t.Errorf("expected the cursor to be closed")
+		}
+	})
+
+	t.Run("should stop when the context is done", func(t *testing.T) {
+		var cursor = newTestCursor(t, bson.M{"_id": primitive.NewObjectID()}, bson.M{"_id": primitive.NewObjectID()})
+
+		var ctx, cancel = context.WithCancel(context.Background())
+		values, _, _ := stream(ctx, cursor)
+		<-values
+		cancel()
+
+		select {
+		case <-waitClosed(values):
+		case <-time.After(time.Second):
+			t.Errorf("expected the values channel to be closed")
+		}
+	})
+}
+
+func waitClosed[T any](ch chan T) chan struct{} {
+	var done = make(chan struct{})
+	go func() {
+		for range ch {
+		}
+		close(done)
+	}()
+	return done
+}
@@ -0,0 +1,239 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"regexp"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrorKind classifies the cause of a RepoError.
+type ErrorKind int
+
+const (
+	KindUnknown       ErrorKind = iota // The cause is none of the kinds below.
+	KindNotFound                       // No document matched, see ErrNotFound.
+	KindDuplicateKey                   // A write violated a unique index, see ErrDuplicateKey.
+	KindTimeout                        // The context deadline or a server time limit was exceeded.
+	KindNetwork                        // The connection to the server failed.
+	KindWriteConflict                  // A concurrent write conflicted, including version conflicts of SaveVersioned.
+	KindValidation                     // The document was rejected by a Validator or by the collection validator.
+	KindDecode                         // A document could not be decoded into the model.
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindNotFound:
+		return "NotFound"
+	case KindDuplicateKey:
+		return "DuplicateKey"
+	case KindTimeout:
+		return "Timeout"
+	case KindNetwork:
+		return "Network"
+	case KindWriteConflict:
+		return "WriteConflict"
+	case KindValidation:
+		return "Validation"
+	case KindDecode:
+		return "Decode"
+	}
+	return "Unknown"
+}
+
+// RepoError is the error returned by the methods of Repository. It carries the operation and the namespace it ran on,
+// and classifies its cause, so that callers can tell failures apart without inspecting driver errors:
+//
+//	_, err := usersRepo.InsertOne(ctx, user)
+//	if errors.Is(err, repo.ErrDuplicateKey) {
+//		// the email is taken
+//	}
+//
+//	var repoErr *repo.RepoError
+//	if errors.As(err, &repoErr) && repoErr.Kind == repo.KindTimeout {
+//		// retry later
+//	}
+//
+// The message is the message of the cause, and the cause still matches the sentinel of the operation,
+// e.g. ErrFindOne, and the driver errors it wraps, e.g. mongo.ErrNoDocuments.
+type RepoError struct {
+	Op         string    // The method that failed, e.g. "FindOne".
+	Database   string    // The database of the operation.
+	Collection string    // The collection of the operation.
+	Kind       ErrorKind // The kind of the cause.
+	Err        error     // The cause.
+
+	// Index and KeyValue are the name of the unique index and the key values that collided, for KindDuplicateKey,
+	// when the server reports them.
+	Index    string
+	KeyValue bson.D
+}
+
+func (e *RepoError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RepoError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches ErrNotFound and ErrDuplicateKey by kind.
+func (e *RepoError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Kind == KindNotFound
+	case ErrDuplicateKey:
+		return e.Kind == KindDuplicateKey
+	}
+	return false
+}
+
+// decodeError marks the errors of decoding documents into models, so that they are classified as KindDecode.
+type decodeError struct {
+	err error
+}
+
+func (e *decodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *decodeError) Unwrap() error {
+	return e.err
+}
+
+// classify wraps the error of an operation in a *RepoError, unless it is nil or already one.
+func (r *Repository[M, I]) classify(ctx context.Context, op string, err error) error {
+	var repoErr *RepoError
+	if err == nil || errors.As(err, &repoErr) {
+		return err
+	}
+
+	return NewRepoError(op, r.operationNamespace(ctx), err)
+}
+
+// operationNamespace returns the namespace of an operation, or the namespace of the model when the tenant of
+// the context cannot be resolved.
+func (r *Repository[M, I]) operationNamespace(ctx context.Context) Namespace {
+	namespace, err := r.namespace(ctx)
+	if err != nil {
+		return Namespace{Database: r.databaseName, Collection: r.collectionName}
+	}
+	return namespace
+}
+
+// NewRepoError classifies the error of an operation on a namespace. It is meant for implementations of Store that
+// return the same errors as Repository.
+func NewRepoError(op string, namespace Namespace, err error) *RepoError {
+	var repoErr = &RepoError{
+		Op:         op,
+		Database:   namespace.Database,
+		Collection: namespace.Collection,
+		Kind:       errorKind(err),
+		Err:        err,
+	}
+	if repoErr.Kind == KindDuplicateKey {
+		repoErr.Index, repoErr.KeyValue = duplicateKey(err)
+	}
+	return repoErr
+}
+
+// server error codes, see https://www.mongodb.com/docs/manual/reference/error-codes/
+const (
+	codeWriteConflict             = 112
+	codeDocumentValidationFailure = 121
+)
+
+func errorKind(err error) ErrorKind {
+	var decodeErr *decodeError
+	var serverErr mongo.ServerError
+
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return KindNotFound
+	case inTree(err, mongo.IsDuplicateKeyError):
+		return KindDuplicateKey
+	case errors.As(err, &decodeErr):
+		return KindDecode
+	case errors.Is(err, ErrValidation),
+		errors.As(err, &serverErr) && serverErr.HasErrorCode(codeDocumentValidationFailure):
+		return KindValidation
+	case errors.Is(err, ErrVersionConflict),
+		errors.As(err, &serverErr) && serverErr.HasErrorCode(codeWriteConflict):
+		return KindWriteConflict
+	case inTree(err, mongo.IsTimeout):
+		return KindTimeout
+	case inTree(err, mongo.IsNetworkError):
+		return KindNetwork
+	}
+	return KindUnknown
+}
+
+// inTree reports whether match holds for any error in err's tree. The predicates of the driver only follow
+// Unwrap() error, while the errors of this package also wrap the operation sentinel.
+func inTree(err error, match func(error) bool) bool {
+	if err == nil {
+		return false
+	}
+	if match(err) {
+		return true
+	}
+
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		return inTree(e.Unwrap(), match)
+	case interface{ Unwrap() []error }:
+		for _, err := range e.Unwrap() {
+			if inTree(err, match) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var duplicateKeyIndex = regexp.MustCompile(`index: (\S+)`)
+
+// duplicateKey returns the index and the key values reported by the first duplicate key error in err's tree.
+func duplicateKey(err error) (string, bson.D) {
+	var message string
+	var raw bson.Raw
+
+	var writeErr mongo.WriteException
+	var bulkErr mongo.BulkWriteException
+	var commandErr mongo.CommandError
+	var singleErr mongo.WriteError
+	switch {
+	case errors.As(err, &singleErr):
+		message, raw = singleErr.Message, singleErr.Raw
+	case errors.As(err, &writeErr):
+		for _, e := range writeErr.WriteErrors {
+			if mongo.IsDuplicateKeyError(e) {
+				message, raw = e.Message, e.Raw
+				break
+			}
+		}
+	case errors.As(err, &bulkErr):
+		for _, e := range bulkErr.WriteErrors {
+			if mongo.IsDuplicateKeyError(e.WriteError) {
+				message, raw = e.Message, e.Raw
+				break
+			}
+		}
+	case errors.As(err, &commandErr):
+		message, raw = commandErr.Message, commandErr.Raw
+	}
+
+	var index string
+	if match := duplicateKeyIndex.FindStringSubmatch(message); match != nil {
+		index = match[1]
+	}
+
+	var keyValue bson.D
+	if value, lookupErr := raw.LookupErr("keyValue"); lookupErr == nil {
+		_ = value.Unmarshal(&keyValue)
+	}
+
+	return index, keyValue
+}
@@ -0,0 +1,207 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ErrorModel struct {
+	ID    primitive.ObjectID `bson:"_id"`
+	Email string             `bson:"email"`
+}
+
+func (e *ErrorModel) GetDatabaseName() string {
+	return "error_model_db"
+}
+
+func (e *ErrorModel) GetCollectionName() string {
+	return "error_model_col"
+}
+
+func (e *ErrorModel) Indexes() []IndexSpec {
+	return []IndexSpec{{Keys: bson.D{{Key: "email", Value: 1}}, Unique: true}}
+}
+
+func duplicateKeyException() mongo.WriteException {
+	raw, _ := bson.Marshal(bson.D{
+		{Key: "index", Value: 0},
+		{Key: "code", Value: 11000},
+		{Key: "keyPattern", Value: bson.D{{Key: "email", Value: 1}}},
+		{Key: "keyValue", Value: bson.D{{Key: "email", Value: "alice@example.com"}}},
+	})
+	return mongo.WriteException{WriteErrors: mongo.WriteErrors{{
+		Code:    11000,
+		Message: `E11000 duplicate key error collection: db.col index: email_1 dup key: { email: "alice@example.com" }`,
+		Raw:     raw,
+	}}}
+}
+
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorKind
+	}{
+		{
+			name: "not found",
+			err:  fmt.Errorf("%w: %w", ErrFindOne, mongo.ErrNoDocuments),
+			want: KindNotFound,
+		},
+		{
+			name: "duplicate key",
+			err:  fmt.Errorf("%w: %w", ErrInsertOne, duplicateKeyException()),
+			want: KindDuplicateKey,
+		},
+		{
+			name: "deadline",
+			err:  fmt.Errorf("%w: %w", ErrFind, context.DeadlineExceeded),
+			want: KindTimeout,
+		},
+		{
+			name: "network",
+			err:  fmt.Errorf("%w: %w", ErrFind, mongo.CommandError{Labels: []string{"NetworkError"}}),
+			want: KindNetwork,
+		},
+		{
+			name: "write conflict",
+			err:  fmt.Errorf("%w: %w", ErrUpdateOne, mongo.CommandError{Code: 112, Name: "WriteConflict"}),
+			want: KindWriteConflict,
+		},
+		{
+			name: "version conflict",
+			err:  fmt.Errorf("%w: %w", ErrSaveVersioned, &VersionConflictError{}),
+			want: KindWriteConflict,
+		},
+		{
+			name: "validator",
+			err:  fmt.Errorf("%w: %w: name is required", ErrInsertOne, ErrValidation),
+			want: KindValidation,
+		},
+		{
+			name: "collection validator",
+			err:  fmt.Errorf("%w: %w", ErrInsertOne, mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 121}}}),
+			want: KindValidation,
+		},
+		{
+			name: "decode",
+			err:  fmt.Errorf("%w: failed to decode result: %w", ErrFindOne, &decodeError{errors.New("cannot decode string")}),
+			want: KindDecode,
+		},
+		{
+			name: "unknown",
+			err:  fmt.Errorf("%w: %w", ErrFindOne, ErrNoTenant),
+			want: KindUnknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorKind(tt.err); got != tt.want {
+				t.Errorf("errorKind() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepository_classify(t *testing.T) {
+	var repository = NewRepository[*ErrorModel, primitive.ObjectID](nil)
+	var cause = fmt.Errorf("%w: %w", ErrInsertOne, duplicateKeyException())
+
+	err := repository.classify(context.Background(), "InsertOne", cause)
+
+	var repoErr *RepoError
+	if !errors.As(err, &repoErr) {
+		t.Fatalf("classify() = %T, want *RepoError", err)
+	}
+
+	var want = &RepoError{
+		Op:         "InsertOne",
+		Database:   "error_model_db",
+		Collection: "error_model_col",
+		Kind:       KindDuplicateKey,
+		Err:        cause,
+		Index:      "email_1",
+		KeyValue:   bson.D{{Key: "email", Value: "alice@example.com"}},
+	}
+	if !reflect.DeepEqual(repoErr, want) {
+		t.Errorf("classify() = %+v, want %+v", repoErr, want)
+	}
+
+	if err.Error() != cause.Error() {
+		t.Errorf("Error() = %s, want %s", err, cause)
+	}
+	if !errors.Is(err, ErrDuplicateKey) || !errors.Is(err, ErrInsertOne) || errors.Is(err, ErrNotFound) {
+		t.Errorf("classify() = %v does not match its sentinels", err)
+	}
+
+	if again := repository.classify(context.Background(), "InsertOne", err); again != err {
+		t.Errorf("classify() wrapped a *RepoError again")
+	}
+	if repository.classify(context.Background(), "InsertOne", nil) != nil {
+		t.Errorf("classify() of nil is not nil")
+	}
+}
+
+func TestRepository_Errors(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var repository = NewRepository[*ErrorModel, primitive.ObjectID](mongoClient)
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		err := mongoClient.Database("error_model_db").Collection("error_model_col").Drop(context.Background())
+		if err != nil {
+			t.Errorf("error dropping collection: %v", err)
+		}
+	}()
+
+	_, err = repository.EnsureIndexes(ctx)
+	if err != nil {
+		t.Errorf("EnsureIndexes() error = %v", err)
+		return
+	}
+
+	_, err = repository.FindOne(ctx, bson.M{"email": "alice@example.com"})
+	if !errors.Is(err, ErrNotFound) || !errors.Is(err, ErrFindOne) || !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("FindOne() error = %v, want %v", err, ErrNotFound)
+	}
+
+	_, err = repository.InsertOne(ctx, &ErrorModel{ID: primitive.NewObjectID(), Email: "alice@example.com"})
+	if err != nil {
+		t.Errorf("InsertOne() error = %v", err)
+		return
+	}
+
+	_, err = repository.InsertOne(ctx, &ErrorModel{ID: primitive.NewObjectID(), Email: "alice@example.com"})
+
+	var repoErr *RepoError
+	if !errors.Is(err, ErrDuplicateKey) || !errors.As(err, &repoErr) {
+		t.Errorf("InsertOne() error = %v, want %v", err, ErrDuplicateKey)
+		return
+	}
+	if repoErr.Op != "InsertOne" || repoErr.Index != "email_1" ||
+		!reflect.DeepEqual(repoErr.KeyValue, bson.D{{Key: "email", Value: "alice@example.com"}}) {
+		t.Errorf("InsertOne() error = %+v, want the email_1 index and key", repoErr)
+	}
+}
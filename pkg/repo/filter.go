@@ -0,0 +1,23 @@
+package repo
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// andFilters combines filters with $and, skipping nil ones.
+// A single remaining filter is returned as is.
+func andFilters(filters ...any) any {
+	var clauses bson.A
+	for _, f := range filters {
+		if f != nil {
+			clauses = append(clauses, f)
+		}
+	}
+
+	switch len(clauses) {
+	case 0:
+		return bson.D{}
+	case 1:
+		return clauses[0]
+	}
+
+	return bson.D{{Key: "$and", Value: clauses}}
+}
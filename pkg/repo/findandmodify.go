@@ -0,0 +1,306 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/AISystemsInc/mongo-resource-repo/pkg/repo/internal/meta"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindOneAndUpdate updates the first document that matches the filter, in the order of the Sort option, and returns
+// it. Like UpdateOne, it calls the BeforeUpdate hook and sets the updatedAt timestamp.
+// It returns the document as it was before the update, unless ReturnDocument is options.After, and an error wrapping
+// ErrNotFound when no document matches, which includes upserts returning the document before the update.
+// Soft deleted documents are not matched, and the returned document goes through the AfterFind hook.
+//
+// example, claiming the next job of a queue:
+//
+//	job, err := jobsRepo.FindOneAndUpdate(ctx,
+//		bson.M{"status": "pending"},
+//		bson.M{"$set": bson.M{"status": "running"}},
+//		options.FindOneAndUpdate().SetSort(bson.D{{Key: "createdAt", Value: 1}}).SetReturnDocument(options.After),
+//	)
+func (r *Repository[M, I]) FindOneAndUpdate(
+	ctx context.Context,
+	filter any,
+	update any,
+	opts ...*options.FindOneAndUpdateOptions,
+) (M, error) {
+	ctx, span := r.startSpan(ctx, "FindOneAndUpdate", filter)
+	value, err := r.findOneAndUpdate(ctx, filter, update, opts...)
+	err = r.classify(ctx, "FindOneAndUpdate", err)
+	span.end(err, returnedKey.Int(single(err)))
+	return value, err
+}
+
+func (r *Repository[M, I]) findOneAndUpdate(
+	ctx context.Context,
+	filter any,
+	update any,
+	opts ...*options.FindOneAndUpdateOptions,
+) (M, error) {
+	var value M
+
+	err := beforeUpdate[M](ctx, filter, update)
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOneAndUpdate, err)
+	}
+
+	o := options.MergeFindOneAndUpdateOptions(opts...)
+	update, err = r.stampUpdate(update, &options.UpdateOptions{Upsert: o.Upsert})
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOneAndUpdate, err)
+	}
+
+	filter, err = r.scoped(ctx, r.visible(filter))
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOneAndUpdate, err)
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOneAndUpdate, err)
+	}
+
+	value, err = r.decodeModified(ctx, collection.FindOneAndUpdate(
+		ctx,
+		filter,
+		update,
+		opts...,
+	))
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOneAndUpdate, err)
+	}
+
+	return value, nil
+}
+
+// FindOneAndReplace replaces the first document that matches the filter, in the order of the Sort option, and
+// returns it. Like SaveVersioned, the replacement is validated, its updatedAt timestamp is set, it is stamped with the
+// scope of the context and the BeforeUpdate hook is called with it as the update. The createdAt timestamp of the
+// stored document is kept, and set on upserts. The document is returned like FindOneAndUpdate does.
+func (r *Repository[M, I]) FindOneAndReplace(
+	ctx context.Context,
+	filter any,
+	replacement M,
+	opts ...*options.FindOneAndReplaceOptions,
+) (M, error) {
+	ctx, span := r.startSpan(ctx, "FindOneAndReplace", filter)
+	value, err := r.findOneAndReplace(ctx, filter, replacement, opts...)
+	err = r.classify(ctx, "FindOneAndReplace", err)
+	span.end(err, returnedKey.Int(single(err)))
+	return value, err
+}
+
+func (r *Repository[M, I]) findOneAndReplace(
+	ctx context.Context,
+	filter any,
+	replacement M,
+	opts ...*options.FindOneAndReplaceOptions,
+) (M, error) {
+	var value M
+
+	var m = meta.For[M]()
+	if m.Err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOneAndReplace, m.Err)
+	}
+
+	if v, ok := hook[Validator](&replacement); ok {
+		if err := v.Validate(); err != nil {
+			return value, fmt.Errorf("%w: %w: %w", ErrFindOneAndReplace, ErrValidation, err)
+		}
+	}
+
+	err := r.stampScope(ctx, &replacement)
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOneAndReplace, err)
+	}
+
+	stamped, err := m.StampReplace(&replacement, r.settings.now())
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOneAndReplace, err)
+	}
+
+	err = beforeUpdate[M](ctx, filter, stamped)
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOneAndReplace, err)
+	}
+
+	filter, err = r.scoped(ctx, r.visible(filter))
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOneAndReplace, err)
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOneAndReplace, err)
+	}
+
+	// models with a createdAt field are replaced by an update pipeline, which keeps the stored createdAt.
+	var result *mongo.SingleResult
+	if pipeline, ok := stamped.(mongo.Pipeline); ok {
+		result = collection.FindOneAndUpdate(ctx, filter, pipeline, replaceUpdateOptions(opts...))
+	} else {
+		result = collection.FindOneAndReplace(ctx, filter, stamped, opts...)
+	}
+
+	value, err = r.decodeModified(ctx, result)
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOneAndReplace, err)
+	}
+
+	return value, nil
+}
+
+// replaceUpdateOptions returns the options of a FindOneAndUpdate sending a FindOneAndReplace as an update pipeline.
+func replaceUpdateOptions(opts ...*options.FindOneAndReplaceOptions) *options.FindOneAndUpdateOptions {
+	o := options.MergeFindOneAndReplaceOptions(opts...)
+	return &options.FindOneAndUpdateOptions{
+		BypassDocumentValidation: o.BypassDocumentValidation,
+		Collation:                o.Collation,
+		Comment:                  o.Comment,
+		MaxTime:                  o.MaxTime,
+		Projection:               o.Projection,
+		ReturnDocument:           o.ReturnDocument,
+		Sort:                     o.Sort,
+		Upsert:                   o.Upsert,
+		Hint:                     o.Hint,
+		Let:                      o.Let,
+	}
+}
+
+// FindOneAndDelete deletes the first document that matches the filter, in the order of the Sort option, and returns
+// it as it was before. Like DeleteOne, it calls the BeforeDelete hook, and soft deletes models that support it.
+// It returns an error wrapping ErrNotFound when no document matches.
+func (r *Repository[M, I]) FindOneAndDelete(
+	ctx context.Context,
+	filter any,
+	opts ...*options.FindOneAndDeleteOptions,
+) (M, error) {
+	ctx, span := r.startSpan(ctx, "FindOneAndDelete", filter)
+	value, err := r.findOneAndDelete(ctx, filter, opts...)
+	err = r.classify(ctx, "FindOneAndDelete", err)
+	span.end(err, returnedKey.Int(single(err)))
+	return value, err
+}
+
+func (r *Repository[M, I]) findOneAndDelete(
+	ctx context.Context,
+	filter any,
+	opts ...*options.FindOneAndDeleteOptions,
+) (M, error) {
+	var value M
+
+	filter, err := r.scoped(ctx, r.visible(filter))
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOneAndDelete, err)
+	}
+
+	o := options.MergeFindOneAndDeleteOptions(opts...)
+
+	// the hook is called on the document the sort selects, which is then deleted by _id.
+	var findOptions = options.Find().SetLimit(1)
+	if o.Sort != nil {
+		findOptions.SetSort(o.Sort)
+	}
+	if o.Collation != nil {
+		findOptions.SetCollation(o.Collation)
+	}
+	if o.Hint != nil {
+		findOptions.SetHint(o.Hint)
+	}
+
+	filter, err = r.callBeforeDelete(ctx, filter, findOptions)
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOneAndDelete, err)
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOneAndDelete, err)
+	}
+
+	var result *mongo.SingleResult
+	if m := meta.For[M](); m.SoftDelete() {
+		var now = r.settings.now()
+		update, err := m.StampUpdate(m.DeleteUpdate(now), now, false)
+		if err != nil {
+			return value, fmt.Errorf("%w: %w", ErrFindOneAndDelete, err)
+		}
+
+		var updateOptions = options.FindOneAndUpdate().SetReturnDocument(options.Before)
+		if o.Sort != nil {
+			updateOptions.SetSort(o.Sort)
+		}
+		if o.Projection != nil {
+			updateOptions.SetProjection(o.Projection)
+		}
+		if o.Collation != nil {
+			updateOptions.SetCollation(o.Collation)
+		}
+		if o.Hint != nil {
+			updateOptions.SetHint(o.Hint)
+		}
+		if o.MaxTime != nil {
+			updateOptions.SetMaxTime(*o.MaxTime)
+		}
+		if o.Comment != nil {
+			updateOptions.SetComment(o.Comment)
+		}
+		if o.Let != nil {
+			updateOptions.SetLet(o.Let)
+		}
+
+		result = collection.FindOneAndUpdate(ctx, filter, update, updateOptions)
+	} else {
+		result = collection.FindOneAndDelete(ctx, filter, opts...)
+	}
+
+	value, err = r.decodeModified(ctx, result)
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOneAndDelete, err)
+	}
+
+	return value, nil
+}
+
+// decodeModified decodes the document returned by a FindOneAnd operation and calls the AfterFind hook.
+func (r *Repository[M, I]) decodeModified(ctx context.Context, result *mongo.SingleResult) (M, error) {
+	var value M
+
+	if result.Err() != nil {
+		return value, result.Err()
+	}
+
+	err := result.Decode(&value)
+	if err != nil {
+		return value, fmt.Errorf("failed to decode result: %w", &decodeError{err})
+	}
+
+	err = afterFind(ctx, &value)
+	if err != nil {
+		return value, err
+	}
+
+	return value, nil
+}
+
+// modelID returns the _id of a document, and whether it has one.
+func modelID[I any, M any](document M) (I, bool) {
+	var id I
+
+	raw, err := bson.Marshal(document)
+	if err != nil {
+		return id, false
+	}
+
+	value, err := bson.Raw(raw).LookupErr("_id")
+	if err != nil || value.Unmarshal(&id) != nil {
+		return id, false
+	}
+
+	return id, true
+}
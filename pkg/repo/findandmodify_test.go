@@ -0,0 +1,151 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type JobModel struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Status    string             `bson:"status"`
+	Priority  int                `bson:"priority"`
+	CreatedAt time.Time          `bson:"createdAt" repo:"createdAt"`
+}
+
+func (j *JobModel) GetDatabaseName() string {
+	return "job_model_db"
+}
+
+func (j *JobModel) GetCollectionName() string {
+	return "job_model_col"
+}
+
+func TestModelID(t *testing.T) {
+	var id = primitive.NewObjectID()
+
+	tests := []struct {
+		name     string
+		document *JobModel
+		want     primitive.ObjectID
+		wantOK   bool
+	}{
+		{
+			name:     "with ID",
+			document: &JobModel{ID: id, Status: "pending"},
+			want:     id,
+			wantOK:   true,
+		},
+		{
+			name:     "projected out",
+			document: &JobModel{Status: "pending"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := modelID[primitive.ObjectID](tt.document)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("modelID() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRepository_FindOneAnd(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var repository = NewRepository[*JobModel, primitive.ObjectID](mongoClient)
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		err := mongoClient.Database("job_model_db").Collection("job_model_col").Drop(context.Background())
+		if err != nil {
+			t.Errorf("error dropping collection: %v", err)
+		}
+	}()
+
+	_, err = repository.InsertMany(ctx, []*JobModel{
+		{Status: "pending", Priority: 1},
+		{Status: "pending", Priority: 3},
+		{Status: "pending", Priority: 2},
+	})
+	if err != nil {
+		t.Errorf("InsertMany() error = %v", err)
+		return
+	}
+
+	claimed, err := repository.FindOneAndUpdate(ctx,
+		bson.M{"status": "pending"},
+		bson.M{"$set": bson.M{"status": "running"}},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "priority", Value: -1}}).SetReturnDocument(options.After),
+	)
+	if err != nil || claimed.Priority != 3 || claimed.Status != "running" {
+		t.Errorf("FindOneAndUpdate() = %+v, %v, want the running job of priority 3", claimed, err)
+	}
+
+	before, err := repository.FindOneAndUpdate(ctx,
+		bson.M{"_id": claimed.ID},
+		bson.M{"$set": bson.M{"status": "done"}},
+	)
+	if err != nil || before.Status != "running" {
+		t.Errorf("FindOneAndUpdate() = %+v, %v, want the job before the update", before, err)
+	}
+
+	_, err = repository.FindOneAndUpdate(ctx, bson.M{"status": "failed"}, bson.M{"$set": bson.M{"status": "done"}})
+	if !errors.Is(err, ErrFindOneAndUpdate) || !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindOneAndUpdate() error = %v, want %v", err, ErrNotFound)
+	}
+
+	replaced, err := repository.FindOneAndReplace(ctx,
+		bson.M{"status": "archived"},
+		&JobModel{Status: "archived", Priority: 9},
+		options.FindOneAndReplace().SetUpsert(true).SetReturnDocument(options.After),
+	)
+	if err != nil || replaced.ID.IsZero() || replaced.Priority != 9 {
+		t.Errorf("FindOneAndReplace() = %+v, %v, want the upserted job", replaced, err)
+	}
+	if replaced.CreatedAt.IsZero() {
+		t.Errorf("FindOneAndReplace() createdAt is zero, want it set by the upsert")
+	}
+
+	again, err := repository.FindOneAndReplace(ctx,
+		bson.M{"_id": replaced.ID},
+		&JobModel{ID: replaced.ID, Status: "archived", Priority: 10},
+		options.FindOneAndReplace().SetReturnDocument(options.After),
+	)
+	if err != nil || again.Priority != 10 || !again.CreatedAt.Equal(replaced.CreatedAt) {
+		t.Errorf("FindOneAndReplace() = %+v, %v, want createdAt %v kept", again, err, replaced.CreatedAt)
+	}
+
+	deleted, err := repository.FindOneAndDelete(ctx,
+		bson.M{"status": "pending"},
+		options.FindOneAndDelete().SetSort(bson.D{{Key: "priority", Value: 1}}).SetProjection(bson.D{{Key: "priority", Value: 1}}),
+	)
+	if err != nil || deleted.Priority != 1 || deleted.Status != "" {
+		t.Errorf("FindOneAndDelete() = %+v, %v, want the projected job of priority 1", deleted, err)
+	}
+
+	count, err := repository.Count(ctx, bson.M{"status": "pending"})
+	if err != nil || count != 1 {
+		t.Errorf("Count() = %d, %v, want 1", count, err)
+	}
+}
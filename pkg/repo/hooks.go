@@ -0,0 +1,179 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BeforeInserter is implemented by models that need to run code before they are inserted, e.g. to set defaults.
+type BeforeInserter interface {
+	BeforeInsert(ctx context.Context) error
+}
+
+// AfterInserter is implemented by models that need to run code after they are inserted.
+type AfterInserter interface {
+	AfterInsert(ctx context.Context) error
+}
+
+// AfterFinder is implemented by models that need to run code after they are loaded, e.g. to normalize fields.
+type AfterFinder interface {
+	AfterFind(ctx context.Context) error
+}
+
+// BeforeUpdater is implemented by models that need to inspect, or reject, an update before it is sent.
+// Updates are applied by the server, so BeforeUpdate is called on a new, empty model rather than on the documents
+// being updated.
+type BeforeUpdater interface {
+	BeforeUpdate(ctx context.Context, filter any, update any) error
+}
+
+// BeforeDeleter is implemented by models that need to run code before they are deleted.
+// The matching documents are loaded so that BeforeDelete can be called on each of them, which costs an extra query
+// per delete, and only the documents it was called on are deleted.
+type BeforeDeleter interface {
+	BeforeDelete(ctx context.Context) error
+}
+
+// Validator is implemented by models that must be valid to be inserted. Validate is called after BeforeInsert.
+type Validator interface {
+	Validate() error
+}
+
+// hook returns the model as T when either the model or a pointer to it implements T,
+// so that hooks with pointer receivers also run for models used by value.
+func hook[T any, M any](value *M) (T, bool) {
+	if h, ok := any(*value).(T); ok {
+		return h, true
+	}
+	h, ok := any(value).(T)
+	return h, ok
+}
+
+// newModel returns an empty model, allocating it when the model is a pointer.
+func newModel[M any]() M {
+	var value M
+	if t := reflect.TypeOf(value); t != nil && t.Kind() == reflect.Pointer {
+		return reflect.New(t.Elem()).Interface().(M)
+	}
+	return value
+}
+
+func beforeInsert[M any](ctx context.Context, document *M) error {
+	if h, ok := hook[BeforeInserter](document); ok {
+		if err := h.BeforeInsert(ctx); err != nil {
+			return fmt.Errorf("%w: BeforeInsert: %w", ErrHook, err)
+		}
+	}
+
+	if v, ok := hook[Validator](document); ok {
+		if err := v.Validate(); err != nil {
+			return fmt.Errorf("%w: %w", ErrValidation, err)
+		}
+	}
+
+	return nil
+}
+
+func afterInsert[M any](ctx context.Context, document *M) error {
+	if h, ok := hook[AfterInserter](document); ok {
+		if err := h.AfterInsert(ctx); err != nil {
+			return fmt.Errorf("%w: AfterInsert: %w", ErrHook, err)
+		}
+	}
+	return nil
+}
+
+func afterFind[M any](ctx context.Context, document *M) error {
+	if h, ok := hook[AfterFinder](document); ok {
+		if err := h.AfterFind(ctx); err != nil {
+			return fmt.Errorf("%w: AfterFind: %w", ErrHook, err)
+		}
+	}
+	return nil
+}
+
+func beforeUpdate[M any](ctx context.Context, filter any, update any) error {
+	var model = newModel[M]()
+	if h, ok := hook[BeforeUpdater](&model); ok {
+		if err := h.BeforeUpdate(ctx, filter, update); err != nil {
+			return fmt.Errorf("%w: BeforeUpdate: %w", ErrHook, err)
+		}
+	}
+	return nil
+}
+
+// beforeDelete calls BeforeDelete on the documents that match the filter, when the model implements BeforeDeleter.
+// It returns the filter to delete with: the given one when there is no hook, otherwise one matching the _id of the
+// documents the hook was called on, so that documents matching the filter in the meantime are not deleted unchecked.
+func (r *Repository[M, I]) beforeDelete(
+	ctx context.Context,
+	filter any,
+	many bool,
+	opts ...*options.DeleteOptions,
+) (any, error) {
+	var findOptions = options.Find()
+	if !many {
+		findOptions.SetLimit(1)
+	}
+
+	o := options.MergeDeleteOptions(opts...)
+	if o.Collation != nil {
+		findOptions.SetCollation(o.Collation)
+	}
+	if o.Hint != nil {
+		findOptions.SetHint(o.Hint)
+	}
+
+	return r.callBeforeDelete(ctx, filter, findOptions)
+}
+
+// callBeforeDelete calls BeforeDelete on the documents found with the filter and options, and returns a filter
+// matching their _id, or the given filter when there is no hook.
+func (r *Repository[M, I]) callBeforeDelete(ctx context.Context, filter any, findOptions *options.FindOptions) (any, error) {
+	var model = newModel[M]()
+	if _, ok := hook[BeforeDeleter](&model); !ok {
+		return filter, nil
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := collection.Find(
+		ctx,
+		filter,
+		findOptions,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var ids = bson.A{}
+	for cursor.Next(ctx) {
+		var value M
+		err := cursor.Decode(&value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode result: %w", err)
+		}
+
+		if h, ok := hook[BeforeDeleter](&value); ok {
+			if err := h.BeforeDelete(ctx); err != nil {
+				return nil, fmt.Errorf("%w: BeforeDelete: %w", ErrHook, err)
+			}
+		}
+
+		ids = append(ids, cursor.Current.Lookup("_id"))
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}, nil
+}
@@ -0,0 +1,118 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type HookModel struct {
+	Name  string `bson:"name"`
+	calls []string
+}
+
+func (m *HookModel) GetDatabaseName() string {
+	return "hook_db"
+}
+
+func (m *HookModel) GetCollectionName() string {
+	return "hook_col"
+}
+
+func (m *HookModel) BeforeInsert(ctx context.Context) error {
+	m.calls = append(m.calls, "BeforeInsert")
+	if m.Name == "" {
+		m.Name = "default"
+	}
+	return nil
+}
+
+func (m *HookModel) Validate() error {
+	m.calls = append(m.calls, "Validate")
+	if m.Name == "invalid" {
+		return errors.New("name is invalid")
+	}
+	return nil
+}
+
+func (m *HookModel) BeforeUpdate(ctx context.Context, filter any, update any) error {
+	if update == nil {
+		return errors.New("update is required")
+	}
+	return nil
+}
+
+// ValueHookModel implements AfterFind with a pointer receiver but is used by value.
+type ValueHookModel struct {
+	Name string `bson:"name"`
+}
+
+func (m ValueHookModel) GetDatabaseName() string {
+	return "hook_db"
+}
+
+func (m ValueHookModel) GetCollectionName() string {
+	return "hook_col"
+}
+
+func (m *ValueHookModel) AfterFind(ctx context.Context) error {
+	if m.Name == "" {
+		return errors.New("name is empty")
+	}
+	m.Name = "found " + m.Name
+	return nil
+}
+
+func TestBeforeInsert(t *testing.T) {
+	var model = &HookModel{}
+	err := beforeInsert(context.Background(), &model)
+	if err != nil {
+		t.Fatalf("beforeInsert() error = %v", err)
+	}
+	if model.Name != "default" {
+		t.Errorf("beforeInsert() name = %q, want %q", model.Name, "default")
+	}
+	if len(model.calls) != 2 || model.calls[0] != "BeforeInsert" || model.calls[1] != "Validate" {
+		t.Errorf("beforeInsert() calls = %v, want [BeforeInsert Validate]", model.calls)
+	}
+
+	model = &HookModel{Name: "invalid"}
+	err = beforeInsert(context.Background(), &model)
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("beforeInsert() error = %v, want %v", err, ErrValidation)
+	}
+}
+
+func TestAfterFind(t *testing.T) {
+	var model = ValueHookModel{Name: "apple"}
+	err := afterFind(context.Background(), &model)
+	if err != nil {
+		t.Fatalf("afterFind() error = %v", err)
+	}
+	if model.Name != "found apple" {
+		t.Errorf("afterFind() name = %q, want %q", model.Name, "found apple")
+	}
+
+	model = ValueHookModel{}
+	err = afterFind(context.Background(), &model)
+	if !errors.Is(err, ErrHook) {
+		t.Errorf("afterFind() error = %v, want %v", err, ErrHook)
+	}
+}
+
+func TestBeforeUpdate(t *testing.T) {
+	err := beforeUpdate[*HookModel](context.Background(), nil, nil)
+	if !errors.Is(err, ErrHook) {
+		t.Errorf("beforeUpdate() error = %v, want %v", err, ErrHook)
+	}
+
+	err = beforeUpdate[*HookModel](context.Background(), nil, map[string]any{"$set": map[string]any{"name": "x"}})
+	if err != nil {
+		t.Errorf("beforeUpdate() error = %v", err)
+	}
+
+	err = beforeUpdate[*CursorModel](context.Background(), nil, nil)
+	if err != nil {
+		t.Errorf("beforeUpdate() on a model without hooks error = %v", err)
+	}
+}
@@ -0,0 +1,445 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Indexed is implemented by models that declare the indexes of their collection, for EnsureIndexes.
+//
+// example:
+//
+//	func (u *User) Indexes() []repo.IndexSpec {
+//		return []repo.IndexSpec{
+//			{Keys: bson.D{{Key: "email", Value: 1}}, Unique: true},
+//			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, ExpireAfter: time.Hour},
+//			{Keys: bson.D{{Key: "deleteAt", Value: 1}}, TTL: true}, // expires at the date in deleteAt
+//		}
+//	}
+type Indexed interface {
+	Indexes() []IndexSpec
+}
+
+// IndexSpec declares an index.
+type IndexSpec struct {
+	Keys          bson.D             // The indexed fields and their direction or type, e.g. {email: 1} or {bio: "text"}.
+	Name          string             // Defaults to the name the server generates, e.g. "email_1".
+	Unique        bool               // Whether the index rejects duplicate keys.
+	Sparse        bool               // Whether the index skips documents without the indexed fields.
+	PartialFilter bson.D             // Only documents matching the filter are indexed.
+	ExpireAfter   time.Duration      // Documents are removed this long after the date in the indexed field (TTL index).
+	TTL           bool               // Whether the index is a TTL index, implied by a positive ExpireAfter.
+	Collation     *options.Collation // The collation of the index.
+}
+
+// isTTL reports whether the index is a TTL index. TTL with a zero ExpireAfter expires documents at the date in the
+// indexed field.
+func (s IndexSpec) isTTL() bool {
+	return s.TTL || s.ExpireAfter > 0
+}
+
+// IndexName returns the name of the index.
+func (s IndexSpec) IndexName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+
+	var parts = make([]string, 0, len(s.Keys)*2)
+	for _, k := range s.Keys {
+		parts = append(parts, k.Key, fmt.Sprint(normalizeKeyValue(k.Value)))
+	}
+	return strings.Join(parts, "_")
+}
+
+// IndexPlan is the difference between the declared indexes of a model and the indexes of its collection.
+type IndexPlan struct {
+	Namespace string          // The database and collection, e.g. "users_db.users_col".
+	Create    []IndexSpec     // Declared indexes missing from the collection, which EnsureIndexes creates.
+	Extra     []IndexSpec     // Indexes of the collection that are not declared, other than the _id index.
+	Conflicts []IndexConflict // Declared indexes that differ from an existing index with the same name or keys.
+}
+
+// IndexConflict is a declared index that differs from an existing one. EnsureIndexes does not change
+// conflicting indexes, since that requires dropping the existing index.
+type IndexConflict struct {
+	Declared IndexSpec
+	Existing IndexSpec
+	Reason   string
+}
+
+// Empty reports whether the collection already has exactly the declared indexes.
+func (p *IndexPlan) Empty() bool {
+	return len(p.Create) == 0 && len(p.Extra) == 0 && len(p.Conflicts) == 0
+}
+
+// String describes the plan, one index per line: "+" for indexes to create, "!" for conflicts and "-" for extras.
+func (p *IndexPlan) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "indexes of %s:\n", p.Namespace)
+	if p.Empty() {
+		b.WriteString("  up to date\n")
+	}
+	for _, spec := range p.Create {
+		fmt.Fprintf(&b, "  + %s\n", describeIndex(spec))
+	}
+	for _, conflict := range p.Conflicts {
+		fmt.Fprintf(&b, "  ! %s: %s (existing: %s)\n", describeIndex(conflict.Declared), conflict.Reason, describeIndex(conflict.Existing))
+	}
+	for _, spec := range p.Extra {
+		fmt.Fprintf(&b, "  - %s: not declared\n", describeIndex(spec))
+	}
+
+	return b.String()
+}
+
+// EnsureIndexesOptions configures EnsureIndexes.
+type EnsureIndexesOptions struct {
+	// DryRun computes the plan and writes it to Out without creating any index.
+	DryRun bool
+	// Out is where the plan is written in dry-run mode. Defaults to os.Stdout.
+	Out io.Writer
+}
+
+// EnsureIndexes creates the indexes declared by the model, when it implements Indexed, that are missing from
+// the collection. It returns the plan it applied, which also reports the existing indexes that are not declared
+// and the declared indexes that conflict with existing ones; neither are changed.
+func (r *Repository[M, I]) EnsureIndexes(ctx context.Context, opts ...*EnsureIndexesOptions) (*IndexPlan, error) {
+	ctx, span := r.startSpan(ctx, "EnsureIndexes", nil)
+	plan, err := r.ensureIndexes(ctx, opts...)
+	err = r.classify(ctx, "EnsureIndexes", err)
+	span.end(err)
+	return plan, err
+}
+
+func (r *Repository[M, I]) ensureIndexes(ctx context.Context, opts ...*EnsureIndexesOptions) (*IndexPlan, error) {
+	var o EnsureIndexesOptions
+	for _, opt := range opts {
+		if opt != nil {
+			o = *opt
+		}
+	}
+
+	var declared []IndexSpec
+	var model = newModel[M]()
+	if indexed, ok := hook[Indexed](&model); ok {
+		declared = indexed.Indexes()
+	}
+
+	namespace, err := r.namespace(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEnsureIndexes, err)
+	}
+
+	var collection = r.client.Database(namespace.Database).Collection(namespace.Collection)
+
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to list indexes: %w", ErrEnsureIndexes, err)
+	}
+
+	var existing []indexDocument
+	err = cursor.All(ctx, &existing)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode indexes: %w", ErrEnsureIndexes, err)
+	}
+
+	var plan = planIndexes(declared, existing)
+	plan.Namespace = namespace.String()
+
+	if o.DryRun {
+		var out = o.Out
+		if out == nil {
+			out = os.Stdout
+		}
+		_, err := io.WriteString(out, plan.String())
+		if err != nil {
+			return plan, fmt.Errorf("%w: failed to write plan: %w", ErrEnsureIndexes, err)
+		}
+		return plan, nil
+	}
+
+	if len(plan.Create) == 0 {
+		return plan, nil
+	}
+
+	var models = make([]mongo.IndexModel, len(plan.Create))
+	for i, spec := range plan.Create {
+		models[i] = spec.indexModel()
+	}
+
+	_, err = collection.Indexes().CreateMany(ctx, models)
+	if err != nil {
+		return plan, fmt.Errorf("%w: %w", ErrEnsureIndexes, err)
+	}
+
+	return plan, nil
+}
+
+func (s IndexSpec) indexModel() mongo.IndexModel {
+	var o = options.Index().SetName(s.IndexName())
+	if s.Unique {
+		o.SetUnique(true)
+	}
+	if s.Sparse {
+		o.SetSparse(true)
+	}
+	if s.PartialFilter != nil {
+		o.SetPartialFilterExpression(s.PartialFilter)
+	}
+	if s.isTTL() {
+		o.SetExpireAfterSeconds(int32(s.ExpireAfter / time.Second))
+	}
+	if s.Collation != nil {
+		o.SetCollation(s.Collation)
+	}
+
+	return mongo.IndexModel{Keys: s.Keys, Options: o}
+}
+
+// indexDocument is an index as returned by listIndexes.
+type indexDocument struct {
+	Name                    string   `bson:"name"`
+	Key                     bson.D   `bson:"key"`
+	Weights                 bson.D   `bson:"weights"`
+	Unique                  bool     `bson:"unique"`
+	Sparse                  bool     `bson:"sparse"`
+	PartialFilterExpression bson.D   `bson:"partialFilterExpression"`
+	ExpireAfterSeconds      *float64 `bson:"expireAfterSeconds"`
+	Collation               *struct {
+		Locale          string `bson:"locale"`
+		CaseLevel       bool   `bson:"caseLevel"`
+		CaseFirst       string `bson:"caseFirst"`
+		Strength        int    `bson:"strength"`
+		NumericOrdering bool   `bson:"numericOrdering"`
+		Alternate       string `bson:"alternate"`
+		MaxVariable     string `bson:"maxVariable"`
+		Normalization   bool   `bson:"normalization"`
+		Backwards       bool   `bson:"backwards"`
+	} `bson:"collation"`
+}
+
+func (d indexDocument) spec() IndexSpec {
+	var spec = IndexSpec{
+		Keys:          textKeys(d.Key, d.Weights),
+		Name:          d.Name,
+		Unique:        d.Unique,
+		Sparse:        d.Sparse,
+		PartialFilter: d.PartialFilterExpression,
+	}
+	if d.ExpireAfterSeconds != nil {
+		spec.TTL = true
+		spec.ExpireAfter = time.Duration(*d.ExpireAfterSeconds) * time.Second
+	}
+	if c := d.Collation; c != nil {
+		spec.Collation = &options.Collation{
+			Locale:          c.Locale,
+			CaseLevel:       c.CaseLevel,
+			CaseFirst:       c.CaseFirst,
+			Strength:        c.Strength,
+			NumericOrdering: c.NumericOrdering,
+			Alternate:       c.Alternate,
+			MaxVariable:     c.MaxVariable,
+			Normalization:   c.Normalization,
+			Backwards:       c.Backwards,
+		}
+	}
+	return spec
+}
+
+func planIndexes(declared []IndexSpec, existing []indexDocument) *IndexPlan {
+	var plan = &IndexPlan{}
+	var matched = make(map[string]bool)
+
+	for _, spec := range declared {
+		var name = spec.IndexName()
+		var found *IndexSpec
+
+		for _, doc := range existing {
+			if doc.Name == name || sameKeys(textKeys(doc.Key, doc.Weights), spec.Keys) {
+				var e = doc.spec()
+				found = &e
+				break
+			}
+		}
+
+		if found == nil {
+			plan.Create = append(plan.Create, spec)
+			continue
+		}
+
+		matched[found.Name] = true
+		if reason := indexDifference(spec, *found); reason != "" {
+			plan.Conflicts = append(plan.Conflicts, IndexConflict{Declared: spec, Existing: *found, Reason: reason})
+		}
+	}
+
+	for _, doc := range existing {
+		if doc.Name != "_id_" && !matched[doc.Name] {
+			plan.Extra = append(plan.Extra, doc.spec())
+		}
+	}
+
+	return plan
+}
+
+// indexDifference describes how the declared index differs from the existing one, or returns an empty string.
+func indexDifference(declared IndexSpec, existing IndexSpec) string {
+	var differences []string
+
+	if declared.IndexName() != existing.Name {
+		differences = append(differences, fmt.Sprintf("name %q differs", declared.IndexName()))
+	}
+	if !sameKeys(declared.Keys, existing.Keys) {
+		differences = append(differences, "keys differ")
+	}
+	if declared.Unique != existing.Unique {
+		differences = append(differences, "unique differs")
+	}
+	if declared.Sparse != existing.Sparse {
+		differences = append(differences, "sparse differs")
+	}
+	if extJSON(declared.PartialFilter) != extJSON(existing.PartialFilter) {
+		differences = append(differences, "partial filter differs")
+	}
+	if declared.isTTL() != existing.isTTL() || declared.ExpireAfter.Truncate(time.Second) != existing.ExpireAfter {
+		differences = append(differences, "TTL differs")
+	}
+	if !sameCollation(declared.Collation, existing.Collation) {
+		differences = append(differences, "collation differs")
+	}
+
+	return strings.Join(differences, ", ")
+}
+
+// textKeys returns the keys of an index as listIndexes reports them, with the {_fts: "text", _ftsx: 1} keys of text
+// indexes replaced by the text fields of their weights, as they are declared.
+func textKeys(keys bson.D, weights bson.D) bson.D {
+	var text = false
+	for _, k := range keys {
+		text = text || k.Key == "_fts"
+	}
+	if !text {
+		return keys
+	}
+
+	var declared = make(bson.D, 0, len(keys)+len(weights))
+	for _, k := range keys {
+		switch k.Key {
+		case "_fts":
+			for _, w := range weights {
+				declared = append(declared, bson.E{Key: w.Key, Value: "text"})
+			}
+		case "_ftsx":
+		default:
+			declared = append(declared, k)
+		}
+	}
+	return declared
+}
+
+// sortTextKeys returns a copy of the keys with each run of text fields sorted by name, since the order of the text
+// fields of an index is not kept by the server.
+func sortTextKeys(keys bson.D) bson.D {
+	var sorted = append(bson.D(nil), keys...)
+	for start := 0; start < len(sorted); start++ {
+		if sorted[start].Value != "text" {
+			continue
+		}
+		var end = start
+		for end < len(sorted) && sorted[end].Value == "text" {
+			end++
+		}
+		slices.SortFunc(sorted[start:end], func(a, b bson.E) int { return strings.Compare(a.Key, b.Key) })
+		start = end
+	}
+	return sorted
+}
+
+func sameKeys(a bson.D, b bson.D) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = sortTextKeys(a), sortTextKeys(b)
+	for i := range a {
+		if a[i].Key != b[i].Key || normalizeKeyValue(a[i].Value) != normalizeKeyValue(b[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeKeyValue returns numeric directions as an int64, so that 1, int32(1) and 1.0 compare equal.
+func normalizeKeyValue(v any) any {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	}
+	return v
+}
+
+// sameCollation compares the collation fields that are declared, since the server reports every field.
+func sameCollation(declared *options.Collation, existing *options.Collation) bool {
+	if declared == nil || existing == nil {
+		return declared == nil && existing == nil
+	}
+
+	return declared.Locale == existing.Locale &&
+		(declared.Strength == 0 || declared.Strength == existing.Strength) &&
+		(declared.CaseFirst == "" || declared.CaseFirst == existing.CaseFirst) &&
+		(declared.Alternate == "" || declared.Alternate == existing.Alternate) &&
+		(declared.MaxVariable == "" || declared.MaxVariable == existing.MaxVariable) &&
+		(!declared.CaseLevel || existing.CaseLevel) &&
+		(!declared.NumericOrdering || existing.NumericOrdering) &&
+		(!declared.Normalization || existing.Normalization) &&
+		(!declared.Backwards || existing.Backwards)
+}
+
+func extJSON(document bson.D) string {
+	if document == nil {
+		return ""
+	}
+	b, err := bson.MarshalExtJSON(document, false, false)
+	if err != nil {
+		return fmt.Sprint(document)
+	}
+	return string(b)
+}
+
+func describeIndex(spec IndexSpec) string {
+	var b strings.Builder
+	b.WriteString(spec.IndexName())
+	b.WriteString(" ")
+	b.WriteString(extJSON(spec.Keys))
+	if spec.Unique {
+		b.WriteString(" unique")
+	}
+	if spec.Sparse {
+		b.WriteString(" sparse")
+	}
+	if spec.PartialFilter != nil {
+		b.WriteString(" partial " + extJSON(spec.PartialFilter))
+	}
+	if spec.isTTL() {
+		b.WriteString(" ttl " + spec.ExpireAfter.String())
+	}
+	if spec.Collation != nil {
+		b.WriteString(" collation " + spec.Collation.Locale)
+	}
+	return b.String()
+}
@@ -0,0 +1,132 @@
+package repo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIndexSpec_IndexName(t *testing.T) {
+	tests := []struct {
+		name string
+		spec IndexSpec
+		want string
+	}{
+		{name: "single key", spec: IndexSpec{Keys: bson.D{{Key: "email", Value: 1}}}, want: "email_1"},
+		{name: "compound", spec: IndexSpec{Keys: bson.D{{Key: "a", Value: 1}, {Key: "b", Value: -1.0}}}, want: "a_1_b_-1"},
+		{name: "text", spec: IndexSpec{Keys: bson.D{{Key: "bio", Value: "text"}}}, want: "bio_text"},
+		{name: "explicit", spec: IndexSpec{Keys: bson.D{{Key: "email", Value: 1}}, Name: "by_email"}, want: "by_email"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.spec.IndexName(); got != tt.want {
+				t.Errorf("IndexName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanIndexes(t *testing.T) {
+	var ttl = float64(3600)
+	var existing = []indexDocument{
+		{Name: "_id_", Key: bson.D{{Key: "_id", Value: int32(1)}}},
+		{Name: "email_1", Key: bson.D{{Key: "email", Value: int32(1)}}, Unique: true},
+		{Name: "name_1", Key: bson.D{{Key: "name", Value: 1.0}}},
+		{Name: "expiresAt_1", Key: bson.D{{Key: "expiresAt", Value: int32(1)}}, ExpireAfterSeconds: &ttl},
+		{Name: "legacy_1", Key: bson.D{{Key: "legacy", Value: int32(1)}}},
+	}
+
+	var declared = []IndexSpec{
+		{Keys: bson.D{{Key: "email", Value: 1}}, Unique: true},
+		{Keys: bson.D{{Key: "name", Value: 1}}, Unique: true},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, ExpireAfter: time.Hour},
+		{Keys: bson.D{{Key: "createdAt", Value: -1}}},
+	}
+
+	var plan = planIndexes(declared, existing)
+
+	if !reflect.DeepEqual(plan.Create, declared[3:4]) {
+		t.Errorf("planIndexes() create = %+v, want %+v", plan.Create, declared[3:4])
+	}
+
+	if len(plan.Conflicts) != 1 || plan.Conflicts[0].Declared.IndexName() != "name_1" || plan.Conflicts[0].Reason != "unique differs" {
+		t.Errorf("planIndexes() conflicts = %+v, want name_1 with unique differs", plan.Conflicts)
+	}
+
+	if len(plan.Extra) != 1 || plan.Extra[0].Name != "legacy_1" {
+		t.Errorf("planIndexes() extra = %+v, want legacy_1", plan.Extra)
+	}
+
+	var description = plan.String()
+	for _, line := range []string{"+ createdAt_-1", "! name_1", "- legacy_1"} {
+		if !strings.Contains(description, line) {
+			t.Errorf("String() = %q, want a line with %q", description, line)
+		}
+	}
+}
+
+func TestPlanIndexes_zeroTTL(t *testing.T) {
+	var zero = float64(0)
+	var existing = []indexDocument{
+		{Name: "deleteAt_1", Key: bson.D{{Key: "deleteAt", Value: int32(1)}}, ExpireAfterSeconds: &zero},
+		{Name: "purgeAt_1", Key: bson.D{{Key: "purgeAt", Value: int32(1)}}, ExpireAfterSeconds: &zero},
+	}
+
+	var declared = []IndexSpec{
+		{Keys: bson.D{{Key: "deleteAt", Value: 1}}, TTL: true},
+		{Keys: bson.D{{Key: "purgeAt", Value: 1}}},
+	}
+
+	var plan = planIndexes(declared, existing)
+	if len(plan.Conflicts) != 1 || plan.Conflicts[0].Declared.IndexName() != "purgeAt_1" || plan.Conflicts[0].Reason != "TTL differs" {
+		t.Errorf("planIndexes() conflicts = %+v, want purgeAt_1 with TTL differs", plan.Conflicts)
+	}
+
+	var model = declared[0].indexModel()
+	if seconds := model.Options.ExpireAfterSeconds; seconds == nil || *seconds != 0 {
+		t.Errorf("indexModel() expireAfterSeconds = %v, want 0", seconds)
+	}
+	if model := declared[1].indexModel(); model.Options.ExpireAfterSeconds != nil {
+		t.Errorf("indexModel() expireAfterSeconds = %v, want none", *model.Options.ExpireAfterSeconds)
+	}
+}
+
+func TestPlanIndexes_text(t *testing.T) {
+	var existing = []indexDocument{
+		{
+			Name:    "bio_text",
+			Key:     bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}},
+			Weights: bson.D{{Key: "bio", Value: int32(1)}},
+		},
+		{
+			Name:    "owner_1_title_text_body_text_createdAt_-1",
+			Key:     bson.D{{Key: "owner", Value: int32(1)}, {Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}, {Key: "createdAt", Value: int32(-1)}},
+			Weights: bson.D{{Key: "body", Value: int32(1)}, {Key: "title", Value: int32(1)}},
+		},
+	}
+
+	var declared = []IndexSpec{
+		{Keys: bson.D{{Key: "bio", Value: "text"}}},
+		{Keys: bson.D{
+			{Key: "owner", Value: 1},
+			{Key: "title", Value: "text"},
+			{Key: "body", Value: "text"},
+			{Key: "createdAt", Value: -1},
+		}},
+	}
+
+	var plan = planIndexes(declared, existing)
+	if !plan.Empty() {
+		t.Errorf("planIndexes() = %s, want it up to date", plan)
+	}
+
+	var changed = []IndexSpec{{Keys: bson.D{{Key: "summary", Value: "text"}}, Name: "bio_text"}}
+	plan = planIndexes(changed, existing[:1])
+	if len(plan.Conflicts) != 1 || plan.Conflicts[0].Reason != "keys differ" {
+		t.Errorf("planIndexes() conflicts = %+v, want keys differ", plan.Conflicts)
+	}
+}
@@ -0,0 +1,257 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InsertStreamOptions configures InsertStream.
+type InsertStreamOptions struct {
+	// BatchSize is the maximum number of documents of a batch. Defaults to 1000.
+	BatchSize int
+	// BatchBytes is the maximum size of a batch, estimated from the BSON size of its documents. A document larger
+	// than BatchBytes is inserted in a batch of its own. Defaults to 8MB.
+	BatchBytes int
+	// Concurrency is the number of batches inserted at the same time. Defaults to 4.
+	Concurrency int
+	// Progress is called after each batch with the running totals. Calls are never concurrent.
+	Progress func(InsertStreamStats)
+}
+
+// InsertStreamStats are the running totals of an InsertStream.
+type InsertStreamStats struct {
+	Batches  int64 // The number of batches inserted, including batches with failures.
+	Inserted int64 // The number of documents inserted.
+	Failed   int64 // The number of documents that could not be inserted.
+}
+
+// the defaults of InsertStreamOptions.
+const (
+	defaultInsertBatchSize   = 1000
+	defaultInsertBatchBytes  = 8 << 20
+	defaultInsertConcurrency = 4
+)
+
+func mergeInsertStreamOptions(opts ...*InsertStreamOptions) InsertStreamOptions {
+	var o = InsertStreamOptions{
+		BatchSize:   defaultInsertBatchSize,
+		BatchBytes:  defaultInsertBatchBytes,
+		Concurrency: defaultInsertConcurrency,
+	}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.BatchSize > 0 {
+			o.BatchSize = opt.BatchSize
+		}
+		if opt.BatchBytes > 0 {
+			o.BatchBytes = opt.BatchBytes
+		}
+		if opt.Concurrency > 0 {
+			o.Concurrency = opt.Concurrency
+		}
+		if opt.Progress != nil {
+			o.Progress = opt.Progress
+		}
+	}
+	return o
+}
+
+// InsertStream inserts documents read from a sequence, such as one returned by FromChan, in unordered InsertMany
+// batches bounded by BatchSize and BatchBytes, running Concurrency batches at the same time. Only the documents of
+// a batch in flight are held in memory, so the sequence can be arbitrarily long.
+//
+// A document that fails does not stop the import. When some documents failed, InsertStream returns the totals
+// along with an error wrapping a *BulkError whose failures are indexed by position in the sequence. When a whole
+// batch fails, for example on a network error, each of its documents is reported with the error of the batch.
+// When the context is done, InsertStream stops reading the sequence, waits for the batches in flight and returns
+// the context error.
+//
+// example:
+//
+//	stats, err := usersRepo.InsertStream(ctx, repo.FromChan(users), &repo.InsertStreamOptions{
+//		Progress: func(stats repo.InsertStreamStats) { log.Printf("%d inserted", stats.Inserted) },
+//	})
+func (r *Repository[M, I]) InsertStream(
+	ctx context.Context,
+	documents iter.Seq[M],
+	opts ...*InsertStreamOptions,
+) (InsertStreamStats, error) {
+	return r.streamInserts(ctx, documents, r.insertBatch, opts...)
+}
+
+// insertBatch inserts a batch of an InsertStream.
+func (r *Repository[M, I]) insertBatch(ctx context.Context, batch []M) error {
+	_, err := r.InsertMany(ctx, batch, options.InsertMany().SetOrdered(false))
+	return err
+}
+
+// streamInserts runs an InsertStream inserting its batches with insert, which decorators use to record or
+// invalidate the documents of each batch. insert returns an error wrapping a *BulkError when some documents failed.
+func (r *Repository[M, I]) streamInserts(
+	ctx context.Context,
+	documents iter.Seq[M],
+	insert func(ctx context.Context, batch []M) error,
+	opts ...*InsertStreamOptions,
+) (InsertStreamStats, error) {
+	ctx, span := r.startSpan(ctx, "InsertStream", nil)
+	stats, err := r.insertStream(ctx, documents, insert, opts...)
+	err = r.classify(ctx, "InsertStream", err)
+	span.end(err, insertedKey.Int64(stats.Inserted))
+	return stats, err
+}
+
+func (r *Repository[M, I]) insertStream(
+	ctx context.Context,
+	documents iter.Seq[M],
+	insert func(ctx context.Context, batch []M) error,
+	opts ...*InsertStreamOptions,
+) (InsertStreamStats, error) {
+	var o = mergeInsertStreamOptions(opts...)
+
+	var mu sync.Mutex
+	var stats InsertStreamStats
+	var failures []BulkFailure
+
+	// done records the outcome of a batch starting at the given position of the sequence.
+	var done = func(offset int, batch []M, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		stats.Batches++
+		failed := batchFailures(offset, len(batch), err)
+		failures = append(failures, failed...)
+		stats.Failed += int64(len(failed))
+		stats.Inserted += int64(len(batch) - len(failed))
+
+		if o.Progress != nil {
+			o.Progress(stats)
+		}
+	}
+
+	var wg sync.WaitGroup
+	var slots = make(chan struct{}, o.Concurrency)
+
+	// flush inserts a batch in the background, once a slot is free.
+	var flush = func(offset int, batch []M) bool {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return false
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			done(offset, batch, insert(ctx, batch))
+		}()
+		return true
+	}
+
+	var position, offset, size int
+	var batch []M
+	for document := range documents {
+		if ctx.Err() != nil {
+			break
+		}
+
+		raw, err := bson.Marshal(document)
+		if err != nil {
+			var failure = NewRepoError("InsertStream", r.operationNamespace(ctx), fmt.Errorf("%w: document %d: %w", ErrInsertStream, position, err))
+
+			mu.Lock()
+			failures = append(failures, BulkFailure{Index: position, Kind: failure.Kind, Err: failure})
+			stats.Failed++
+			mu.Unlock()
+
+			position++
+			continue
+		}
+
+		if len(batch) > 0 && (len(batch) == o.BatchSize || size+len(raw) > o.BatchBytes) {
+			if !flush(offset, batch) {
+				break
+			}
+			batch, size = nil, 0
+		}
+
+		if len(batch) == 0 {
+			offset = position
+		}
+		batch = append(batch, document)
+		size += len(raw)
+		position++
+	}
+
+	if len(batch) > 0 && ctx.Err() == nil {
+		flush(offset, batch)
+	}
+
+	wg.Wait()
+
+	var errs []error
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(failures) > 0 {
+		slices.SortFunc(failures, func(a, b BulkFailure) int {
+			return a.Index - b.Index
+		})
+		errs = append(errs, &BulkError{
+			Failures: failures,
+			Err:      fmt.Errorf("%d documents failed", len(failures)),
+		})
+	}
+
+	if len(errs) > 0 {
+		return stats, fmt.Errorf("%w: %w", ErrInsertStream, errors.Join(errs...))
+	}
+	return stats, nil
+}
+
+// batchFailures returns the failures of the documents of an InsertMany batch, indexed by position in the sequence.
+func batchFailures(offset int, size int, err error) []BulkFailure {
+	if err == nil {
+		return nil
+	}
+
+	var bulkErr *BulkError
+	if errors.As(err, &bulkErr) {
+		var failures = make([]BulkFailure, len(bulkErr.Failures))
+		for i, f := range bulkErr.Failures {
+			failures[i] = f
+			failures[i].Index += offset
+		}
+		return failures
+	}
+
+	var kind = errorKind(err)
+	var failures = make([]BulkFailure, size)
+	for i := range failures {
+		failures[i] = BulkFailure{Index: offset + i, Kind: kind, Err: err}
+	}
+	return failures
+}
+
+// FromChan returns a sequence of the values received from a channel, until it is closed, for use with InsertStream.
+// When the sequence is not read to the end, for example because the context of InsertStream is done, the sender
+// must stop sending on its own.
+func FromChan[T any](ch <-chan T) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for v := range ch {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type StreamedModel struct {
+	ID   primitive.ObjectID `bson:"_id"`
+	Name string             `bson:"name"`
+}
+
+func (s *StreamedModel) GetDatabaseName() string {
+	return "streamed_model_db"
+}
+
+func (s *StreamedModel) GetCollectionName() string {
+	return "streamed_model_col"
+}
+
+func TestBatchFailures(t *testing.T) {
+	var bulkErr = NewBulkError("InsertMany", Namespace{}, 3, false, mongo.BulkWriteException{
+		WriteErrors: []mongo.BulkWriteError{{WriteError: mongo.WriteError{Index: 1, Code: 11000}}},
+	})
+
+	tests := []struct {
+		name  string
+		err   error
+		want  []int
+		kinds []ErrorKind
+	}{
+		{
+			name: "no error",
+		},
+		{
+			name:  "document failures",
+			err:   fmt.Errorf("%w: %w", ErrInsertMany, bulkErr),
+			want:  []int{11},
+			kinds: []ErrorKind{KindDuplicateKey},
+		},
+		{
+			name:  "batch failure",
+			err:   fmt.Errorf("%w: %w", ErrInsertMany, context.DeadlineExceeded),
+			want:  []int{10, 11, 12},
+			kinds: []ErrorKind{KindTimeout, KindTimeout, KindTimeout},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var indexes []int
+			var kinds []ErrorKind
+			for _, f := range batchFailures(10, 3, tt.err) {
+				indexes = append(indexes, f.Index)
+				kinds = append(kinds, f.Kind)
+			}
+			if !reflect.DeepEqual(indexes, tt.want) || !reflect.DeepEqual(kinds, tt.kinds) {
+				t.Errorf("batchFailures() = %v %v, want %v %v", indexes, kinds, tt.want, tt.kinds)
+			}
+		})
+	}
+}
+
+func TestFromChan(t *testing.T) {
+	var ch = make(chan int, 3)
+	ch <- 1
+	ch <- 2
+	ch <- 3
+	close(ch)
+
+	if got := slices.Collect(FromChan(ch)); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Errorf("FromChan() = %v, want [1 2 3]", got)
+	}
+}
+
+func TestRepository_InsertStream(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var repository = NewRepository[*StreamedModel, primitive.ObjectID](mongoClient)
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		err := mongoClient.Database("streamed_model_db").Collection("streamed_model_col").Drop(context.Background())
+		if err != nil {
+			t.Errorf("error dropping collection: %v", err)
+		}
+	}()
+
+	var existing = &StreamedModel{ID: primitive.NewObjectID(), Name: "existing"}
+	_, err = repository.InsertOne(ctx, existing)
+	if err != nil {
+		t.Errorf("InsertOne() error = %v", err)
+		return
+	}
+
+	var documents = make(chan *StreamedModel)
+	go func() {
+		defer close(documents)
+		for i := 0; i < 25; i++ {
+			if i == 7 || i == 18 {
+				documents <- existing
+				continue
+			}
+			documents <- &StreamedModel{ID: primitive.NewObjectID(), Name: fmt.Sprintf("document %d", i)}
+		}
+	}()
+
+	var progress []InsertStreamStats
+	stats, err := repository.InsertStream(ctx, FromChan(documents), &InsertStreamOptions{
+		BatchSize:   5,
+		Concurrency: 2,
+		Progress: func(stats InsertStreamStats) {
+			progress = append(progress, stats)
+		},
+	})
+
+	var bulkErr *BulkError
+	if !errors.Is(err, ErrInsertStream) || !errors.As(err, &bulkErr) {
+		t.Errorf("InsertStream() error = %v, want a *BulkError", err)
+		return
+	}
+	if !reflect.DeepEqual(bulkErr.Failed(), []int{7, 18}) {
+		t.Errorf("InsertStream() failed = %v, want [7 18]", bulkErr.Failed())
+	}
+
+	var want = InsertStreamStats{Batches: 5, Inserted: 23, Failed: 2}
+	if stats != want {
+		t.Errorf("InsertStream() stats = %+v, want %+v", stats, want)
+	}
+	if len(progress) != 5 || progress[4] != want {
+		t.Errorf("progress = %+v, want 5 calls ending with %+v", progress, want)
+	}
+
+	count, err := repository.Count(ctx, map[string]any{})
+	if err != nil || count != 24 {
+		t.Errorf("Count() = %d, %v, want 24", count, err)
+	}
+}
@@ -0,0 +1,113 @@
+package meta
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SetFields sets the fields of the document named by the keys of values, e.g. to stamp the owner on a new document.
+// Values that are operator documents, e.g. {$in: [...]}, do not name a single value and are skipped.
+// Values are converted to the type of their field when possible.
+func SetFields(document any, values bson.D) error {
+	v, ok := value(document)
+	if !ok {
+		return nil
+	}
+
+	for _, e := range values {
+		if isOperator(e.Value) {
+			continue
+		}
+
+		field, ok := fieldByName(v, e.Key)
+		if !ok {
+			return fmt.Errorf("%s is not a field of %s", e.Key, v.Type())
+		}
+
+		if err := set(field, e.Value); err != nil {
+			return fmt.Errorf("field %s: %w", e.Key, err)
+		}
+	}
+
+	return nil
+}
+
+// fieldByName returns the field of a struct with the given name in documents, looking into inlined structs.
+func fieldByName(v reflect.Value, name string) (reflect.Value, bool) {
+	var t = v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		fieldName, inline, _, skip := bsonName(t.Field(i))
+		if skip {
+			continue
+		}
+
+		if inline {
+			var inlined = v.Field(i)
+			if inlined.Kind() != reflect.Pointer {
+				if field, ok := fieldByName(inlined, name); ok {
+					return field, true
+				}
+				continue
+			}
+
+			// nil inline structs are only allocated when they have the field.
+			if _, ok := fieldByName(reflect.New(inlined.Type().Elem()).Elem(), name); !ok {
+				continue
+			}
+			if inlined.IsNil() {
+				inlined.Set(reflect.New(inlined.Type().Elem()))
+			}
+			return fieldByName(inlined.Elem(), name)
+		}
+
+		if fieldName == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func set(field reflect.Value, value any) error {
+	if value == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+
+	var v = reflect.ValueOf(value)
+	var t = field.Type()
+	if t.Kind() == reflect.Pointer && v.Type() != t {
+		field.Set(reflect.New(t.Elem()))
+		field, t = field.Elem(), t.Elem()
+	}
+
+	switch {
+	case v.Type().AssignableTo(t):
+		field.Set(v)
+	case v.Type().ConvertibleTo(t) && (t.Kind() == reflect.String) == (v.Kind() == reflect.String):
+		// numbers convert to strings as runes, which is never what a filter means.
+		field.Set(v.Convert(t))
+	default:
+		return fmt.Errorf("cannot set %T to a %s", value, t)
+	}
+	return nil
+}
+
+// isOperator reports whether a filter value is a document of operators rather than a value to match.
+func isOperator(value any) bool {
+	switch value := value.(type) {
+	case bson.D:
+		return len(value) > 0 && strings.HasPrefix(value[0].Key, "$")
+	case bson.M:
+		for key := range value {
+			return strings.HasPrefix(key, "$")
+		}
+	case map[string]any:
+		for key := range value {
+			return strings.HasPrefix(key, "$")
+		}
+	}
+	return false
+}
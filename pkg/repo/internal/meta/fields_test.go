@@ -0,0 +1,72 @@
+package meta
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OwnerID string
+
+type Owned struct {
+	Base    `bson:",inline"`
+	OwnerID OwnerID `bson:"ownerId"`
+	OrgID   *primitive.ObjectID
+	Level   int64 `bson:"level"`
+}
+
+func TestSetFields(t *testing.T) {
+	var org = primitive.NewObjectID()
+
+	tests := []struct {
+		name    string
+		values  bson.D
+		check   func(o *Owned) bool
+		wantErr bool
+	}{
+		{
+			name:   "converts to the field type",
+			values: bson.D{{Key: "ownerId", Value: "alice"}},
+			check:  func(o *Owned) bool { return o.OwnerID == "alice" },
+		},
+		{
+			name:   "allocates pointers",
+			values: bson.D{{Key: "orgid", Value: org}},
+			check:  func(o *Owned) bool { return o.OrgID != nil && *o.OrgID == org },
+		},
+		{
+			name:   "converts numbers",
+			values: bson.D{{Key: "level", Value: int32(3)}},
+			check:  func(o *Owned) bool { return o.Level == 3 },
+		},
+		{
+			name:   "skips operators",
+			values: bson.D{{Key: "ownerId", Value: bson.M{"$in": bson.A{"alice", "bob"}}}},
+			check:  func(o *Owned) bool { return o.OwnerID == "" },
+		},
+		{
+			name:    "unknown field",
+			values:  bson.D{{Key: "tenant", Value: "acme"}},
+			wantErr: true,
+		},
+		{
+			name:    "number to string",
+			values:  bson.D{{Key: "ownerId", Value: 65}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var o = &Owned{}
+			err := SetFields(&o, tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SetFields() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !tt.check(o) {
+				t.Errorf("SetFields() = %+v", o)
+			}
+		})
+	}
+}
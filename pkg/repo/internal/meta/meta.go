@@ -0,0 +1,206 @@
+// Package meta reads the `repo` struct tags of models, which opt fields into behaviour managed by the repositories,
+// e.g. `repo:"createdAt"`, and applies that behaviour to documents and update documents.
+package meta
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Field is a struct field managed by the repositories.
+type Field struct {
+	Index []int  // The index sequence of the field, for reflect.Value.FieldByIndex.
+	Name  string // The name of the field in documents.
+}
+
+// Model describes the managed fields of a model type.
+type Model struct {
+	CreatedAt *Field
+	UpdatedAt *Field
+	DeletedAt *Field
+	Version   *Field
+
+	// Err is set when the tags of the model are invalid, e.g. a timestamp tag on a string field.
+	Err error
+}
+
+var cache sync.Map
+
+// For returns the description of the model type M.
+func For[M any]() *Model {
+	return Of(reflect.TypeOf((*M)(nil)).Elem())
+}
+
+// Of returns the description of the model type t, which may be a pointer to a struct.
+func Of(t reflect.Type) *Model {
+	if m, ok := cache.Load(t); ok {
+		return m.(*Model)
+	}
+
+	var key = t
+	var m = &Model{}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct {
+		m.Err = m.parse(t, nil)
+	}
+
+	actual, _ := cache.LoadOrStore(key, m)
+	return actual.(*Model)
+}
+
+func (m *Model) parse(t reflect.Type, index []int) error {
+	for i := 0; i < t.NumField(); i++ {
+		var sf = t.Field(i)
+		var fieldIndex = append(append([]int(nil), index...), i)
+
+		name, inline, omitempty, skip := bsonName(sf)
+		if skip {
+			continue
+		}
+
+		if inline {
+			if err := m.parse(structType(sf.Type), fieldIndex); err != nil {
+				return err
+			}
+			continue
+		}
+
+		tag, ok := sf.Tag.Lookup("repo")
+		if !ok {
+			continue
+		}
+
+		var field = &Field{Index: fieldIndex, Name: name}
+		for _, option := range strings.Split(tag, ",") {
+			switch option {
+			case "createdAt":
+				if !isTime(sf.Type) {
+					return fmt.Errorf("field %s tagged %q must be a time.Time, *time.Time or primitive.DateTime", sf.Name, option)
+				}
+				m.CreatedAt = field
+			case "updatedAt":
+				if !isTime(sf.Type) {
+					return fmt.Errorf("field %s tagged %q must be a time.Time, *time.Time or primitive.DateTime", sf.Name, option)
+				}
+				m.UpdatedAt = field
+			case "deletedAt":
+				if !isTime(sf.Type) {
+					return fmt.Errorf("field %s tagged %q must be a time.Time, *time.Time or primitive.DateTime", sf.Name, option)
+				}
+				// soft deleted documents are told apart by the presence of the field.
+				if !omitempty {
+					return fmt.Errorf("field %s tagged %q must have the omitempty bson option", sf.Name, option)
+				}
+				m.DeletedAt = field
+			case "version":
+				switch sf.Type.Kind() {
+				case reflect.Int, reflect.Int32, reflect.Int64:
+				default:
+					return fmt.Errorf("field %s tagged %q must be an int, int32 or int64", sf.Name, option)
+				}
+				m.Version = field
+			case "":
+			default:
+				return fmt.Errorf("field %s has an unknown repo tag %q", sf.Name, option)
+			}
+		}
+	}
+
+	return nil
+}
+
+// bsonName returns the name of the field in documents, following the rules of the default bson codec.
+// inline is only reported for struct and pointer to struct fields, whose fields the codec flattens into the document.
+func bsonName(sf reflect.StructField) (name string, inline bool, omitempty bool, skip bool) {
+	if !sf.IsExported() {
+		return "", false, false, true
+	}
+
+	tag := sf.Tag.Get("bson")
+	if tag == "-" {
+		return "", false, false, true
+	}
+
+	name, options, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = strings.ToLower(sf.Name)
+	}
+
+	options = "," + options + ","
+	inline = strings.Contains(options, ",inline,") && structType(sf.Type).Kind() == reflect.Struct
+	return name, inline, strings.Contains(options, ",omitempty,"), false
+}
+
+// structType returns the type a struct or pointer to struct field holds.
+func structType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return t
+}
+
+// fieldByIndex returns the nested field with the index sequence, allocating the nil inline structs on the way.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	dateTimeType = reflect.TypeOf(primitive.DateTime(0))
+)
+
+func isTime(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t == timeType || t == dateTimeType
+}
+
+// value returns the struct a model points to, or false for nil pointers.
+func value(document any) (reflect.Value, bool) {
+	var v = reflect.ValueOf(document)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return v, false
+		}
+		v = v.Elem()
+	}
+	return v, v.Kind() == reflect.Struct && v.CanSet()
+}
+
+func isZero(v reflect.Value) bool {
+	if v.Kind() == reflect.Pointer {
+		return v.IsNil() || v.Elem().IsZero()
+	}
+	return v.IsZero()
+}
+
+func setTime(v reflect.Value, now time.Time) {
+	var t = v.Type()
+	if t.Kind() == reflect.Pointer {
+		v.Set(reflect.New(t.Elem()))
+		v, t = v.Elem(), t.Elem()
+	}
+
+	if t == dateTimeType {
+		v.Set(reflect.ValueOf(primitive.NewDateTimeFromTime(now)))
+		return
+	}
+	v.Set(reflect.ValueOf(now))
+}
@@ -0,0 +1,300 @@
+package meta
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Schema returns the $jsonSchema describing documents encoded from the model type t with the default bson codec,
+// with the constraints of the `schema` struct tags of its fields. See repo.JSONSchema for the rules.
+func Schema(t reflect.Type) (bson.D, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("model type %s is not a struct", t)
+	}
+
+	return (&schemaBuilder{visiting: make(map[reflect.Type]bool)}).object(t)
+}
+
+var (
+	objectIDType   = reflect.TypeOf(primitive.ObjectID{})
+	decimalType    = reflect.TypeOf(primitive.Decimal128{})
+	binaryType     = reflect.TypeOf(primitive.Binary{})
+	regexType      = reflect.TypeOf(primitive.Regex{})
+	timestampType  = reflect.TypeOf(primitive.Timestamp{})
+	documentType   = reflect.TypeOf(bson.D{})
+	rawType        = reflect.TypeOf(bson.Raw{})
+	arrayType      = reflect.TypeOf(bson.A{})
+	marshalerType  = reflect.TypeOf((*bson.Marshaler)(nil)).Elem()
+	valueMarshaler = reflect.TypeOf((*bson.ValueMarshaler)(nil)).Elem()
+)
+
+type schemaBuilder struct {
+	// visiting holds the structs being described, so that recursive types end in an unconstrained schema.
+	visiting map[reflect.Type]bool
+}
+
+// object returns the schema of a struct.
+func (b *schemaBuilder) object(t reflect.Type) (bson.D, error) {
+	b.visiting[t] = true
+	defer delete(b.visiting, t)
+
+	var properties = bson.D{}
+	var required = bson.A{}
+	if err := b.fields(t, &properties, &required); err != nil {
+		return nil, err
+	}
+
+	var schema = bson.D{{Key: "bsonType", Value: "object"}}
+	if len(required) > 0 {
+		schema = append(schema, bson.E{Key: "required", Value: required})
+	}
+	return append(schema, bson.E{Key: "properties", Value: properties}), nil
+}
+
+// fields adds the properties of the fields of a struct, including the fields of inlined structs.
+func (b *schemaBuilder) fields(t reflect.Type, properties *bson.D, required *bson.A) error {
+	for i := 0; i < t.NumField(); i++ {
+		var sf = t.Field(i)
+
+		name, inline, omitempty, skip := bsonName(sf)
+		if skip {
+			continue
+		}
+
+		if inline {
+			// the fields of nil inline pointers are left out of documents, so they are not required.
+			var inlineRequired = required
+			if sf.Type.Kind() == reflect.Pointer {
+				inlineRequired = &bson.A{}
+			}
+			if err := b.fields(structType(sf.Type), properties, inlineRequired); err != nil {
+				return err
+			}
+			continue
+		}
+
+		schema, err := b.value(sf.Type)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", sf.Name, err)
+		}
+
+		if tag, ok := sf.Tag.Lookup("schema"); ok {
+			schema, err = constrain(schema, sf.Type, tag)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", sf.Name, err)
+			}
+		}
+
+		*properties = append(*properties, bson.E{Key: name, Value: schema})
+		if !omitempty {
+			*required = append(*required, name)
+		}
+	}
+
+	return nil
+}
+
+// value returns the schema of a value of type t.
+func (b *schemaBuilder) value(t reflect.Type) (bson.D, error) {
+	var nullable bool
+	for t.Kind() == reflect.Pointer {
+		t, nullable = t.Elem(), true
+	}
+
+	schema, err := b.nonNull(t)
+	if err != nil || len(schema) == 0 {
+		return schema, err
+	}
+
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+		nullable = true
+	}
+
+	if nullable {
+		schema[0].Value = append(bson.A{"null"}, bsonTypes(schema[0].Value)...)
+	}
+	return schema, nil
+}
+
+// nonNull returns the schema of a value of type t that is not nil. The bsonType is always the first element, and an
+// empty schema means any value.
+func (b *schemaBuilder) nonNull(t reflect.Type) (bson.D, error) {
+	switch t {
+	case objectIDType:
+		return bson.D{{Key: "bsonType", Value: "objectId"}}, nil
+	case timeType, dateTimeType:
+		return bson.D{{Key: "bsonType", Value: "date"}}, nil
+	case decimalType:
+		return bson.D{{Key: "bsonType", Value: "decimal"}}, nil
+	case binaryType:
+		return bson.D{{Key: "bsonType", Value: "binData"}}, nil
+	case regexType:
+		return bson.D{{Key: "bsonType", Value: "regex"}}, nil
+	case timestampType:
+		return bson.D{{Key: "bsonType", Value: "timestamp"}}, nil
+	case documentType, rawType:
+		return bson.D{{Key: "bsonType", Value: "object"}}, nil
+	case arrayType:
+		return bson.D{{Key: "bsonType", Value: "array"}}, nil
+	}
+
+	// types encoding themselves may encode to anything.
+	if t.Implements(marshalerType) || t.Implements(valueMarshaler) ||
+		reflect.PointerTo(t).Implements(marshalerType) || reflect.PointerTo(t).Implements(valueMarshaler) {
+		return bson.D{}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return bson.D{{Key: "bsonType", Value: "string"}}, nil
+	case reflect.Bool:
+		return bson.D{{Key: "bsonType", Value: "bool"}}, nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return bson.D{{Key: "bsonType", Value: "int"}}, nil
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		// the codec encodes these as int32 when the value fits.
+		return bson.D{{Key: "bsonType", Value: bson.A{"int", "long"}}}, nil
+	case reflect.Float32, reflect.Float64:
+		return bson.D{{Key: "bsonType", Value: "double"}}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return bson.D{{Key: "bsonType", Value: "binData"}}, nil
+		}
+		items, err := b.value(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return bson.D{{Key: "bsonType", Value: "array"}, {Key: "items", Value: items}}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return bson.D{{Key: "bsonType", Value: "object"}}, nil
+		}
+		values, err := b.value(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return bson.D{{Key: "bsonType", Value: "object"}, {Key: "additionalProperties", Value: values}}, nil
+	case reflect.Struct:
+		if b.visiting[t] {
+			return bson.D{{Key: "bsonType", Value: "object"}}, nil
+		}
+		return b.object(t)
+	case reflect.Interface:
+		return bson.D{}, nil
+	}
+
+	return nil, fmt.Errorf("type %s cannot be described", t)
+}
+
+func bsonTypes(value any) bson.A {
+	if a, ok := value.(bson.A); ok {
+		return a
+	}
+	return bson.A{value}
+}
+
+// constrain adds the constraints of a `schema` tag to the schema of a field of type t.
+func constrain(schema bson.D, t reflect.Type, tag string) (bson.D, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	for tag != "" {
+		var option string
+		if strings.HasPrefix(tag, "pattern=") {
+			option, tag = tag, ""
+		} else {
+			option, tag, _ = strings.Cut(tag, ",")
+		}
+
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "min", "max":
+			bound, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid schema %s %q", key, value)
+			}
+
+			var keyword string
+			switch t.Kind() {
+			case reflect.String:
+				keyword = key + "Length"
+			case reflect.Slice, reflect.Array:
+				keyword = key + "Items"
+			case reflect.Map:
+				keyword = key + "Properties"
+			default:
+				if key == "min" {
+					keyword = "minimum"
+				} else {
+					keyword = "maximum"
+				}
+			}
+
+			if bound == math.Trunc(bound) {
+				schema = append(schema, bson.E{Key: keyword, Value: int64(bound)})
+			} else if keyword == "minimum" || keyword == "maximum" {
+				schema = append(schema, bson.E{Key: keyword, Value: bound})
+			} else {
+				return nil, fmt.Errorf("invalid schema %s %q", key, value)
+			}
+		case "enum":
+			var values = bson.A{}
+			for _, v := range strings.Split(value, "|") {
+				parsed, err := enumValue(t, v)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, parsed)
+			}
+			// enum also applies to null values, so fields that may be null must list it.
+			if len(schema) > 0 && schema[0].Key == "bsonType" && slices.Contains(bsonTypes(schema[0].Value), "null") {
+				values = append(values, nil)
+			}
+			schema = append(schema, bson.E{Key: "enum", Value: values})
+		case "pattern":
+			schema = append(schema, bson.E{Key: "pattern", Value: value})
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown schema option %q", key)
+		}
+	}
+
+	return schema, nil
+}
+
+// enumValue parses an enum value as the type of the field, since enum compares values and their types.
+func enumValue(t reflect.Type, value string) (any, error) {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema enum value %q", value)
+		}
+		return i, nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema enum value %q", value)
+		}
+		return f, nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema enum value %q", value)
+		}
+		return b, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,234 @@
+package meta
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Address struct {
+	City string `bson:"city" schema:"min=1"`
+}
+
+type Node struct {
+	Children []Node `bson:"children"`
+}
+
+type Described struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Base      `bson:",inline"`
+	Name      string          `bson:"name" schema:"min=1,max=100"`
+	Age       int             `bson:"age" schema:"min=0,max=150"`
+	Score     float64         `bson:"score" schema:"max=1.5"`
+	Role      string          `bson:"role" schema:"enum=admin|member"`
+	Level     int32           `bson:"level" schema:"enum=1|2"`
+	Email     string          `bson:"email" schema:"pattern=^[a-z]{1,3},@"`
+	Tags      []string        `bson:"tags,omitempty" schema:"max=10"`
+	Address   *Address        `bson:"address"`
+	Labels    map[string]bool `bson:"labels"`
+	DeletedAt *time.Time      `bson:"deletedAt,omitempty"`
+	Data      []byte          `bson:"data"`
+	Extra     any             `bson:"extra"`
+	Tree      Node            `bson:"tree"`
+	internal  string
+	Skipped   string            `bson:"-"`
+	Raw       bson.M            `bson:"raw"`
+	Nested    map[string][]int8 `bson:"nested"`
+}
+
+func TestSchema(t *testing.T) {
+	got, err := Schema(reflect.TypeOf(&Described{}))
+	if err != nil {
+		t.Fatalf("Schema() error = %v", err)
+	}
+
+	want := bson.D{
+		{Key: "bsonType", Value: "object"},
+		{Key: "required", Value: bson.A{
+			"createdAt", "name", "age", "score", "role", "level", "email", "address", "labels", "data", "extra", "tree",
+			"raw", "nested",
+		}},
+		{Key: "properties", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "bsonType", Value: "objectId"}}},
+			{Key: "createdAt", Value: bson.D{{Key: "bsonType", Value: "date"}}},
+			{Key: "name", Value: bson.D{
+				{Key: "bsonType", Value: "string"},
+				{Key: "minLength", Value: int64(1)},
+				{Key: "maxLength", Value: int64(100)},
+			}},
+			{Key: "age", Value: bson.D{
+				{Key: "bsonType", Value: bson.A{"int", "long"}},
+				{Key: "minimum", Value: int64(0)},
+				{Key: "maximum", Value: int64(150)},
+			}},
+			{Key: "score", Value: bson.D{{Key: "bsonType", Value: "double"}, {Key: "maximum", Value: 1.5}}},
+			{Key: "role", Value: bson.D{{Key: "bsonType", Value: "string"}, {Key: "enum", Value: bson.A{"admin", "member"}}}},
+			{Key: "level", Value: bson.D{{Key: "bsonType", Value: "int"}, {Key: "enum", Value: bson.A{int64(1), int64(2)}}}},
+			{Key: "email", Value: bson.D{{Key: "bsonType", Value: "string"}, {Key: "pattern", Value: "^[a-z]{1,3},@"}}},
+			{Key: "tags", Value: bson.D{
+				{Key: "bsonType", Value: bson.A{"null", "array"}},
+				{Key: "items", Value: bson.D{{Key: "bsonType", Value: "string"}}},
+				{Key: "maxItems", Value: int64(10)},
+			}},
+			{Key: "address", Value: bson.D{
+				{Key: "bsonType", Value: bson.A{"null", "object"}},
+				{Key: "required", Value: bson.A{"city"}},
+				{Key: "properties", Value: bson.D{
+					{Key: "city", Value: bson.D{{Key: "bsonType", Value: "string"}, {Key: "minLength", Value: int64(1)}}},
+				}},
+			}},
+			{Key: "labels", Value: bson.D{
+				{Key: "bsonType", Value: bson.A{"null", "object"}},
+				{Key: "additionalProperties", Value: bson.D{{Key: "bsonType", Value: "bool"}}},
+			}},
+			{Key: "deletedAt", Value: bson.D{{Key: "bsonType", Value: bson.A{"null", "date"}}}},
+			{Key: "data", Value: bson.D{{Key: "bsonType", Value: bson.A{"null", "binData"}}}},
+			{Key: "extra", Value: bson.D{}},
+			{Key: "tree", Value: bson.D{
+				{Key: "bsonType", Value: "object"},
+				{Key: "required", Value: bson.A{"children"}},
+				{Key: "properties", Value: bson.D{
+					{Key: "children", Value: bson.D{
+						{Key: "bsonType", Value: bson.A{"null", "array"}},
+						{Key: "items", Value: bson.D{{Key: "bsonType", Value: "object"}}},
+					}},
+				}},
+			}},
+			{Key: "raw", Value: bson.D{
+				{Key: "bsonType", Value: bson.A{"null", "object"}},
+				{Key: "additionalProperties", Value: bson.D{}},
+			}},
+			{Key: "nested", Value: bson.D{
+				{Key: "bsonType", Value: bson.A{"null", "object"}},
+				{Key: "additionalProperties", Value: bson.D{
+					{Key: "bsonType", Value: bson.A{"null", "array"}},
+					{Key: "items", Value: bson.D{{Key: "bsonType", Value: "int"}}},
+				}},
+			}},
+		}},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Schema() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestSchema_nullableEnum(t *testing.T) {
+	type Ticket struct {
+		Status   *string `bson:"status" schema:"enum=open|closed"`
+		Priority *int    `bson:"priority,omitempty" schema:"enum=1|2"`
+	}
+
+	got, err := Schema(reflect.TypeOf(Ticket{}))
+	if err != nil {
+		t.Fatalf("Schema() error = %v", err)
+	}
+
+	want := bson.D{
+		{Key: "bsonType", Value: "object"},
+		{Key: "required", Value: bson.A{"status"}},
+		{Key: "properties", Value: bson.D{
+			{Key: "status", Value: bson.D{
+				{Key: "bsonType", Value: bson.A{"null", "string"}},
+				{Key: "enum", Value: bson.A{"open", "closed", nil}},
+			}},
+			{Key: "priority", Value: bson.D{
+				{Key: "bsonType", Value: bson.A{"null", "int", "long"}},
+				{Key: "enum", Value: bson.A{int64(1), int64(2), nil}},
+			}},
+		}},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Schema() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestSchema_namedInline(t *testing.T) {
+	type Audit struct {
+		CreatedBy string `bson:"createdBy"`
+	}
+	type Revision struct {
+		Version int64 `bson:"version"`
+	}
+	type Document struct {
+		Name     string    `bson:"name"`
+		Audit    Audit     `bson:",inline"`
+		Revision *Revision `bson:",inline"`
+	}
+
+	got, err := Schema(reflect.TypeOf(Document{}))
+	if err != nil {
+		t.Fatalf("Schema() error = %v", err)
+	}
+
+	want := bson.D{
+		{Key: "bsonType", Value: "object"},
+		{Key: "required", Value: bson.A{"name", "createdBy"}},
+		{Key: "properties", Value: bson.D{
+			{Key: "name", Value: bson.D{{Key: "bsonType", Value: "string"}}},
+			{Key: "createdBy", Value: bson.D{{Key: "bsonType", Value: "string"}}},
+			{Key: "version", Value: bson.D{{Key: "bsonType", Value: bson.A{"int", "long"}}}},
+		}},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Schema() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestSchema_InvalidTags(t *testing.T) {
+	tests := []struct {
+		name  string
+		model any
+		want  string
+	}{
+		{
+			name: "unknown option",
+			model: struct {
+				Name string `schema:"length=3"`
+			}{},
+			want: `unknown schema option "length"`,
+		},
+		{
+			name: "invalid bound",
+			model: struct {
+				Name string `schema:"min=a"`
+			}{},
+			want: `invalid schema min "a"`,
+		},
+		{
+			name: "fractional length",
+			model: struct {
+				Name string `schema:"max=1.5"`
+			}{},
+			want: `invalid schema max "1.5"`,
+		},
+		{
+			name: "invalid enum",
+			model: struct {
+				Count int `schema:"enum=1|two"`
+			}{},
+			want: `invalid schema enum value "two"`,
+		},
+		{
+			name: "unsupported type",
+			model: struct {
+				Fn func()
+			}{},
+			want: "cannot be described",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Schema(reflect.TypeOf(tt.model))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Schema() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
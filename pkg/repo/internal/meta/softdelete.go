@@ -0,0 +1,36 @@
+package meta
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SoftDelete reports whether documents of the model are soft deleted.
+func (m *Model) SoftDelete() bool {
+	return m.DeletedAt != nil
+}
+
+// NotDeleted returns a filter matching the documents that are not soft deleted,
+// or nil when the model is not soft deleted.
+func (m *Model) NotDeleted() any {
+	if m.DeletedAt == nil {
+		return nil
+	}
+	return bson.D{{Key: m.DeletedAt.Name, Value: bson.D{{Key: "$exists", Value: false}}}}
+}
+
+// Deleted returns a filter matching the documents soft deleted at or before the given time.
+func (m *Model) Deleted(before time.Time) bson.D {
+	return bson.D{{Key: m.DeletedAt.Name, Value: bson.D{{Key: "$lte", Value: before}}}}
+}
+
+// DeleteUpdate returns the update that soft deletes documents.
+func (m *Model) DeleteUpdate(now time.Time) bson.D {
+	return bson.D{{Key: "$set", Value: bson.D{{Key: m.DeletedAt.Name, Value: now}}}}
+}
+
+// RestoreUpdate returns the update that restores soft deleted documents.
+func (m *Model) RestoreUpdate() bson.D {
+	return bson.D{{Key: "$unset", Value: bson.D{{Key: m.DeletedAt.Name, Value: ""}}}}
+}
@@ -0,0 +1,199 @@
+package meta
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// StampInsert sets the createdAt field of the document, unless it is already set, and its updatedAt field.
+// document must be a pointer to the model, so that models used by value can be stamped too.
+func (m *Model) StampInsert(document any, now time.Time) {
+	if m.CreatedAt == nil && m.UpdatedAt == nil {
+		return
+	}
+
+	v, ok := value(document)
+	if !ok {
+		return
+	}
+
+	if m.CreatedAt != nil {
+		if field, err := v.FieldByIndexErr(m.CreatedAt.Index); err != nil || isZero(field) {
+			setTime(fieldByIndex(v, m.CreatedAt.Index), now)
+		}
+	}
+
+	if m.UpdatedAt != nil {
+		setTime(fieldByIndex(v, m.UpdatedAt.Index), now)
+	}
+}
+
+// StampReplace stamps the replacement of a replace like StampInsert, and returns what to replace the stored document
+// with: the document itself when the model has no createdAt field, otherwise an update pipeline replacing the stored
+// document with it, but keeping the createdAt field of the stored document when it has one.
+func (m *Model) StampReplace(document any, now time.Time) (any, error) {
+	m.StampInsert(document, now)
+	if m.CreatedAt == nil {
+		return document, nil
+	}
+
+	doc, err := toD(document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stamp replacement: %w", err)
+	}
+
+	var createdAt any = now
+	for _, e := range doc {
+		if e.Key == m.CreatedAt.Name {
+			createdAt = e.Value
+		}
+	}
+
+	return mongo.Pipeline{{{Key: "$replaceWith", Value: bson.D{{Key: "$mergeObjects", Value: bson.A{
+		bson.D{{Key: "$literal", Value: doc}},
+		bson.D{{Key: m.CreatedAt.Name, Value: bson.D{
+			{Key: "$ifNull", Value: bson.A{"$" + m.CreatedAt.Name, createdAt}},
+		}}},
+	}}}}}}, nil
+}
+
+// StampUpdate returns a copy of the update that also sets the updatedAt field, and the createdAt field when an upsert
+// inserts a document. Fields the update already modifies are left alone.
+// Update documents are returned as bson.D, and pipelines, which get an extra $set stage, as bson.A or mongo.Pipeline.
+func (m *Model) StampUpdate(update any, now time.Time, upsert bool) (any, error) {
+	var createdAt = m.CreatedAt != nil && upsert
+	if m.UpdatedAt == nil && !createdAt {
+		return update, nil
+	}
+
+	switch u := update.(type) {
+	case mongo.Pipeline:
+		return append(mongo.Pipeline(nil), append(u, m.stampStages(now, createdAt)...)...), nil
+	case bson.D, bson.M, map[string]any, bson.Raw:
+	default:
+		if v := reflect.ValueOf(update); v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+			var stages = make(bson.A, 0, v.Len()+2)
+			for i := 0; i < v.Len(); i++ {
+				stages = append(stages, v.Index(i).Interface())
+			}
+			for _, stage := range m.stampStages(now, createdAt) {
+				stages = append(stages, stage)
+			}
+			return stages, nil
+		}
+	}
+
+	doc, err := toD(update)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stamp update: %w", err)
+	}
+
+	if m.UpdatedAt != nil && !modifies(doc, m.UpdatedAt.Name) {
+		doc, err = withField(doc, "$set", m.UpdatedAt.Name, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stamp update: %w", err)
+		}
+	}
+
+	if createdAt && !modifies(doc, m.CreatedAt.Name) {
+		doc, err = withField(doc, "$setOnInsert", m.CreatedAt.Name, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stamp update: %w", err)
+		}
+	}
+
+	return doc, nil
+}
+
+func (m *Model) stampStages(now time.Time, createdAt bool) []bson.D {
+	var set = bson.D{}
+	if m.UpdatedAt != nil {
+		set = append(set, bson.E{Key: m.UpdatedAt.Name, Value: now})
+	}
+	if createdAt {
+		set = append(set, bson.E{Key: m.CreatedAt.Name, Value: bson.D{
+			{Key: "$ifNull", Value: bson.A{"$" + m.CreatedAt.Name, now}},
+		}})
+	}
+	return []bson.D{{{Key: "$set", Value: set}}}
+}
+
+// modifies reports whether any operator of the update document modifies the field.
+func modifies(doc bson.D, name string) bool {
+	for _, e := range doc {
+		fields, err := toD(e.Value)
+		if err != nil {
+			continue
+		}
+		for _, f := range fields {
+			if f.Key == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withField returns a copy of the update document with the field added to the given operator.
+func withField(doc bson.D, operator string, name string, v any) (bson.D, error) {
+	var result = make(bson.D, 0, len(doc)+1)
+	var found bool
+
+	for _, e := range doc {
+		if e.Key == operator {
+			fields, err := toD(e.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", operator, err)
+			}
+			e.Value = append(append(bson.D(nil), fields...), bson.E{Key: name, Value: v})
+			found = true
+		}
+		result = append(result, e)
+	}
+
+	if !found {
+		result = append(result, bson.E{Key: operator, Value: bson.D{{Key: name, Value: v}}})
+	}
+
+	return result, nil
+}
+
+// toD converts a document to a bson.D, sorting the keys of maps so that the result is deterministic.
+func toD(document any) (bson.D, error) {
+	switch d := document.(type) {
+	case bson.D:
+		return d, nil
+	case bson.M:
+		return mapToD(d), nil
+	case map[string]any:
+		return mapToD(d), nil
+	}
+
+	raw, err := bson.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc bson.D
+	err = bson.Unmarshal(raw, &doc)
+	return doc, err
+}
+
+func mapToD(m map[string]any) bson.D {
+	var keys = make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var doc = make(bson.D, len(keys))
+	for i, k := range keys {
+		doc[i] = bson.E{Key: k, Value: m[k]}
+	}
+	return doc
+}
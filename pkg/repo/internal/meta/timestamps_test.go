@@ -0,0 +1,240 @@
+package meta
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Base struct {
+	CreatedAt time.Time `bson:"createdAt" repo:"createdAt"`
+}
+
+type Stamped struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Base      `bson:",inline"`
+	UpdatedAt *time.Time `bson:"modified,omitempty" repo:"updatedAt"`
+}
+
+type Invalid struct {
+	CreatedAt string `repo:"createdAt"`
+}
+
+type InvalidDeletedAt struct {
+	DeletedAt *time.Time `bson:"deletedAt" repo:"deletedAt"`
+}
+
+func TestOf(t *testing.T) {
+	var m = For[*Stamped]()
+	if m.Err != nil {
+		t.Fatalf("For() error = %v", m.Err)
+	}
+	if m.CreatedAt == nil || m.CreatedAt.Name != "createdAt" || !reflect.DeepEqual(m.CreatedAt.Index, []int{1, 0}) {
+		t.Errorf("For() createdAt = %+v", m.CreatedAt)
+	}
+	if m.UpdatedAt == nil || m.UpdatedAt.Name != "modified" {
+		t.Errorf("For() updatedAt = %+v", m.UpdatedAt)
+	}
+
+	if For[Invalid]().Err == nil {
+		t.Errorf("For() expected an error for a timestamp tag on a string field")
+	}
+
+	if For[InvalidDeletedAt]().Err == nil {
+		t.Errorf("For() expected an error for a deletedAt field without omitempty")
+	}
+}
+
+func TestModel_StampInsert(t *testing.T) {
+	var now = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var created = now.Add(-time.Hour)
+
+	var document = &Stamped{Base: Base{CreatedAt: created}}
+	For[*Stamped]().StampInsert(&document, now)
+
+	if !document.CreatedAt.Equal(created) {
+		t.Errorf("StampInsert() createdAt = %v, want %v", document.CreatedAt, created)
+	}
+	if document.UpdatedAt == nil || !document.UpdatedAt.Equal(now) {
+		t.Errorf("StampInsert() updatedAt = %v, want %v", document.UpdatedAt, now)
+	}
+
+	var value Stamped
+	For[Stamped]().StampInsert(&value, now)
+	if !value.CreatedAt.Equal(now) {
+		t.Errorf("StampInsert() createdAt = %v, want %v", value.CreatedAt, now)
+	}
+}
+
+type Audit struct {
+	CreatedAt time.Time  `bson:"createdAt" repo:"createdAt"`
+	DeletedAt *time.Time `bson:"deletedAt,omitempty" repo:"deletedAt"`
+}
+
+type Revision struct {
+	UpdatedAt time.Time `bson:"updatedAt" repo:"updatedAt"`
+	Version   int64     `bson:"version" repo:"version"`
+}
+
+type NamedInline struct {
+	ID       primitive.ObjectID `bson:"_id"`
+	Audit    Audit              `bson:",inline"`
+	Revision *Revision          `bson:",inline"`
+	Owner    string             `bson:"owner"`
+}
+
+func TestOf_namedInline(t *testing.T) {
+	var m = For[*NamedInline]()
+	if m.Err != nil {
+		t.Fatalf("For() error = %v", m.Err)
+	}
+	if m.CreatedAt == nil || !reflect.DeepEqual(m.CreatedAt.Index, []int{1, 0}) {
+		t.Errorf("For() createdAt = %+v", m.CreatedAt)
+	}
+	if m.DeletedAt == nil || m.DeletedAt.Name != "deletedAt" {
+		t.Errorf("For() deletedAt = %+v", m.DeletedAt)
+	}
+	if m.UpdatedAt == nil || !reflect.DeepEqual(m.UpdatedAt.Index, []int{2, 0}) {
+		t.Errorf("For() updatedAt = %+v", m.UpdatedAt)
+	}
+	if m.Version == nil || m.Version.Name != "version" {
+		t.Errorf("For() version = %+v", m.Version)
+	}
+
+	var now = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var document = &NamedInline{}
+	m.StampInsert(document, now)
+	if !document.Audit.CreatedAt.Equal(now) || document.Revision == nil || !document.Revision.UpdatedAt.Equal(now) {
+		t.Errorf("StampInsert() = %+v, %+v, want both timestamps set", document.Audit, document.Revision)
+	}
+	if m.VersionOf(&NamedInline{}) != 0 {
+		t.Errorf("VersionOf() of a nil inline struct, want 0")
+	}
+
+	var scoped = &NamedInline{}
+	err := SetFields(scoped, bson.D{{Key: "owner", Value: "alice"}, {Key: "version", Value: int64(3)}})
+	if err != nil || scoped.Owner != "alice" || scoped.Revision == nil || scoped.Revision.Version != 3 {
+		t.Errorf("SetFields() = %+v, %v, want the inline version set", scoped, err)
+	}
+
+	if !reflect.DeepEqual(omitemptyFields(reflect.TypeOf(NamedInline{})), []string{"deletedAt"}) {
+		t.Errorf("omitemptyFields() = %v, want deletedAt", omitemptyFields(reflect.TypeOf(NamedInline{})))
+	}
+}
+
+func TestModel_StampUpdate(t *testing.T) {
+	var now = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var m = For[*Stamped]()
+
+	tests := []struct {
+		name   string
+		update any
+		upsert bool
+		want   any
+	}{
+		{
+			name:   "bson.M",
+			update: bson.M{"$set": bson.M{"name": "a"}, "$inc": bson.M{"n": 1}},
+			want: bson.D{
+				{Key: "$inc", Value: bson.M{"n": 1}},
+				{Key: "$set", Value: bson.D{{Key: "name", Value: "a"}, {Key: "modified", Value: now}}},
+			},
+		},
+		{
+			name:   "bson.D without $set",
+			update: bson.D{{Key: "$inc", Value: bson.D{{Key: "n", Value: 1}}}},
+			want: bson.D{
+				{Key: "$inc", Value: bson.D{{Key: "n", Value: 1}}},
+				{Key: "$set", Value: bson.D{{Key: "modified", Value: now}}},
+			},
+		},
+		{
+			name:   "field already modified",
+			update: bson.D{{Key: "$currentDate", Value: bson.D{{Key: "modified", Value: true}}}},
+			want:   bson.D{{Key: "$currentDate", Value: bson.D{{Key: "modified", Value: true}}}},
+		},
+		{
+			name:   "upsert",
+			update: bson.M{"$set": bson.M{"name": "a"}},
+			upsert: true,
+			want: bson.D{
+				{Key: "$set", Value: bson.D{{Key: "name", Value: "a"}, {Key: "modified", Value: now}}},
+				{Key: "$setOnInsert", Value: bson.D{{Key: "createdAt", Value: now}}},
+			},
+		},
+		{
+			name:   "pipeline",
+			update: mongo.Pipeline{{{Key: "$set", Value: bson.D{{Key: "name", Value: "a"}}}}},
+			upsert: true,
+			want: mongo.Pipeline{
+				{{Key: "$set", Value: bson.D{{Key: "name", Value: "a"}}}},
+				{{Key: "$set", Value: bson.D{
+					{Key: "modified", Value: now},
+					{Key: "createdAt", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$createdAt", now}}}},
+				}}},
+			},
+		},
+		{
+			name:   "pipeline as bson.A",
+			update: bson.A{bson.D{{Key: "$set", Value: bson.D{{Key: "name", Value: "a"}}}}},
+			want: bson.A{
+				bson.D{{Key: "$set", Value: bson.D{{Key: "name", Value: "a"}}}},
+				bson.D{{Key: "$set", Value: bson.D{{Key: "modified", Value: now}}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := m.StampUpdate(tt.update, now, tt.upsert)
+			if err != nil {
+				t.Fatalf("StampUpdate() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("StampUpdate() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModel_StampReplace(t *testing.T) {
+	var now = time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	var created = now.Add(-time.Hour)
+
+	var document = &Stamped{ID: primitive.NewObjectID(), Base: Base{CreatedAt: created}}
+	got, err := For[*Stamped]().StampReplace(document, now)
+	if err != nil {
+		t.Fatalf("StampReplace() error = %v", err)
+	}
+
+	if document.UpdatedAt == nil || !document.UpdatedAt.Equal(now) {
+		t.Errorf("StampReplace() updatedAt = %v, want %v", document.UpdatedAt, now)
+	}
+
+	var want = mongo.Pipeline{{{Key: "$replaceWith", Value: bson.D{{Key: "$mergeObjects", Value: bson.A{
+		bson.D{{Key: "$literal", Value: bson.D{
+			{Key: "_id", Value: document.ID},
+			{Key: "createdAt", Value: primitive.NewDateTimeFromTime(created)},
+			{Key: "modified", Value: primitive.NewDateTimeFromTime(now)},
+		}}},
+		bson.D{{Key: "createdAt", Value: bson.D{
+			{Key: "$ifNull", Value: bson.A{"$createdAt", primitive.NewDateTimeFromTime(created)}},
+		}}},
+	}}}}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("StampReplace() got = %v, want %v", got, want)
+	}
+
+	type Plain struct {
+		Name string `bson:"name"`
+	}
+	var plain = &Plain{Name: "a"}
+	got, err = For[*Plain]().StampReplace(plain, now)
+	if err != nil || got != any(plain) {
+		t.Errorf("StampReplace() = %v, %v, want the document", got, err)
+	}
+}
@@ -0,0 +1,137 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// VersionOf returns the version of the document.
+func (m *Model) VersionOf(document any) int64 {
+	v, ok := value(document)
+	if !ok || m.Version == nil {
+		return 0
+	}
+	field, err := v.FieldByIndexErr(m.Version.Index)
+	if err != nil {
+		return 0
+	}
+	return field.Int()
+}
+
+// SetVersion sets the version of the document.
+func (m *Model) SetVersion(document any, version int64) {
+	v, ok := value(document)
+	if !ok || m.Version == nil {
+		return
+	}
+	fieldByIndex(v, m.Version.Index).SetInt(version)
+}
+
+// Touch sets the updatedAt field of the document.
+func (m *Model) Touch(document any, now time.Time) {
+	v, ok := value(document)
+	if !ok || m.UpdatedAt == nil {
+		return
+	}
+	setTime(fieldByIndex(v, m.UpdatedAt.Index), now)
+}
+
+// SaveVersioned returns the filter and update that replace the fields of the stored document with those of the
+// given one, and increment its version, provided its stored version is still the version of the given document.
+// A version of 0 also matches stored documents without a version, e.g. those inserted before the field was added.
+// omitempty fields left out of the encoding are unset. createdAt is never overwritten, since the given document may
+// not carry it, and is only set when an upsert inserts the document.
+func (m *Model) SaveVersioned(document any) (id any, filter bson.D, update bson.D, err error) {
+	if m.Version == nil {
+		return nil, nil, nil, errors.New("model has no field tagged repo:\"version\"")
+	}
+
+	doc, err := toD(document)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var encoded = make(map[string]bool, len(doc))
+	var set, setOnInsert = bson.D{}, bson.D{}
+	for _, e := range doc {
+		encoded[e.Key] = true
+		switch {
+		case e.Key == "_id":
+			id = e.Value
+		case e.Key == m.Version.Name:
+		case m.CreatedAt != nil && e.Key == m.CreatedAt.Name:
+			if field, err := reflectField(document, m.CreatedAt.Index); err == nil && !isZero(field) {
+				setOnInsert = append(setOnInsert, e)
+			}
+		default:
+			set = append(set, e)
+		}
+	}
+
+	if id == nil {
+		return nil, nil, nil, fmt.Errorf("document has no _id")
+	}
+
+	var expected any = m.VersionOf(document)
+	if expected == int64(0) {
+		expected = bson.D{{Key: "$in", Value: bson.A{0, nil}}}
+	}
+
+	filter = bson.D{{Key: "_id", Value: id}, {Key: m.Version.Name, Value: expected}}
+	update = bson.D{{Key: "$inc", Value: bson.D{{Key: m.Version.Name, Value: 1}}}}
+
+	var unset = bson.D{}
+	if v, _ := value(document); v.Kind() == reflect.Struct {
+		for _, name := range omitemptyFields(v.Type()) {
+			if !encoded[name] && (m.CreatedAt == nil || name != m.CreatedAt.Name) {
+				unset = append(unset, bson.E{Key: name, Value: ""})
+			}
+		}
+	}
+	if len(setOnInsert) > 0 {
+		update = append(bson.D{{Key: "$setOnInsert", Value: setOnInsert}}, update...)
+	}
+	if len(unset) > 0 {
+		update = append(bson.D{{Key: "$unset", Value: unset}}, update...)
+	}
+
+	if len(set) > 0 {
+		update = append(bson.D{{Key: "$set", Value: set}}, update...)
+	}
+
+	return id, filter, update, nil
+}
+
+// reflectField returns the field of the document with the index sequence.
+func reflectField(document any, index []int) (reflect.Value, error) {
+	v, ok := value(document)
+	if !ok {
+		return reflect.Value{}, errors.New("document is not a struct")
+	}
+	return v.FieldByIndexErr(index)
+}
+
+// omitemptyFields returns the names of the omitempty fields of a struct, looking into inlined structs.
+func omitemptyFields(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		name, inline, omitempty, skip := bsonName(t.Field(i))
+		if skip {
+			continue
+		}
+
+		if inline {
+			names = append(names, omitemptyFields(structType(t.Field(i).Type))...)
+			continue
+		}
+
+		if omitempty {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,98 @@
+package meta
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Versioned struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Name      string             `bson:"name"`
+	Nickname  string             `bson:"nickname,omitempty"`
+	CreatedAt *time.Time         `bson:"createdAt,omitempty" repo:"createdAt"`
+	Version   int64              `bson:"version" repo:"version"`
+}
+
+func TestModel_SaveVersioned(t *testing.T) {
+	var id = primitive.NewObjectID()
+	var created = time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		document *Versioned
+		want     bson.D
+	}{
+		{
+			name:     "set",
+			document: &Versioned{ID: id, Name: "apple", Nickname: "green", Version: 2},
+			want: bson.D{
+				{Key: "$set", Value: bson.D{{Key: "name", Value: "apple"}, {Key: "nickname", Value: "green"}}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+			},
+		},
+		{
+			name:     "cleared omitempty field",
+			document: &Versioned{ID: id, Name: "apple", Version: 2},
+			want: bson.D{
+				{Key: "$set", Value: bson.D{{Key: "name", Value: "apple"}}},
+				{Key: "$unset", Value: bson.D{{Key: "nickname", Value: ""}}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+			},
+		},
+		{
+			name:     "createdAt",
+			document: &Versioned{ID: id, Name: "apple", Nickname: "green", CreatedAt: &created, Version: 2},
+			want: bson.D{
+				{Key: "$set", Value: bson.D{{Key: "name", Value: "apple"}, {Key: "nickname", Value: "green"}}},
+				{Key: "$setOnInsert", Value: bson.D{{Key: "createdAt", Value: primitive.NewDateTimeFromTime(created)}}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotID, filter, update, err := For[*Versioned]().SaveVersioned(tt.document)
+			if err != nil {
+				t.Fatalf("SaveVersioned() error = %v", err)
+			}
+			if gotID != id {
+				t.Errorf("SaveVersioned() id = %v, want %v", gotID, id)
+			}
+
+			var wantFilter = bson.D{{Key: "_id", Value: id}, {Key: "version", Value: int64(2)}}
+			if !reflect.DeepEqual(filter, wantFilter) {
+				t.Errorf("SaveVersioned() filter = %v, want %v", filter, wantFilter)
+			}
+			if !reflect.DeepEqual(update, tt.want) {
+				t.Errorf("SaveVersioned() update = %v, want %v", update, tt.want)
+			}
+		})
+	}
+}
+
+func TestModel_SaveVersioned_zeroCreatedAt(t *testing.T) {
+	type Document struct {
+		ID        primitive.ObjectID `bson:"_id"`
+		Name      string             `bson:"name"`
+		CreatedAt time.Time          `bson:"createdAt" repo:"createdAt"`
+		Version   int64              `bson:"version" repo:"version"`
+	}
+
+	var document = &Document{ID: primitive.NewObjectID(), Name: "apple", Version: 1}
+	_, _, update, err := For[*Document]().SaveVersioned(document)
+	if err != nil {
+		t.Fatalf("SaveVersioned() error = %v", err)
+	}
+
+	var want = bson.D{
+		{Key: "$set", Value: bson.D{{Key: "name", Value: "apple"}}},
+		{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+	}
+	if !reflect.DeepEqual(update, want) {
+		t.Errorf("SaveVersioned() update = %v, want %v", update, want)
+	}
+}
@@ -0,0 +1,125 @@
+package repo
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LRUCache is an in-memory Cache holding up to a fixed number of entries, evicting the least recently used entry
+// when it is full. Entries also expire after the TTL they were set with.
+type LRUCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  *list.List // of *lruEntry, most recently used first.
+	keys     map[string]*list.Element
+	now      func() time.Time
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time // zero when the entry does not expire.
+}
+
+var (
+	_ Cache        = (*LRUCache)(nil)
+	_ CacheFlusher = (*LRUCache)(nil)
+)
+
+// NewLRUCache creates an LRUCache holding up to capacity entries.
+func NewLRUCache(capacity int) *LRUCache {
+	return &LRUCache{
+		capacity: capacity,
+		entries:  list.New(),
+		keys:     make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// Get returns the value set for the key, unless it expired or was evicted.
+func (c *LRUCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.keys[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	var entry = element.Value.(*lruEntry)
+	if !entry.expiresAt.IsZero() && !c.now().Before(entry.expiresAt) {
+		c.remove(element)
+		return nil, false, nil
+	}
+
+	c.entries.MoveToFront(element)
+	return append([]byte(nil), entry.value...), true, nil
+}
+
+// Set sets the value of the key, expiring after ttl, or never when ttl is 0.
+func (c *LRUCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var entry = &lruEntry{key: key, value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		entry.expiresAt = c.now().Add(ttl)
+	}
+
+	if element, ok := c.keys[key]; ok {
+		element.Value = entry
+		c.entries.MoveToFront(element)
+		return nil
+	}
+
+	c.keys[key] = c.entries.PushFront(entry)
+	for c.entries.Len() > c.capacity {
+		c.remove(c.entries.Back())
+	}
+
+	return nil
+}
+
+// Delete removes the keys.
+func (c *LRUCache) Delete(_ context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if element, ok := c.keys[key]; ok {
+			c.remove(element)
+		}
+	}
+
+	return nil
+}
+
+// DeletePrefix removes the keys starting with prefix.
+func (c *LRUCache) DeletePrefix(_ context.Context, prefix string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, element := range c.keys {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(element)
+		}
+	}
+
+	return nil
+}
+
+// Len returns the number of entries, including expired ones that were not accessed since they expired.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.entries.Len()
+}
+
+func (c *LRUCache) remove(element *list.Element) {
+	c.entries.Remove(element)
+	delete(c.keys, element.Value.(*lruEntry).key)
+}
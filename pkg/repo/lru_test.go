@@ -0,0 +1,72 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLRUCache(t *testing.T) {
+	var ctx = context.Background()
+	var now = time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	var cache = NewLRUCache(2)
+	cache.now = func() time.Time { return now }
+
+	var get = func(key string) string {
+		value, ok, err := cache.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get(%q) error = %v", key, err)
+		}
+		if !ok {
+			return "<none>"
+		}
+		return string(value)
+	}
+
+	_ = cache.Set(ctx, "a", []byte("1"), 0)
+	_ = cache.Set(ctx, "b", []byte("2"), time.Minute)
+
+	if got := get("a"); got != "1" {
+		t.Errorf("Get(a) = %s, want 1", got)
+	}
+
+	// b is the least recently used entry now
+	_ = cache.Set(ctx, "c", []byte("3"), 0)
+	if got := get("b"); got != "<none>" {
+		t.Errorf("Get(b) = %s, want it evicted", got)
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", cache.Len())
+	}
+
+	_ = cache.Set(ctx, "a", []byte("4"), time.Minute)
+	if got := get("a"); got != "4" {
+		t.Errorf("Get(a) = %s, want 4", got)
+	}
+
+	now = now.Add(time.Minute)
+	if got := get("a"); got != "<none>" {
+		t.Errorf("Get(a) = %s, want it expired", got)
+	}
+	if got := get("c"); got != "3" {
+		t.Errorf("Get(c) = %s, want 3", got)
+	}
+
+	_ = cache.Delete(ctx, "c", "missing")
+	if got := get("c"); got != "<none>" {
+		t.Errorf("Get(c) = %s, want it deleted", got)
+	}
+	if cache.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", cache.Len())
+	}
+
+	_ = cache.Set(ctx, "db.col:1", []byte("5"), 0)
+	_ = cache.Set(ctx, "db.other:1", []byte("6"), 0)
+	_ = cache.DeletePrefix(ctx, "db.col:")
+	if got := get("db.col:1"); got != "<none>" {
+		t.Errorf("Get(db.col:1) = %s, want it deleted", got)
+	}
+	if got := get("db.other:1"); got != "6" {
+		t.Errorf("Get(db.other:1) = %s, want 6", got)
+	}
+}
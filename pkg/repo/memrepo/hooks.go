@@ -0,0 +1,111 @@
+package memrepo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/AISystemsInc/mongo-resource-repo/pkg/repo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// the model hooks are called the same way repo.Repository calls them, so that code relying on them
+// behaves the same against both implementations.
+
+func hook[T any, M any](value *M) (T, bool) {
+	if h, ok := any(*value).(T); ok {
+		return h, true
+	}
+	h, ok := any(value).(T)
+	return h, ok
+}
+
+func newModel[M any]() M {
+	var value M
+	if t := reflect.TypeOf(value); t != nil && t.Kind() == reflect.Pointer {
+		return reflect.New(t.Elem()).Interface().(M)
+	}
+	return value
+}
+
+func beforeInsert[M any](ctx context.Context, document *M) error {
+	if h, ok := hook[repo.BeforeInserter](document); ok {
+		if err := h.BeforeInsert(ctx); err != nil {
+			return fmt.Errorf("%w: BeforeInsert: %w", repo.ErrHook, err)
+		}
+	}
+
+	if v, ok := hook[repo.Validator](document); ok {
+		if err := v.Validate(); err != nil {
+			return fmt.Errorf("%w: %w", repo.ErrValidation, err)
+		}
+	}
+
+	return nil
+}
+
+func afterInsert[M any](ctx context.Context, document *M) error {
+	if h, ok := hook[repo.AfterInserter](document); ok {
+		if err := h.AfterInsert(ctx); err != nil {
+			return fmt.Errorf("%w: AfterInsert: %w", repo.ErrHook, err)
+		}
+	}
+	return nil
+}
+
+func afterFind[M any](ctx context.Context, document *M) error {
+	if h, ok := hook[repo.AfterFinder](document); ok {
+		if err := h.AfterFind(ctx); err != nil {
+			return fmt.Errorf("%w: AfterFind: %w", repo.ErrHook, err)
+		}
+	}
+	return nil
+}
+
+func beforeUpdate[M any](ctx context.Context, filter any, update any) error {
+	var model = newModel[M]()
+	if h, ok := hook[repo.BeforeUpdater](&model); ok {
+		if err := h.BeforeUpdate(ctx, filter, update); err != nil {
+			return fmt.Errorf("%w: BeforeUpdate: %w", repo.ErrHook, err)
+		}
+	}
+	return nil
+}
+
+// beforeDelete calls BeforeDelete on the documents that match the filter, when the model implements
+// repo.BeforeDeleter, and returns a filter matching only those documents.
+func (r *Repository[M, I]) beforeDelete(ctx context.Context, filter any, many bool) (any, error) {
+	var model = newModel[M]()
+	if _, ok := hook[repo.BeforeDeleter](&model); !ok {
+		return filter, nil
+	}
+
+	var limit *int64
+	if !many {
+		var one int64 = 1
+		limit = &one
+	}
+
+	docs, err := r.query(filter, nil, nil, limit, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids = bson.A{}
+	for _, doc := range docs {
+		var value M
+		if err := decode(doc, &value); err != nil {
+			return nil, fmt.Errorf("failed to decode result: %w", err)
+		}
+
+		if h, ok := hook[repo.BeforeDeleter](&value); ok {
+			if err := h.BeforeDelete(ctx); err != nil {
+				return nil, fmt.Errorf("%w: BeforeDelete: %w", repo.ErrHook, err)
+			}
+		}
+
+		ids = append(ids, doc[0].Value)
+	}
+
+	return bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}, nil
+}
@@ -0,0 +1,387 @@
+package memrepo
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// matches reports whether the document satisfies the filter.
+func matches(doc bson.D, filter bson.D) (bool, error) {
+	for _, e := range filter {
+		var ok bool
+		var err error
+
+		switch e.Key {
+		case "$and", "$or", "$nor":
+			ok, err = matchLogical(doc, e.Key, e.Value)
+		case "$comment":
+			ok = true
+		default:
+			if strings.HasPrefix(e.Key, "$") {
+				return false, fmt.Errorf("%w: %s", ErrUnsupportedOperator, e.Key)
+			}
+			ok, err = matchField(doc, e.Key, e.Value)
+		}
+
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func matchLogical(doc bson.D, operator string, operand any) (bool, error) {
+	clauses, ok := operand.(bson.A)
+	if !ok || len(clauses) == 0 {
+		return false, fmt.Errorf("%s must be a nonempty array", operator)
+	}
+
+	for _, clause := range clauses {
+		sub, ok := clause.(bson.D)
+		if !ok {
+			return false, fmt.Errorf("%s entries must be documents", operator)
+		}
+
+		ok, err := matches(doc, sub)
+		if err != nil {
+			return false, err
+		}
+
+		switch {
+		case operator == "$and" && !ok:
+			return false, nil
+		case operator == "$or" && ok:
+			return true, nil
+		case operator == "$nor" && ok:
+			return false, nil
+		}
+	}
+
+	return operator != "$or", nil
+}
+
+func matchField(doc bson.D, path string, condition any) (bool, error) {
+	var values = resolve(doc, strings.Split(path, "."))
+
+	if operators, ok := isOperatorDocument(condition); ok {
+		return matchOperators(values, operators)
+	}
+
+	return matchEq(values, condition), nil
+}
+
+func matchOperators(values []any, operators bson.D) (bool, error) {
+	for _, op := range operators {
+		ok, err := matchOperator(values, op.Key, op.Value, operators)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// expand returns the values together with the elements of any array values,
+// since most query operators match an array when any of its elements match.
+func expand(values []any) []any {
+	var expanded = make([]any, 0, len(values))
+	for _, v := range values {
+		expanded = append(expanded, v)
+		if arr, ok := v.(bson.A); ok {
+			expanded = append(expanded, arr...)
+		}
+	}
+	return expanded
+}
+
+func matchEq(values []any, target any) bool {
+	if target == nil {
+		if len(values) == 0 {
+			return true
+		}
+		for _, v := range expand(values) {
+			if v == nil {
+				return true
+			}
+		}
+		return false
+	}
+
+	if re, ok := target.(primitive.Regex); ok {
+		ok, _ := matchRegex(values, re.Pattern, re.Options)
+		return ok
+	}
+
+	for _, v := range expand(values) {
+		if equal(v, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchCompare(values []any, target any, accept func(int) bool) bool {
+	for _, v := range expand(values) {
+		if typeOrder(v) != typeOrder(target) {
+			continue
+		}
+		if accept(compare(v, target)) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRegex(values []any, pattern, options string) (bool, error) {
+	var flags string
+	for _, o := range options {
+		switch o {
+		case 'i', 'm', 's':
+			flags += string(o)
+		case 'x', 'u':
+		default:
+			return false, fmt.Errorf("invalid regex option %q", o)
+		}
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+
+	for _, v := range expand(values) {
+		if s, ok := v.(string); ok && re.MatchString(s) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func matchOperator(values []any, operator string, operand any, siblings bson.D) (bool, error) {
+	switch operator {
+	case "$eq":
+		return matchEq(values, operand), nil
+	case "$ne":
+		return !matchEq(values, operand), nil
+	case "$gt":
+		return matchCompare(values, operand, func(c int) bool { return c > 0 }), nil
+	case "$gte":
+		return matchCompare(values, operand, func(c int) bool { return c >= 0 }), nil
+	case "$lt":
+		return matchCompare(values, operand, func(c int) bool { return c < 0 }), nil
+	case "$lte":
+		return matchCompare(values, operand, func(c int) bool { return c <= 0 }), nil
+	case "$in", "$nin":
+		candidates, ok := operand.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("%s needs an array", operator)
+		}
+		var found bool
+		for _, candidate := range candidates {
+			if matchEq(values, candidate) {
+				found = true
+				break
+			}
+		}
+		return found == (operator == "$in"), nil
+	case "$exists":
+		return (len(values) > 0) == truthy(operand), nil
+	case "$not":
+		if re, ok := operand.(primitive.Regex); ok {
+			ok, err := matchRegex(values, re.Pattern, re.Options)
+			return !ok, err
+		}
+		operators, ok := isOperatorDocument(operand)
+		if !ok {
+			return false, fmt.Errorf("$not needs a regex or a document")
+		}
+		ok, err := matchOperators(values, operators)
+		return !ok, err
+	case "$regex":
+		var options string
+		for _, s := range siblings {
+			if s.Key == "$options" {
+				options, _ = s.Value.(string)
+			}
+		}
+		switch re := operand.(type) {
+		case string:
+			return matchRegex(values, re, options)
+		case primitive.Regex:
+			if options == "" {
+				options = re.Options
+			}
+			return matchRegex(values, re.Pattern, options)
+		}
+		return false, fmt.Errorf("$regex has to be a string")
+	case "$options":
+		return true, nil
+	case "$size":
+		if !isNumber(operand) {
+			return false, fmt.Errorf("$size needs a number")
+		}
+		for _, v := range values {
+			if arr, ok := v.(bson.A); ok && float64(len(arr)) == toFloat(operand) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$all":
+		candidates, ok := operand.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("$all needs an array")
+		}
+		if len(candidates) == 0 {
+			return false, nil
+		}
+		for _, candidate := range candidates {
+			if !matchEq(values, candidate) {
+				return false, nil
+			}
+		}
+		return true, nil
+	case "$elemMatch":
+		query, ok := operand.(bson.D)
+		if !ok {
+			return false, fmt.Errorf("$elemMatch needs an Object")
+		}
+		for _, v := range values {
+			arr, ok := v.(bson.A)
+			if !ok {
+				continue
+			}
+			for _, el := range arr {
+				ok, err := matchElement(el, query)
+				if err != nil {
+					return false, err
+				}
+				if ok {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	case "$type":
+		var aliases bson.A
+		if arr, ok := operand.(bson.A); ok {
+			aliases = arr
+		} else {
+			aliases = bson.A{operand}
+		}
+		for _, v := range expand(values) {
+			for _, alias := range aliases {
+				if hasType(v, alias) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	case "$mod":
+		args, ok := operand.(bson.A)
+		if !ok || len(args) != 2 || !isNumber(args[0]) || !isNumber(args[1]) || toFloat(args[0]) == 0 {
+			return false, fmt.Errorf("malformed mod, needs to be an array of [divisor, remainder]")
+		}
+		for _, v := range expand(values) {
+			if isNumber(v) && math.Mod(math.Trunc(toFloat(v)), math.Trunc(toFloat(args[0]))) == math.Trunc(toFloat(args[1])) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	return false, fmt.Errorf("%w: %s", ErrUnsupportedOperator, operator)
+}
+
+// matchElement evaluates an $elemMatch query against a single array element.
+// The query is either a set of operators applied to the element itself, or a filter applied to an embedded document.
+func matchElement(element any, query bson.D) (bool, error) {
+	if operators, ok := isOperatorDocument(query); ok {
+		return matchOperators([]any{element}, operators)
+	}
+
+	doc, ok := element.(bson.D)
+	if !ok {
+		return false, nil
+	}
+	return matches(doc, query)
+}
+
+func truthy(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case int32, int64, float64, primitive.Decimal128:
+		return toFloat(t) != 0
+	}
+	return true
+}
+
+func hasType(v any, alias any) bool {
+	var name string
+	switch a := alias.(type) {
+	case string:
+		name = a
+	case int32, int64, float64:
+		name = map[int64]string{
+			1: "double", 2: "string", 3: "object", 4: "array", 5: "binData", 7: "objectId",
+			8: "bool", 9: "date", 10: "null", 11: "regex", 16: "int", 17: "timestamp", 18: "long", 19: "decimal",
+		}[int64(toFloat(a))]
+	}
+
+	switch name {
+	case "number":
+		return isNumber(v)
+	case "double":
+		_, ok := v.(float64)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "object":
+		_, ok := v.(bson.D)
+		return ok
+	case "array":
+		_, ok := v.(bson.A)
+		return ok
+	case "binData":
+		_, ok := v.(primitive.Binary)
+		return ok
+	case "objectId":
+		_, ok := v.(primitive.ObjectID)
+		return ok
+	case "bool":
+		_, ok := v.(bool)
+		return ok
+	case "date":
+		_, ok := v.(primitive.DateTime)
+		return ok
+	case "null":
+		return v == nil
+	case "regex":
+		_, ok := v.(primitive.Regex)
+		return ok
+	case "int":
+		_, ok := v.(int32)
+		return ok
+	case "timestamp":
+		_, ok := v.(primitive.Timestamp)
+		return ok
+	case "long":
+		_, ok := v.(int64)
+		return ok
+	case "decimal":
+		_, ok := v.(primitive.Decimal128)
+		return ok
+	}
+	return false
+}
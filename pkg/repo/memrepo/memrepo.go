@@ -0,0 +1,792 @@
+// Package memrepo provides an in-memory implementation of repo.Store.
+//
+// It is meant for unit tests of code that depends on a repository: documents are kept in process,
+// and the common query operators ($eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, $exists, $not, $regex,
+// $size, $all, $elemMatch, $type, $mod, $and, $or, $nor) and update operators ($set, $setOnInsert,
+// $unset, $inc, $mul, $min, $max, $rename, $currentDate, $push, $addToSet, $pull, $pullAll, $pop)
+// are evaluated the same way MongoDB evaluates them.
+// Operators that are not supported result in an error wrapping ErrUnsupportedOperator.
+//
+// example:
+//
+//	var users repo.Store[*User, primitive.ObjectID] = memrepo.NewRepository[*User, primitive.ObjectID]()
+package memrepo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/AISystemsInc/mongo-resource-repo/pkg/repo"
+	"github.com/AISystemsInc/mongo-resource-repo/pkg/repo/internal/meta"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrUnsupportedOperator = fmt.Errorf("unsupported operator")
+)
+
+// Repository is an in-memory repository for a model.
+// It is safe for concurrent use.
+type Repository[M repo.Model, I any] struct {
+	mu             sync.RWMutex
+	documents      []bson.D
+	databaseName   string
+	collectionName string
+	settings       settings
+}
+
+// NewRepository creates a new, empty in-memory repository for a model.
+// e.g. usersRepo := NewRepository[*User, primitive.ObjectID]()
+func NewRepository[M repo.Model, I any](opts ...Option) *Repository[M, I] {
+	var v M
+	var r = &Repository[M, I]{
+		databaseName:   v.GetDatabaseName(),
+		collectionName: v.GetCollectionName(),
+	}
+
+	for _, opt := range opts {
+		opt(&r.settings)
+	}
+
+	return r
+}
+
+// FindOne returns the first document that matches the filter.
+func (r *Repository[M, I]) FindOne(
+	ctx context.Context,
+	filter any,
+	opts ...*options.FindOneOptions,
+) (M, error) {
+	var value M
+
+	if err := ctx.Err(); err != nil {
+		return value, fmt.Errorf("%w: %w", repo.ErrFindOne, err)
+	}
+
+	o := options.MergeFindOneOptions(opts...)
+
+	docs, err := r.query(r.visible(filter), o.Sort, o.Skip, nil, o.Projection)
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", repo.ErrFindOne, err)
+	}
+
+	if len(docs) == 0 {
+		return value, r.error("FindOne", fmt.Errorf("%w: %w", repo.ErrFindOne, mongo.ErrNoDocuments))
+	}
+
+	err = decode(docs[0], &value)
+	if err != nil {
+		return value, fmt.Errorf("%w: failed to decode result: %w", repo.ErrFindOne, err)
+	}
+
+	err = afterFind(ctx, &value)
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", repo.ErrFindOne, err)
+	}
+
+	return value, nil
+}
+
+// Find returns all documents that match the filter.
+func (r *Repository[M, I]) Find(
+	ctx context.Context,
+	filter any,
+	opts ...*options.FindOptions,
+) ([]M, error) {
+	return r.find(ctx, repo.ErrFind, r.visible(filter), opts...)
+}
+
+func (r *Repository[M, I]) find(
+	ctx context.Context,
+	sentinel error,
+	filter any,
+	opts ...*options.FindOptions,
+) ([]M, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", sentinel, err)
+	}
+
+	o := options.MergeFindOptions(opts...)
+
+	docs, err := r.query(filter, o.Sort, o.Skip, o.Limit, o.Projection)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", sentinel, err)
+	}
+
+	var values []M
+	for _, doc := range docs {
+		var value M
+		err := decode(doc, &value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decode results: %w", sentinel, err)
+		}
+		if err := afterFind(ctx, &value); err != nil {
+			return nil, fmt.Errorf("%w: %w", sentinel, err)
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// FindStream works like Find, but returns a channel of results and a channel of errors,
+// with the same semantics as repo.Repository.FindStream.
+func (r *Repository[M, I]) FindStream(
+	ctx context.Context,
+	filter any,
+	opts ...*options.FindOptions,
+) (chan M, chan error, chan struct{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: %w", repo.ErrFindStream, err)
+	}
+
+	o := options.MergeFindOptions(opts...)
+
+	docs, err := r.query(r.visible(filter), o.Sort, o.Skip, o.Limit, o.Projection)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: %w", repo.ErrFindStream, err)
+	}
+
+	var values = make(chan M)
+	var errors = make(chan error)
+	var cancel = make(chan struct{})
+
+	go func() {
+		defer close(values)
+		defer close(errors)
+
+		for _, doc := range docs {
+			var value M
+			var err = decode(doc, &value)
+			if err != nil {
+				err = fmt.Errorf("%w: failed to decode result: %w", repo.ErrFindStream, err)
+			} else if err = afterFind(ctx, &value); err != nil {
+				err = fmt.Errorf("%w: %w", repo.ErrFindStream, err)
+			}
+
+			if err != nil {
+				select {
+				case errors <- err:
+					continue
+				case <-cancel:
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case values <- value:
+			case <-cancel:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return values, errors, cancel, nil
+}
+
+// Iterate returns a Cursor over all documents that match the filter.
+func (r *Repository[M, I]) Iterate(
+	ctx context.Context,
+	filter any,
+	opts ...*options.FindOptions,
+) (*repo.Cursor[M], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", repo.ErrIterate, err)
+	}
+
+	o := options.MergeFindOptions(opts...)
+
+	docs, err := r.query(r.visible(filter), o.Sort, o.Skip, o.Limit, o.Projection)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", repo.ErrIterate, err)
+	}
+
+	var documents = make([]any, len(docs))
+	for i, doc := range docs {
+		documents[i] = doc
+	}
+
+	cursor, err := mongo.NewCursorFromDocuments(documents, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", repo.ErrIterate, err)
+	}
+
+	return repo.NewCursor[M](cursor), nil
+}
+
+// InsertOne inserts a single document into the collection.
+// Like the driver, an ObjectID is generated when the document has no _id.
+func (r *Repository[M, I]) InsertOne(
+	ctx context.Context,
+	document M,
+	opts ...*options.InsertOneOptions,
+) (I, error) {
+	var insertedID I
+
+	if err := ctx.Err(); err != nil {
+		return insertedID, fmt.Errorf("%w: %w", repo.ErrInsertOne, err)
+	}
+
+	var m = meta.For[M]()
+	if m.Err != nil {
+		return insertedID, fmt.Errorf("%w: %w", repo.ErrInsertOne, m.Err)
+	}
+	m.StampInsert(&document, r.settings.now())
+
+	err := beforeInsert(ctx, &document)
+	if err != nil {
+		return insertedID, fmt.Errorf("%w: %w", repo.ErrInsertOne, err)
+	}
+
+	doc, err := prepareInsert(document)
+	if err != nil {
+		return insertedID, fmt.Errorf("%w: %w", repo.ErrInsertOne, err)
+	}
+
+	insertedID, err = convertID[I](doc[0].Value)
+	if err != nil {
+		return insertedID, fmt.Errorf("%w: failed to convert inserted ID to %T", repo.ErrInsertOne, insertedID)
+	}
+
+	r.mu.Lock()
+	writeErr := r.insert(doc, 0)
+	r.mu.Unlock()
+
+	if writeErr != nil {
+		return insertedID, r.error("InsertOne", fmt.Errorf("%w: %w", repo.ErrInsertOne, mongo.WriteException{
+			WriteErrors: []mongo.WriteError{*writeErr},
+		}))
+	}
+
+	err = afterInsert(ctx, &document)
+	if err != nil {
+		return insertedID, fmt.Errorf("%w: %w", repo.ErrInsertOne, err)
+	}
+
+	return insertedID, nil
+}
+
+// InsertMany inserts multiple documents into the collection.
+// Like the driver, documents are inserted in order and the insert stops at the first error,
+// unless the Ordered option is set to false. Like repo.Repository, the IDs of the inserted documents are returned
+// along with an error wrapping a *repo.BulkError when some documents could not be inserted.
+func (r *Repository[M, I]) InsertMany(
+	ctx context.Context,
+	documents []M,
+	opts ...*options.InsertManyOptions,
+) ([]I, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", repo.ErrInsertMany, err)
+	}
+
+	if len(documents) == 0 {
+		return nil, fmt.Errorf("%w: %w", repo.ErrInsertMany, mongo.ErrEmptySlice)
+	}
+
+	o := options.MergeInsertManyOptions(opts...)
+	var ordered = o.Ordered == nil || *o.Ordered
+
+	var m = meta.For[M]()
+	if m.Err != nil {
+		return nil, fmt.Errorf("%w: %w", repo.ErrInsertMany, m.Err)
+	}
+
+	var now = r.settings.now()
+	var docs = make([]bson.D, len(documents))
+	var insertedIDs = make([]I, len(documents))
+	for i := range documents {
+		m.StampInsert(&documents[i], now)
+
+		err := beforeInsert(ctx, &documents[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: document %d: %w", repo.ErrInsertMany, i, err)
+		}
+
+		doc, err := prepareInsert(documents[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", repo.ErrInsertMany, err)
+		}
+
+		insertedIDs[i], err = convertID[I](doc[0].Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to convert inserted ID to type %T", repo.ErrInsertMany, insertedIDs[i])
+		}
+
+		docs[i] = doc
+	}
+
+	r.mu.Lock()
+	var writeErrors []mongo.BulkWriteError
+	for i, doc := range docs {
+		if err := r.insert(doc, i); err != nil {
+			writeErrors = append(writeErrors, mongo.BulkWriteError{WriteError: *err})
+			if ordered {
+				break
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	if len(writeErrors) > 0 {
+		var bulkErr = repo.NewBulkError(
+			"InsertMany",
+			repo.Namespace{Database: r.databaseName, Collection: r.collectionName},
+			len(documents),
+			ordered,
+			mongo.BulkWriteException{WriteErrors: writeErrors},
+		)
+
+		var zero I
+		for _, i := range bulkErr.Failed() {
+			insertedIDs[i] = zero
+		}
+		return insertedIDs, r.error("InsertMany", fmt.Errorf("%w: %w", repo.ErrInsertMany, bulkErr))
+	}
+
+	for i := range documents {
+		err := afterInsert(ctx, &documents[i])
+		if err != nil {
+			return insertedIDs, fmt.Errorf("%w: document %d: %w", repo.ErrInsertMany, i, err)
+		}
+	}
+
+	return insertedIDs, nil
+}
+
+// UpdateByID updates a single document by its ID.
+func (r *Repository[M, I]) UpdateByID(
+	ctx context.Context,
+	id I,
+	update any,
+	opts ...*options.UpdateOptions,
+) (*repo.UpdateResult[I], error) {
+	result, err := r.update(ctx, bson.D{{Key: "_id", Value: id}}, update, false, opts...)
+	if err != nil {
+		return nil, r.error("UpdateByID", fmt.Errorf("%w: %w", repo.ErrUpdateByID, err))
+	}
+	return result, nil
+}
+
+// UpdateOne updates a single document by its filter.
+func (r *Repository[M, I]) UpdateOne(
+	ctx context.Context,
+	filter any,
+	update any,
+	opts ...*options.UpdateOptions,
+) (*repo.UpdateResult[I], error) {
+	result, err := r.update(ctx, filter, update, false, opts...)
+	if err != nil {
+		return nil, r.error("UpdateOne", fmt.Errorf("%w: %w", repo.ErrUpdateOne, err))
+	}
+	return result, nil
+}
+
+// UpdateMany updates multiple documents by their filter.
+func (r *Repository[M, I]) UpdateMany(
+	ctx context.Context,
+	filter any,
+	update any,
+	opts ...*options.UpdateOptions,
+) (*repo.UpdateResult[I], error) {
+	result, err := r.update(ctx, filter, update, true, opts...)
+	if err != nil {
+		return nil, r.error("UpdateMany", fmt.Errorf("%w: %w", repo.ErrUpdateMany, err))
+	}
+	return result, nil
+}
+
+// DeleteOne deletes a single document by its filter.
+func (r *Repository[M, I]) DeleteOne(
+	ctx context.Context,
+	filter any,
+	opts ...*options.DeleteOptions,
+) (*mongo.DeleteResult, error) {
+	result, err := r.delete(ctx, filter, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", repo.ErrDeleteOne, err)
+	}
+	return result, nil
+}
+
+// DeleteMany deletes multiple documents by their filter.
+func (r *Repository[M, I]) DeleteMany(
+	ctx context.Context,
+	filter any,
+	opts ...*options.DeleteOptions,
+) (*mongo.DeleteResult, error) {
+	result, err := r.delete(ctx, filter, true)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", repo.ErrDeleteMany, err)
+	}
+	return result, nil
+}
+
+// Count returns the number of documents that match the filter.
+func (r *Repository[M, I]) Count(ctx context.Context, filter any, opts ...*options.CountOptions) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%w: %w", repo.ErrCount, err)
+	}
+
+	o := options.MergeCountOptions(opts...)
+
+	docs, err := r.query(r.visible(filter), nil, o.Skip, o.Limit, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", repo.ErrCount, err)
+	}
+	return int64(len(docs)), nil
+}
+
+// CountEstimate returns the number of documents in the collection, including soft deleted ones.
+func (r *Repository[M, I]) CountEstimate(ctx context.Context, opts ...*options.EstimatedDocumentCountOptions) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%w: %w", repo.ErrCount, err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return int64(len(r.documents)), nil
+}
+
+// prepareInsert converts a model into a document, making sure _id is its first field.
+func prepareInsert(document any) (bson.D, error) {
+	doc, err := toDocument(document)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, e := range doc {
+		if e.Key == "_id" {
+			return append(bson.D{e}, append(doc[:i:i], doc[i+1:]...)...), nil
+		}
+	}
+
+	return append(bson.D{{Key: "_id", Value: primitive.NewObjectID()}}, doc...), nil
+}
+
+// insert stores the document, reporting a duplicate key error if its _id is already taken.
+// the caller must hold the write lock.
+func (r *Repository[M, I]) insert(doc bson.D, index int) *mongo.WriteError {
+	for _, existing := range r.documents {
+		if equal(existing[0].Value, doc[0].Value) {
+			raw, _ := bson.Marshal(bson.D{
+				{Key: "index", Value: index},
+				{Key: "code", Value: 11000},
+				{Key: "keyPattern", Value: bson.D{{Key: "_id", Value: 1}}},
+				{Key: "keyValue", Value: bson.D{doc[0]}},
+			})
+			return &mongo.WriteError{
+				Index: index,
+				Code:  11000,
+				Message: fmt.Sprintf(
+					"E11000 duplicate key error collection: %s.%s index: _id_ dup key: { _id: %v }",
+					r.databaseName, r.collectionName, doc[0].Value,
+				),
+				Raw: raw,
+			}
+		}
+	}
+
+	r.documents = append(r.documents, doc)
+	return nil
+}
+
+// error classifies the error of an operation like repo.Repository does, so that it matches repo.ErrNotFound and
+// repo.ErrDuplicateKey.
+func (r *Repository[M, I]) error(op string, err error) error {
+	return repo.NewRepoError(op, repo.Namespace{Database: r.databaseName, Collection: r.collectionName}, err)
+}
+
+// query returns copies of the documents that match the filter, sorted, paginated and projected.
+func (r *Repository[M, I]) query(filter, sortSpec any, skip, limit *int64, projection any) ([]bson.D, error) {
+	f, err := toDocument(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	var docs []bson.D
+	for _, doc := range r.documents {
+		ok, err := matches(doc, f)
+		if err != nil {
+			r.mu.RUnlock()
+			return nil, err
+		}
+		if ok {
+			docs = append(docs, clone(doc).(bson.D))
+		}
+	}
+	r.mu.RUnlock()
+
+	if sortSpec != nil {
+		s, err := toDocument(sortSpec)
+		if err != nil {
+			return nil, err
+		}
+		sortDocuments(docs, s)
+	}
+
+	if skip != nil && *skip > 0 {
+		if *skip >= int64(len(docs)) {
+			return nil, nil
+		}
+		docs = docs[*skip:]
+	}
+
+	if limit != nil && *limit != 0 {
+		l := *limit
+		if l < 0 {
+			l = -l
+		}
+		if l < int64(len(docs)) {
+			docs = docs[:l]
+		}
+	}
+
+	if projection != nil {
+		p, err := toDocument(projection)
+		if err != nil {
+			return nil, err
+		}
+		for i, doc := range docs {
+			docs[i] = project(doc, p)
+		}
+	}
+
+	return docs, nil
+}
+
+func sortDocuments(docs []bson.D, spec bson.D) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, s := range spec {
+			a, _ := getPath(docs[i], s.Key)
+			b, _ := getPath(docs[j], s.Key)
+			c := compare(a, b)
+			if toFloat(s.Value) < 0 {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+// project applies an inclusion or exclusion projection to the document.
+func project(doc bson.D, projection bson.D) bson.D {
+	var inclusion bool
+	var includeID = true
+	for _, p := range projection {
+		if p.Key == "_id" {
+			includeID = truthy(p.Value)
+			continue
+		}
+		if truthy(p.Value) {
+			inclusion = true
+		}
+	}
+
+	if !inclusion {
+		for _, p := range projection {
+			if !truthy(p.Value) {
+				doc = unsetPath(doc, p.Key)
+			}
+		}
+		return doc
+	}
+
+	var result = bson.D{}
+	if id, ok := getPath(doc, "_id"); ok && includeID {
+		result = append(result, bson.E{Key: "_id", Value: id})
+	}
+	for _, p := range projection {
+		if p.Key == "_id" || !truthy(p.Value) {
+			continue
+		}
+		if v, ok := getPath(doc, p.Key); ok {
+			result, _ = setPath(result, p.Key, v)
+		}
+	}
+	return result
+}
+
+func (r *Repository[M, I]) update(
+	ctx context.Context,
+	filter any,
+	update any,
+	many bool,
+	opts ...*options.UpdateOptions,
+) (*repo.UpdateResult[I], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := beforeUpdate[M](ctx, filter, update); err != nil {
+		return nil, err
+	}
+
+	o := options.MergeUpdateOptions(opts...)
+	var now = r.settings.now()
+
+	var m = meta.For[M]()
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	var upsert = o.Upsert != nil && *o.Upsert
+
+	update, err := m.StampUpdate(update, now, upsert)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.apply(filter, update, many, upsert, now)
+}
+
+// apply applies the update to the documents that match the filter, inserting a document if none does
+// and upsert is set.
+func (r *Repository[M, I]) apply(
+	filter any,
+	update any,
+	many bool,
+	upsert bool,
+	now time.Time,
+) (*repo.UpdateResult[I], error) {
+	f, err := toDocument(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := toUpdateDocument(update)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var upsertedID I
+	var result = &repo.UpdateResult[I]{UpsertedID: &upsertedID}
+
+	for i, doc := range r.documents {
+		ok, err := matches(doc, f)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		updated, err := applyUpdate(doc, u, false, now)
+		if err != nil {
+			return nil, err
+		}
+
+		result.MatchedCount++
+		if !equal(doc, updated) {
+			result.ModifiedCount++
+			r.documents[i] = updated
+		}
+
+		if !many {
+			break
+		}
+	}
+
+	if result.MatchedCount > 0 || !upsert {
+		return result, nil
+	}
+
+	doc, err := upsertDocument(f)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err = applyUpdate(doc, u, true, now)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err = prepareInsert(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	upsertedID, err = convertID[I](doc[0].Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert updated ID (type %T) to type %T", doc[0].Value, upsertedID)
+	}
+
+	if err := r.insert(doc, 0); err != nil {
+		return nil, mongo.WriteException{WriteErrors: []mongo.WriteError{*err}}
+	}
+
+	result.UpsertedCount = 1
+	return result, nil
+}
+
+func (r *Repository[M, I]) delete(ctx context.Context, filter any, many bool) (*mongo.DeleteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	filter, err := r.beforeDelete(ctx, r.visible(filter), many)
+	if err != nil {
+		return nil, err
+	}
+
+	if m := meta.For[M](); m.SoftDelete() {
+		var now = r.settings.now()
+
+		update, err := m.StampUpdate(m.DeleteUpdate(now), now, false)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := r.apply(filter, update, many, false, now)
+		if err != nil {
+			return nil, err
+		}
+
+		return &mongo.DeleteResult{DeletedCount: result.ModifiedCount}, nil
+	}
+
+	f, err := toDocument(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var result = &mongo.DeleteResult{}
+	var kept = make([]bson.D, 0, len(r.documents))
+
+	for _, doc := range r.documents {
+		if many || result.DeletedCount == 0 {
+			ok, err := matches(doc, f)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				result.DeletedCount++
+				continue
+			}
+		}
+		kept = append(kept, doc)
+	}
+
+	r.documents = kept
+	return result, nil
+}
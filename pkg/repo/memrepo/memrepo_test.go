@@ -0,0 +1,786 @@
+package memrepo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AISystemsInc/mongo-resource-repo/pkg/repo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Item struct {
+	ID       primitive.ObjectID `bson:"_id"`
+	Name     string             `bson:"name"`
+	Quantity int                `bson:"quantity"`
+	Tags     []string           `bson:"tags"`
+	Owner    *Owner             `bson:"owner,omitempty"`
+}
+
+type Owner struct {
+	Name string `bson:"name"`
+}
+
+func (i *Item) GetDatabaseName() string {
+	return "item_db"
+}
+
+func (i *Item) GetCollectionName() string {
+	return "item_col"
+}
+
+var _ repo.Store[*Item, primitive.ObjectID] = (*Repository[*Item, primitive.ObjectID])(nil)
+
+func seed(t *testing.T) (*Repository[*Item, primitive.ObjectID], []*Item) {
+	var items = []*Item{
+		{ID: primitive.NewObjectID(), Name: "apple", Quantity: 5, Tags: []string{"fruit", "red"}, Owner: &Owner{Name: "alice"}},
+		{ID: primitive.NewObjectID(), Name: "banana", Quantity: 12, Tags: []string{"fruit", "yellow"}},
+		{ID: primitive.NewObjectID(), Name: "carrot", Quantity: 0, Tags: []string{"vegetable"}, Owner: &Owner{Name: "bob"}},
+	}
+
+	var repository = NewRepository[*Item, primitive.ObjectID]()
+	_, err := repository.InsertMany(context.Background(), items)
+	if err != nil {
+		t.Fatalf("error seeding repository: %v", err)
+	}
+
+	return repository, items
+}
+
+func TestRepository_Find(t *testing.T) {
+	repository, items := seed(t)
+
+	type args struct {
+		filter any
+		opts   []*options.FindOptions
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []*Item
+		wantErr error
+	}{
+		{
+			name: "should return all documents for an empty filter",
+			args: args{filter: bson.M{}},
+			want: items,
+		},
+		{
+			name: "should match equality on a field",
+			args: args{filter: bson.M{"name": "banana"}},
+			want: items[1:2],
+		},
+		{
+			name: "should match comparison operators",
+			args: args{filter: bson.D{{Key: "quantity", Value: bson.D{{Key: "$gt", Value: 0}, {Key: "$lte", Value: 5}}}}},
+			want: items[0:1],
+		},
+		{
+			name: "should match $in",
+			args: args{filter: bson.M{"name": bson.M{"$in": bson.A{"apple", "carrot"}}}},
+			want: []*Item{items[0], items[2]},
+		},
+		{
+			name: "should match array elements",
+			args: args{filter: bson.M{"tags": "fruit"}},
+			want: items[0:2],
+		},
+		{
+			name: "should match $exists on a nested field",
+			args: args{filter: bson.M{"owner.name": bson.M{"$exists": false}}},
+			want: items[1:2],
+		},
+		{
+			name: "should match $or and $regex",
+			args: args{filter: bson.M{"$or": bson.A{
+				bson.M{"name": bson.M{"$regex": "^AP", "$options": "i"}},
+				bson.M{"quantity": bson.M{"$gte": 10}},
+			}}},
+			want: items[0:2],
+		},
+		{
+			name: "should match $not and $size",
+			args: args{filter: bson.M{"tags": bson.M{"$not": bson.M{"$size": 2}}}},
+			want: items[2:3],
+		},
+		{
+			name: "should sort, skip and limit",
+			args: args{
+				filter: bson.M{},
+				opts:   []*options.FindOptions{options.Find().SetSort(bson.D{{Key: "quantity", Value: -1}}).SetSkip(1).SetLimit(1)},
+			},
+			want: items[0:1],
+		},
+		{
+			name:    "should return an error for unsupported operators",
+			args:    args{filter: bson.M{"$where": "this.quantity > 1"}},
+			wantErr: ErrUnsupportedOperator,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repository.Find(context.Background(), tt.args.filter, tt.args.opts...)
+			if tt.wantErr != nil && (err == nil || !errors.Is(err, tt.wantErr) || !errors.Is(err, repo.ErrFind)) {
+				t.Errorf("Find() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("Find() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Find() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepository_FindOne(t *testing.T) {
+	repository, items := seed(t)
+
+	got, err := repository.FindOne(context.Background(), bson.M{"_id": items[2].ID})
+	if err != nil {
+		t.Errorf("FindOne() error = %v", err)
+		return
+	}
+	if !reflect.DeepEqual(got, items[2]) {
+		t.Errorf("FindOne() got = %v, want %v", got, items[2])
+	}
+
+	_, err = repository.FindOne(context.Background(), bson.M{"_id": primitive.NewObjectID()})
+	if !errors.Is(err, repo.ErrFindOne) || !errors.Is(err, mongo.ErrNoDocuments) || !errors.Is(err, repo.ErrNotFound) {
+		t.Errorf("FindOne() error = %v, want %v", err, mongo.ErrNoDocuments)
+	}
+}
+
+func TestRepository_FindStream(t *testing.T) {
+	repository, items := seed(t)
+
+	stream, errChan, cancelChan, err := repository.FindStream(context.Background(), bson.M{})
+	if err != nil {
+		t.Errorf("error creating stream: %v", err)
+		return
+	}
+	defer close(cancelChan)
+
+	go func() {
+		for err := range errChan {
+			t.Errorf("error streaming: %v", err)
+		}
+	}()
+
+	var got []*Item
+	for model := range stream {
+		got = append(got, model)
+	}
+
+	if !reflect.DeepEqual(got, items) {
+		t.Errorf("FindStream() got = %v, want %v", got, items)
+	}
+}
+
+func TestRepository_InsertOne(t *testing.T) {
+	repository, items := seed(t)
+
+	_, err := repository.InsertOne(context.Background(), items[0])
+	var writeException mongo.WriteException
+	if !errors.Is(err, repo.ErrInsertOne) || !errors.As(err, &writeException) || !mongo.IsDuplicateKeyError(writeException) {
+		t.Errorf("InsertOne() error = %v, want a duplicate key error", err)
+	}
+
+	var repoErr *repo.RepoError
+	if !errors.Is(err, repo.ErrDuplicateKey) || !errors.As(err, &repoErr) ||
+		repoErr.Index != "_id_" || !reflect.DeepEqual(repoErr.KeyValue, bson.D{{Key: "_id", Value: items[0].ID}}) {
+		t.Errorf("InsertOne() error = %+v, want the _id_ index and key", repoErr)
+	}
+
+	var item = &Item{ID: primitive.NewObjectID(), Name: "date"}
+	id, err := repository.InsertOne(context.Background(), item)
+	if err != nil {
+		t.Errorf("InsertOne() error = %v", err)
+		return
+	}
+	if id != item.ID {
+		t.Errorf("InsertOne() got = %v, want %v", id, item.ID)
+	}
+}
+
+func TestRepository_InsertMany(t *testing.T) {
+	tests := []struct {
+		name    string
+		ordered bool
+		want    []int
+		failed  []int
+	}{
+		{
+			name:    "ordered",
+			ordered: true,
+			want:    []int{0},
+			failed:  []int{1, 2, 3, 4},
+		},
+		{
+			name:    "unordered",
+			ordered: false,
+			want:    []int{0, 2, 4},
+			failed:  []int{1, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository, items := seed(t)
+
+			var documents = []*Item{
+				{ID: primitive.NewObjectID(), Name: "date"},
+				items[0],
+				{ID: primitive.NewObjectID(), Name: "elderberry"},
+				items[1],
+				{ID: primitive.NewObjectID(), Name: "fig"},
+			}
+
+			ids, err := repository.InsertMany(context.Background(), documents, options.InsertMany().SetOrdered(tt.ordered))
+
+			var bulkErr *repo.BulkError
+			if !errors.Is(err, repo.ErrInsertMany) || !errors.Is(err, repo.ErrDuplicateKey) || !errors.As(err, &bulkErr) {
+				t.Fatalf("InsertMany() error = %v, want a *repo.BulkError", err)
+			}
+			if !reflect.DeepEqual(bulkErr.Failed(), tt.failed) {
+				t.Errorf("Failed() = %v, want %v", bulkErr.Failed(), tt.failed)
+			}
+			for _, f := range bulkErr.Failures {
+				if f.Kind != repo.KindDuplicateKey {
+					t.Errorf("failure %d kind = %s, want %s", f.Index, f.Kind, repo.KindDuplicateKey)
+				}
+			}
+
+			var want = make([]primitive.ObjectID, len(documents))
+			for _, i := range tt.want {
+				want[i] = documents[i].ID
+			}
+			if !reflect.DeepEqual(ids, want) {
+				t.Errorf("InsertMany() ids = %v, want %v", ids, want)
+			}
+
+			count, err := repository.Count(context.Background(), bson.M{})
+			if err != nil || count != int64(len(items)+len(tt.want)) {
+				t.Errorf("Count() = %d, %v, want %d", count, err, len(items)+len(tt.want))
+			}
+		})
+	}
+}
+
+func TestRepository_UpdateOne(t *testing.T) {
+	type args struct {
+		filter any
+		update any
+		opts   []*options.UpdateOptions
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *Item
+		wantErr bool
+	}{
+		{
+			name: "should apply $set, $inc and $push",
+			args: args{
+				filter: bson.M{"name": "apple"},
+				update: bson.M{
+					"$set":  bson.M{"owner.name": "carol"},
+					"$inc":  bson.M{"quantity": 3},
+					"$push": bson.M{"tags": bson.M{"$each": bson.A{"sweet"}}},
+				},
+			},
+			want: &Item{Name: "apple", Quantity: 8, Tags: []string{"fruit", "red", "sweet"}, Owner: &Owner{Name: "carol"}},
+		},
+		{
+			name: "should apply $addToSet, $pull and $unset",
+			args: args{
+				filter: bson.M{"name": "apple"},
+				update: bson.D{
+					{Key: "$addToSet", Value: bson.M{"tags": "fruit"}},
+					{Key: "$pull", Value: bson.M{"tags": "red"}},
+					{Key: "$unset", Value: bson.M{"owner": ""}},
+				},
+			},
+			want: &Item{Name: "apple", Quantity: 5, Tags: []string{"fruit"}},
+		},
+		{
+			name: "should upsert from the filter's equality fields",
+			args: args{
+				filter: bson.M{"name": "eggplant"},
+				update: bson.M{"$setOnInsert": bson.M{"quantity": 1}},
+				opts:   []*options.UpdateOptions{options.Update().SetUpsert(true)},
+			},
+			want: &Item{Name: "eggplant", Quantity: 1},
+		},
+		{
+			name: "should return an error for replacement documents",
+			args: args{
+				filter: bson.M{"name": "apple"},
+				update: bson.M{"quantity": 1},
+			},
+			wantErr: true,
+		},
+		{
+			name: "should return an error when modifying _id",
+			args: args{
+				filter: bson.M{"name": "apple"},
+				update: bson.M{"$set": bson.M{"_id": primitive.NewObjectID()}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository, _ := seed(t)
+
+			result, err := repository.UpdateOne(context.Background(), tt.args.filter, tt.args.update, tt.args.opts...)
+			if tt.wantErr {
+				if !errors.Is(err, repo.ErrUpdateOne) {
+					t.Errorf("UpdateOne() error = %v, want %v", err, repo.ErrUpdateOne)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("UpdateOne() error = %v", err)
+				return
+			}
+
+			got, err := repository.FindOne(context.Background(), bson.M{"name": tt.want.Name})
+			if err != nil {
+				t.Errorf("FindOne() error = %v", err)
+				return
+			}
+
+			if result.UpsertedCount == 1 && *result.UpsertedID != got.ID {
+				t.Errorf("UpdateOne() upserted ID = %v, want %v", *result.UpsertedID, got.ID)
+			}
+
+			tt.want.ID = got.ID
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UpdateOne() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepository_UpdateMany(t *testing.T) {
+	repository, _ := seed(t)
+
+	result, err := repository.UpdateMany(context.Background(), bson.M{"tags": "fruit"}, bson.M{"$mul": bson.M{"quantity": 2}})
+	if err != nil {
+		t.Errorf("UpdateMany() error = %v", err)
+		return
+	}
+	if result.MatchedCount != 2 || result.ModifiedCount != 2 {
+		t.Errorf("UpdateMany() got = %+v, want 2 matched and modified", result)
+	}
+
+	count, err := repository.Count(context.Background(), bson.M{"quantity": bson.M{"$in": bson.A{10, 24}}})
+	if err != nil {
+		t.Errorf("Count() error = %v", err)
+		return
+	}
+	if count != 2 {
+		t.Errorf("Count() got = %d, want 2", count)
+	}
+}
+
+func TestRepository_DeleteMany(t *testing.T) {
+	repository, items := seed(t)
+
+	result, err := repository.DeleteOne(context.Background(), bson.M{"tags": "fruit"})
+	if err != nil {
+		t.Errorf("DeleteOne() error = %v", err)
+		return
+	}
+	if result.DeletedCount != 1 {
+		t.Errorf("DeleteOne() got = %d, want 1", result.DeletedCount)
+	}
+
+	result, err = repository.DeleteMany(context.Background(), bson.M{"quantity": bson.M{"$lt": 100}})
+	if err != nil {
+		t.Errorf("DeleteMany() error = %v", err)
+		return
+	}
+	if result.DeletedCount != int64(len(items)-1) {
+		t.Errorf("DeleteMany() got = %d, want %d", result.DeletedCount, len(items)-1)
+	}
+
+	count, err := repository.CountEstimate(context.Background())
+	if err != nil {
+		t.Errorf("CountEstimate() error = %v", err)
+		return
+	}
+	if count != 0 {
+		t.Errorf("CountEstimate() got = %d, want 0", count)
+	}
+}
+
+func TestRepository_Iterate(t *testing.T) {
+	repository, items := seed(t)
+
+	cursor, err := repository.Iterate(context.Background(), bson.M{"tags": "fruit"})
+	if err != nil {
+		t.Errorf("Iterate() error = %v", err)
+		return
+	}
+
+	var got []*Item
+	for model, err := range cursor.All(context.Background()) {
+		if err != nil {
+			t.Errorf("All() error = %v", err)
+			return
+		}
+		got = append(got, model)
+	}
+
+	if !reflect.DeepEqual(got, items[0:2]) {
+		t.Errorf("Iterate() got = %v, want %v", got, items[0:2])
+	}
+}
+
+type HookedItem struct {
+	ID     primitive.ObjectID `bson:"_id"`
+	Name   string             `bson:"name"`
+	Locked bool               `bson:"locked"`
+	Loaded bool               `bson:"-"`
+}
+
+func (i *HookedItem) GetDatabaseName() string {
+	return "item_db"
+}
+
+func (i *HookedItem) GetCollectionName() string {
+	return "hooked_item_col"
+}
+
+func (i *HookedItem) BeforeInsert(ctx context.Context) error {
+	if i.ID.IsZero() {
+		i.ID = primitive.NewObjectID()
+	}
+	return nil
+}
+
+func (i *HookedItem) Validate() error {
+	if i.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func (i *HookedItem) AfterFind(ctx context.Context) error {
+	i.Loaded = true
+	return nil
+}
+
+func (i *HookedItem) BeforeDelete(ctx context.Context) error {
+	if i.Locked {
+		return errors.New("item is locked")
+	}
+	return nil
+}
+
+func TestRepository_Hooks(t *testing.T) {
+	var ctx = context.Background()
+	var repository = NewRepository[*HookedItem, primitive.ObjectID]()
+
+	_, err := repository.InsertOne(ctx, &HookedItem{})
+	if !errors.Is(err, repo.ErrValidation) {
+		t.Fatalf("InsertOne() error = %v, want %v", err, repo.ErrValidation)
+	}
+
+	var item = &HookedItem{Name: "apple"}
+	id, err := repository.InsertOne(ctx, item)
+	if err != nil {
+		t.Fatalf("InsertOne() error = %v", err)
+	}
+	if item.ID.IsZero() || id != item.ID {
+		t.Errorf("InsertOne() id = %v, want the ID set by BeforeInsert %v", id, item.ID)
+	}
+
+	found, err := repository.FindOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		t.Fatalf("FindOne() error = %v", err)
+	}
+	if !found.Loaded {
+		t.Errorf("FindOne() did not call AfterFind")
+	}
+
+	_, err = repository.InsertOne(ctx, &HookedItem{Name: "banana", Locked: true})
+	if err != nil {
+		t.Fatalf("InsertOne() error = %v", err)
+	}
+
+	_, err = repository.DeleteMany(ctx, bson.M{})
+	if !errors.Is(err, repo.ErrHook) {
+		t.Fatalf("DeleteMany() error = %v, want %v", err, repo.ErrHook)
+	}
+
+	count, _ := repository.CountEstimate(ctx)
+	if count != 2 {
+		t.Errorf("DeleteMany() deleted documents although a hook failed, count = %d", count)
+	}
+
+	result, err := repository.DeleteMany(ctx, bson.M{"locked": false})
+	if err != nil {
+		t.Fatalf("DeleteMany() error = %v", err)
+	}
+	if result.DeletedCount != 1 {
+		t.Errorf("DeleteMany() deleted = %d, want 1", result.DeletedCount)
+	}
+}
+
+type TimestampedItem struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Name      string             `bson:"name"`
+	CreatedAt time.Time          `bson:"createdAt" repo:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt" repo:"updatedAt"`
+}
+
+func (i *TimestampedItem) GetDatabaseName() string {
+	return "item_db"
+}
+
+func (i *TimestampedItem) GetCollectionName() string {
+	return "timestamped_item_col"
+}
+
+func TestRepository_Timestamps(t *testing.T) {
+	var ctx = context.Background()
+	var now = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var repository = NewRepository[*TimestampedItem, primitive.ObjectID](WithClock(func() time.Time {
+		return now
+	}))
+
+	var item = &TimestampedItem{ID: primitive.NewObjectID(), Name: "apple"}
+	_, err := repository.InsertOne(ctx, item)
+	if err != nil {
+		t.Fatalf("InsertOne() error = %v", err)
+	}
+	if !item.CreatedAt.Equal(now) || !item.UpdatedAt.Equal(now) {
+		t.Errorf("InsertOne() timestamps = %v, %v, want %v", item.CreatedAt, item.UpdatedAt, now)
+	}
+
+	var created = now
+	now = now.Add(time.Hour)
+
+	_, err = repository.UpdateByID(ctx, item.ID, bson.M{"$set": bson.M{"name": "pear"}})
+	if err != nil {
+		t.Fatalf("UpdateByID() error = %v", err)
+	}
+
+	found, err := repository.FindOne(ctx, bson.M{"_id": item.ID})
+	if err != nil {
+		t.Fatalf("FindOne() error = %v", err)
+	}
+	if !found.CreatedAt.Equal(created) || !found.UpdatedAt.Equal(now) {
+		t.Errorf("UpdateByID() timestamps = %v, %v, want %v, %v", found.CreatedAt, found.UpdatedAt, created, now)
+	}
+
+	_, err = repository.UpdateOne(
+		ctx,
+		bson.M{"name": "plum"},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "name", Value: "plum"}}}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		t.Fatalf("UpdateOne() error = %v", err)
+	}
+
+	found, err = repository.FindOne(ctx, bson.M{"name": "plum"})
+	if err != nil {
+		t.Fatalf("FindOne() error = %v", err)
+	}
+	if !found.CreatedAt.Equal(now) || !found.UpdatedAt.Equal(now) {
+		t.Errorf("UpdateOne() upserted timestamps = %v, %v, want %v", found.CreatedAt, found.UpdatedAt, now)
+	}
+}
+
+type SoftDeletedItem struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Name      string             `bson:"name"`
+	DeletedAt *time.Time         `bson:"deletedAt,omitempty" repo:"deletedAt"`
+}
+
+func (i *SoftDeletedItem) GetDatabaseName() string {
+	return "item_db"
+}
+
+func (i *SoftDeletedItem) GetCollectionName() string {
+	return "soft_deleted_item_col"
+}
+
+func TestRepository_SoftDelete(t *testing.T) {
+	var ctx = context.Background()
+	var now = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var repository = NewRepository[*SoftDeletedItem, primitive.ObjectID](WithClock(func() time.Time {
+		return now
+	}))
+
+	_, err := repository.InsertMany(ctx, []*SoftDeletedItem{
+		{ID: primitive.NewObjectID(), Name: "apple"},
+		{ID: primitive.NewObjectID(), Name: "banana"},
+	})
+	if err != nil {
+		t.Fatalf("InsertMany() error = %v", err)
+	}
+
+	result, err := repository.DeleteOne(ctx, bson.M{"name": "apple"})
+	if err != nil || result.DeletedCount != 1 {
+		t.Fatalf("DeleteOne() = %v, %v, want 1 deleted", result, err)
+	}
+
+	_, err = repository.FindOne(ctx, bson.M{"name": "apple"})
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("FindOne() error = %v, want %v", err, mongo.ErrNoDocuments)
+	}
+
+	if count, _ := repository.Count(ctx, bson.M{}); count != 1 {
+		t.Errorf("Count() = %d, want 1", count)
+	}
+
+	all, err := repository.FindWithDeleted(ctx, bson.M{"name": "apple"})
+	if err != nil || len(all) != 1 || all[0].DeletedAt == nil || !all[0].DeletedAt.Equal(now) {
+		t.Fatalf("FindWithDeleted() = %v, %v, want apple deleted at %v", all, err, now)
+	}
+
+	restored, err := repository.Restore(ctx, bson.M{})
+	if err != nil || restored != 1 {
+		t.Errorf("Restore() = %d, %v, want 1", restored, err)
+	}
+
+	if count, _ := repository.Count(ctx, bson.M{}); count != 2 {
+		t.Errorf("Count() after Restore() = %d, want 2", count)
+	}
+
+	_, err = repository.DeleteMany(ctx, bson.M{"name": "banana"})
+	if err != nil {
+		t.Fatalf("DeleteMany() error = %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	if purged, _ := repository.PurgeDeleted(ctx, 2*time.Hour); purged != 0 {
+		t.Errorf("PurgeDeleted() = %d, want 0", purged)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if purged, _ := repository.PurgeDeleted(ctx, 2*time.Hour); purged != 1 {
+		t.Errorf("PurgeDeleted() = %d, want 1", purged)
+	}
+
+	if count, _ := repository.CountEstimate(ctx); count != 1 {
+		t.Errorf("CountEstimate() = %d, want 1", count)
+	}
+}
+
+type VersionedItem struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Name      string             `bson:"name"`
+	Note      string             `bson:"note,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt" repo:"createdAt"`
+	Version   int64              `bson:"version" repo:"version"`
+}
+
+func (i *VersionedItem) GetDatabaseName() string {
+	return "item_db"
+}
+
+func (i *VersionedItem) GetCollectionName() string {
+	return "versioned_item_col"
+}
+
+func TestRepository_SaveVersioned(t *testing.T) {
+	var ctx = context.Background()
+	var repository = NewRepository[*VersionedItem, primitive.ObjectID]()
+
+	var id = primitive.NewObjectID()
+	_, err := repository.InsertOne(ctx, &VersionedItem{ID: id, Name: "apple"})
+	if err != nil {
+		t.Fatalf("InsertOne() error = %v", err)
+	}
+
+	first, _ := repository.FindOne(ctx, bson.M{"_id": id})
+	second, _ := repository.FindOne(ctx, bson.M{"_id": id})
+
+	first.Name = "pear"
+	err = repository.SaveVersioned(ctx, first)
+	if err != nil {
+		t.Fatalf("SaveVersioned() error = %v", err)
+	}
+	if first.Version != 1 {
+		t.Errorf("SaveVersioned() version = %d, want 1", first.Version)
+	}
+
+	second.Name = "plum"
+	err = repository.SaveVersioned(ctx, second)
+
+	var conflict *repo.VersionConflictError
+	if !errors.Is(err, repo.ErrVersionConflict) || !errors.As(err, &conflict) {
+		t.Fatalf("SaveVersioned() error = %v, want %v", err, repo.ErrVersionConflict)
+	}
+	if conflict.Expected != 0 || conflict.Current != 1 {
+		t.Errorf("SaveVersioned() conflict = %+v, want expected 0 and current 1", conflict)
+	}
+
+	stored, _ := repository.FindOne(ctx, bson.M{"_id": id})
+	if stored.Name != "pear" || stored.Version != 1 {
+		t.Errorf("SaveVersioned() stored = %+v, want pear at version 1", stored)
+	}
+
+	err = repository.SaveVersioned(ctx, &VersionedItem{ID: primitive.NewObjectID()})
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("SaveVersioned() error = %v, want %v", err, mongo.ErrNoDocuments)
+	}
+}
+
+func TestRepository_SaveVersioned_clearedField(t *testing.T) {
+	var ctx = context.Background()
+	var repository = NewRepository[*VersionedItem, primitive.ObjectID]()
+
+	var id = primitive.NewObjectID()
+	_, err := repository.InsertOne(ctx, &VersionedItem{ID: id, Name: "apple", Note: "bruised"})
+	if err != nil {
+		t.Fatalf("InsertOne() error = %v", err)
+	}
+
+	item, _ := repository.FindOne(ctx, bson.M{"_id": id})
+	item.Note = ""
+	err = repository.SaveVersioned(ctx, item)
+	if err != nil {
+		t.Fatalf("SaveVersioned() error = %v", err)
+	}
+
+	stored, _ := repository.FindOne(ctx, bson.M{"_id": id})
+	if stored.Note != "" || stored.Version != 1 {
+		t.Errorf("SaveVersioned() stored = %+v, want no note at version 1", stored)
+	}
+}
+
+func TestRepository_SaveVersioned_zeroCreatedAt(t *testing.T) {
+	var ctx = context.Background()
+	var repository = NewRepository[*VersionedItem, primitive.ObjectID]()
+
+	var id = primitive.NewObjectID()
+	_, err := repository.InsertOne(ctx, &VersionedItem{ID: id, Name: "apple"})
+	if err != nil {
+		t.Fatalf("InsertOne() error = %v", err)
+	}
+	inserted, _ := repository.FindOne(ctx, bson.M{"_id": id})
+
+	// a document built from a request carries no createdAt.
+	err = repository.SaveVersioned(ctx, &VersionedItem{ID: id, Name: "pear"})
+	if err != nil {
+		t.Fatalf("SaveVersioned() error = %v", err)
+	}
+
+	stored, _ := repository.FindOne(ctx, bson.M{"_id": id})
+	if stored.Name != "pear" || stored.CreatedAt.IsZero() || !stored.CreatedAt.Equal(inserted.CreatedAt) {
+		t.Errorf("SaveVersioned() stored = %+v, want createdAt %v kept", stored, inserted.CreatedAt)
+	}
+}
@@ -0,0 +1,28 @@
+package memrepo
+
+import "time"
+
+// Option configures optional behaviour of a Repository.
+type Option func(*settings)
+
+type settings struct {
+	clock func() time.Time
+}
+
+// WithClock sets the clock used for managed timestamps and $currentDate, e.g. to make tests deterministic.
+// Defaults to time.Now.
+func WithClock(clock func() time.Time) Option {
+	return func(s *settings) {
+		s.clock = clock
+	}
+}
+
+func (s *settings) now() time.Time {
+	var now time.Time
+	if s.clock != nil {
+		now = s.clock()
+	} else {
+		now = time.Now()
+	}
+	return now.Truncate(time.Millisecond)
+}
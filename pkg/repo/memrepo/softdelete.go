@@ -0,0 +1,110 @@
+package memrepo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AISystemsInc/mongo-resource-repo/pkg/repo"
+	"github.com/AISystemsInc/mongo-resource-repo/pkg/repo/internal/meta"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// visible restricts the filter to the documents that are not soft deleted.
+func (r *Repository[M, I]) visible(filter any) any {
+	var notDeleted = meta.For[M]().NotDeleted()
+	switch {
+	case notDeleted == nil:
+		return filter
+	case filter == nil:
+		return notDeleted
+	}
+	return bson.D{{Key: "$and", Value: bson.A{filter, notDeleted}}}
+}
+
+// FindWithDeleted works like Find, but also returns soft deleted documents.
+func (r *Repository[M, I]) FindWithDeleted(
+	ctx context.Context,
+	filter any,
+	opts ...*options.FindOptions,
+) ([]M, error) {
+	return r.find(ctx, repo.ErrFindWithDeleted, filter, opts...)
+}
+
+// Restore restores the soft deleted documents that match the filter, and returns how many were restored.
+func (r *Repository[M, I]) Restore(
+	ctx context.Context,
+	filter any,
+	opts ...*options.UpdateOptions,
+) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%w: %w", repo.ErrRestore, err)
+	}
+
+	var m = meta.For[M]()
+	if !m.SoftDelete() {
+		return 0, fmt.Errorf("%w: %w", repo.ErrRestore, repo.ErrNoSoftDelete)
+	}
+
+	var now = r.settings.now()
+
+	update, err := m.StampUpdate(m.RestoreUpdate(), now, false)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", repo.ErrRestore, err)
+	}
+
+	var deleted = bson.D{{Key: m.DeletedAt.Name, Value: bson.D{{Key: "$exists", Value: true}}}}
+	if filter != nil {
+		deleted = bson.D{{Key: "$and", Value: bson.A{filter, deleted}}}
+	}
+
+	result, err := r.apply(deleted, update, true, false, now)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", repo.ErrRestore, err)
+	}
+
+	return result.ModifiedCount, nil
+}
+
+// PurgeDeleted permanently deletes the documents that were soft deleted more than olderThan ago,
+// and returns how many were deleted.
+func (r *Repository[M, I]) PurgeDeleted(
+	ctx context.Context,
+	olderThan time.Duration,
+	opts ...*options.DeleteOptions,
+) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%w: %w", repo.ErrPurgeDeleted, err)
+	}
+
+	var m = meta.For[M]()
+	if !m.SoftDelete() {
+		return 0, fmt.Errorf("%w: %w", repo.ErrPurgeDeleted, repo.ErrNoSoftDelete)
+	}
+
+	f, err := toDocument(m.Deleted(r.settings.now().Add(-olderThan)))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", repo.ErrPurgeDeleted, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	var kept = make([]bson.D, 0, len(r.documents))
+	for _, doc := range r.documents {
+		ok, err := matches(doc, f)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %w", repo.ErrPurgeDeleted, err)
+		}
+		if ok {
+			deleted++
+			continue
+		}
+		kept = append(kept, doc)
+	}
+
+	r.documents = kept
+	return deleted, nil
+}
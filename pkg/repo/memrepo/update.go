@@ -0,0 +1,310 @@
+package memrepo
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// toUpdateDocument converts an update argument into its internal representation.
+// Pipeline-style updates are not supported.
+func toUpdateDocument(update any) (bson.D, error) {
+	switch update.(type) {
+	case bson.D, bson.Raw:
+	default:
+		if v := reflect.ValueOf(update); v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+			return nil, fmt.Errorf("%w: pipeline updates", ErrUnsupportedOperator)
+		}
+	}
+
+	doc, err := toDocument(update)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(doc) == 0 {
+		return nil, fmt.Errorf("update document must not be empty")
+	}
+	for _, e := range doc {
+		if !strings.HasPrefix(e.Key, "$") {
+			return nil, fmt.Errorf("update document requires atomic operators")
+		}
+	}
+
+	return doc, nil
+}
+
+// applyUpdate applies the update operators to a copy of the document and returns the result.
+// inserting is true when the document is being created by an upsert, which enables $setOnInsert.
+func applyUpdate(doc bson.D, update bson.D, inserting bool, now time.Time) (bson.D, error) {
+	var result = clone(doc).(bson.D)
+
+	for _, op := range update {
+		fields, ok := op.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("modifiers operate on fields but we found type %T instead", op.Value)
+		}
+
+		for _, field := range fields {
+			var err error
+			result, err = applyOperator(result, op.Key, field.Key, field.Value, inserting, now)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if before, _ := getPath(doc, "_id"); !inserting && !equal(before, mustGet(result, "_id")) {
+		return nil, fmt.Errorf("performing an update on the path '_id' would modify the immutable field '_id'")
+	}
+
+	return result, nil
+}
+
+func mustGet(doc bson.D, path string) any {
+	v, _ := getPath(doc, path)
+	return v
+}
+
+func applyOperator(doc bson.D, operator, path string, operand any, inserting bool, now time.Time) (bson.D, error) {
+	current, exists := getPath(doc, path)
+
+	switch operator {
+	case "$set":
+		return setPath(doc, path, clone(operand))
+	case "$setOnInsert":
+		if !inserting {
+			return doc, nil
+		}
+		return setPath(doc, path, clone(operand))
+	case "$unset":
+		return unsetPath(doc, path), nil
+	case "$inc", "$mul":
+		if !isNumber(operand) {
+			return nil, fmt.Errorf("cannot %s with non-numeric argument: {%s: %v}", operator[1:], path, operand)
+		}
+		if exists && !isNumber(current) {
+			return nil, fmt.Errorf("cannot apply %s to a value of non-numeric type. {%s: %v}", operator, path, current)
+		}
+		if !exists {
+			if operator == "$inc" {
+				return setPath(doc, path, operand)
+			}
+			return setPath(doc, path, arithmetic(zeroOf(operand), operand, operator))
+		}
+		return setPath(doc, path, arithmetic(current, operand, operator))
+	case "$min", "$max":
+		if !exists {
+			return setPath(doc, path, clone(operand))
+		}
+		c := compare(operand, current)
+		if (operator == "$min" && c < 0) || (operator == "$max" && c > 0) {
+			return setPath(doc, path, clone(operand))
+		}
+		return doc, nil
+	case "$rename":
+		target, ok := operand.(string)
+		if !ok {
+			return nil, fmt.Errorf("the 'to' field for $rename must be a string: %s: %v", path, operand)
+		}
+		if !exists {
+			return doc, nil
+		}
+		return setPath(unsetPath(doc, path), target, current)
+	case "$currentDate":
+		if spec, ok := operand.(bson.D); ok && len(spec) > 0 && spec[0].Key == "$type" && spec[0].Value == "timestamp" {
+			return setPath(doc, path, primitive.Timestamp{T: uint32(now.Unix())})
+		}
+		return setPath(doc, path, primitive.NewDateTimeFromTime(now))
+	case "$push", "$addToSet":
+		arr, err := arrayAt(current, exists, operator, path)
+		if err != nil {
+			return nil, err
+		}
+		var items = bson.A{operand}
+		if spec, ok := operand.(bson.D); ok && len(spec) > 0 && spec[0].Key == "$each" {
+			if each, ok := spec[0].Value.(bson.A); ok {
+				items = each
+			}
+		}
+		for _, item := range items {
+			if operator == "$addToSet" && containsValue(arr, item) {
+				continue
+			}
+			arr = append(arr, clone(item))
+		}
+		return setPath(doc, path, arr)
+	case "$pull", "$pullAll":
+		if !exists {
+			return doc, nil
+		}
+		arr, err := arrayAt(current, exists, operator, path)
+		if err != nil {
+			return nil, err
+		}
+		var kept = bson.A{}
+		for _, el := range arr {
+			remove, err := pulls(el, operand, operator)
+			if err != nil {
+				return nil, err
+			}
+			if !remove {
+				kept = append(kept, el)
+			}
+		}
+		return setPath(doc, path, kept)
+	case "$pop":
+		if !exists {
+			return doc, nil
+		}
+		arr, err := arrayAt(current, exists, operator, path)
+		if err != nil {
+			return nil, err
+		}
+		if len(arr) == 0 {
+			return doc, nil
+		}
+		if toFloat(operand) < 0 {
+			return setPath(doc, path, arr[1:])
+		}
+		return setPath(doc, path, arr[:len(arr)-1])
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedOperator, operator)
+}
+
+func arrayAt(current any, exists bool, operator, path string) (bson.A, error) {
+	if !exists {
+		return bson.A{}, nil
+	}
+	arr, ok := current.(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("the field '%s' must be an array but is of type %T", path, current)
+	}
+	return clone(arr).(bson.A), nil
+}
+
+func containsValue(arr bson.A, value any) bool {
+	for _, el := range arr {
+		if equal(el, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func pulls(element, operand any, operator string) (bool, error) {
+	if operator == "$pullAll" {
+		values, ok := operand.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("$pullAll requires an array argument")
+		}
+		return containsValue(values, element), nil
+	}
+
+	if query, ok := operand.(bson.D); ok {
+		if _, isDoc := element.(bson.D); isDoc || isOperatorQuery(query) {
+			return matchElement(element, query)
+		}
+	}
+	return equal(element, operand), nil
+}
+
+func isOperatorQuery(query bson.D) bool {
+	_, ok := isOperatorDocument(query)
+	return ok
+}
+
+func zeroOf(v any) any {
+	switch v.(type) {
+	case int32:
+		return int32(0)
+	case int64:
+		return int64(0)
+	}
+	return float64(0)
+}
+
+// arithmetic applies $inc or $mul following MongoDB's numeric type promotion rules.
+func arithmetic(a, b any, operator string) any {
+	ai, aInt := toInt64(a)
+	bi, bInt := toInt64(b)
+
+	if aInt && bInt {
+		var result int64
+		var overflow bool
+		if operator == "$inc" {
+			result = ai + bi
+			overflow = (bi > 0 && result < ai) || (bi < 0 && result > ai)
+		} else {
+			result = ai * bi
+			overflow = ai != 0 && result/ai != bi
+		}
+
+		_, a32 := a.(int32)
+		_, b32 := b.(int32)
+		switch {
+		case overflow:
+			if operator == "$inc" {
+				return float64(ai) + float64(bi)
+			}
+			return float64(ai) * float64(bi)
+		case a32 && b32 && result >= math.MinInt32 && result <= math.MaxInt32:
+			return int32(result)
+		default:
+			return result
+		}
+	}
+
+	if operator == "$inc" {
+		return toFloat(a) + toFloat(b)
+	}
+	return toFloat(a) * toFloat(b)
+}
+
+// upsertDocument builds the document inserted by an upsert from the equality conditions in the filter.
+func upsertDocument(filter bson.D) (bson.D, error) {
+	var doc = bson.D{}
+	var err error
+
+	for _, e := range filter {
+		switch {
+		case e.Key == "$and":
+			clauses, _ := e.Value.(bson.A)
+			for _, clause := range clauses {
+				sub, ok := clause.(bson.D)
+				if !ok {
+					continue
+				}
+				fields, err := upsertDocument(sub)
+				if err != nil {
+					return nil, err
+				}
+				for _, f := range fields {
+					if doc, err = setPath(doc, f.Key, f.Value); err != nil {
+						return nil, err
+					}
+				}
+			}
+		case strings.HasPrefix(e.Key, "$"):
+		default:
+			var value = e.Value
+			if operators, ok := isOperatorDocument(e.Value); ok {
+				if operators[0].Key != "$eq" {
+					continue
+				}
+				value = operators[0].Value
+			}
+			if doc, err = setPath(doc, e.Key, clone(value)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return doc, nil
+}
@@ -0,0 +1,472 @@
+package memrepo
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// toDocument converts any value the driver accepts as a document (bson.M, bson.D, structs, ...)
+// into the bson.D representation used internally. Nested documents become bson.D and arrays become bson.A,
+// so that every stored document and every filter is evaluated against the same types.
+func toDocument(v any) (bson.D, error) {
+	if v == nil {
+		return bson.D{}, nil
+	}
+
+	if raw, ok := v.(bson.Raw); ok {
+		return rawToDocument(raw)
+	}
+
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return rawToDocument(raw)
+}
+
+func rawToDocument(raw bson.Raw) (bson.D, error) {
+	elements, err := raw.Elements()
+	if err != nil {
+		return nil, err
+	}
+
+	var doc = make(bson.D, 0, len(elements))
+	for _, e := range elements {
+		value, err := fromRawValue(e.Value())
+		if err != nil {
+			return nil, err
+		}
+		doc = append(doc, bson.E{Key: e.Key(), Value: value})
+	}
+
+	return doc, nil
+}
+
+func fromRawValue(rv bson.RawValue) (any, error) {
+	switch rv.Type {
+	case bsontype.EmbeddedDocument:
+		return rawToDocument(rv.Document())
+	case bsontype.Array:
+		values, err := rv.Array().Values()
+		if err != nil {
+			return nil, err
+		}
+		var arr = make(bson.A, len(values))
+		for i, v := range values {
+			arr[i], err = fromRawValue(v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	case bsontype.Double:
+		return rv.Double(), nil
+	case bsontype.String:
+		return rv.StringValue(), nil
+	case bsontype.ObjectID:
+		return rv.ObjectID(), nil
+	case bsontype.Boolean:
+		return rv.Boolean(), nil
+	case bsontype.DateTime:
+		return primitive.DateTime(rv.DateTime()), nil
+	case bsontype.Null, bsontype.Undefined:
+		return nil, nil
+	case bsontype.Int32:
+		return rv.Int32(), nil
+	case bsontype.Int64:
+		return rv.Int64(), nil
+	case bsontype.Decimal128:
+		return rv.Decimal128(), nil
+	case bsontype.Regex:
+		pattern, options := rv.Regex()
+		return primitive.Regex{Pattern: pattern, Options: options}, nil
+	case bsontype.Timestamp:
+		t, i := rv.Timestamp()
+		return primitive.Timestamp{T: t, I: i}, nil
+	case bsontype.Binary:
+		subtype, data := rv.Binary()
+		return primitive.Binary{Subtype: subtype, Data: data}, nil
+	default:
+		var value any
+		err := rv.Unmarshal(&value)
+		return value, err
+	}
+}
+
+// toValue converts a single Go value into its internal representation.
+func toValue(v any) (any, error) {
+	doc, err := toDocument(bson.D{{Key: "v", Value: v}})
+	if err != nil {
+		return nil, err
+	}
+	return doc[0].Value, nil
+}
+
+// decode converts an internal document into a value of type T, the same way the driver decodes results.
+func decode[T any](doc any, out *T) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, out)
+}
+
+// convertID converts an internal _id value into the repository ID type.
+func convertID[I any](value any) (I, error) {
+	var holder struct {
+		ID I `bson:"v"`
+	}
+	err := decode(bson.D{{Key: "v", Value: value}}, &holder)
+	return holder.ID, err
+}
+
+// isOperatorDocument reports whether v is a document whose keys are all query or update operators.
+func isOperatorDocument(v any) (bson.D, bool) {
+	doc, ok := v.(bson.D)
+	if !ok || len(doc) == 0 {
+		return nil, false
+	}
+	for _, e := range doc {
+		if !strings.HasPrefix(e.Key, "$") {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// typeOrder returns the position of the value's type in MongoDB's comparison order.
+func typeOrder(v any) int {
+	switch v.(type) {
+	case nil:
+		return 1
+	case int32, int64, float64, primitive.Decimal128:
+		return 2
+	case string:
+		return 3
+	case bson.D:
+		return 4
+	case bson.A:
+		return 5
+	case primitive.Binary:
+		return 6
+	case primitive.ObjectID:
+		return 7
+	case bool:
+		return 8
+	case primitive.DateTime:
+		return 9
+	case primitive.Timestamp:
+		return 10
+	case primitive.Regex:
+		return 11
+	default:
+		return 12
+	}
+}
+
+func isNumber(v any) bool {
+	return typeOrder(v) == 2
+}
+
+func toFloat(v any) float64 {
+	switch n := v.(type) {
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	case primitive.Decimal128:
+		f, err := strconv.ParseFloat(n.String(), 64)
+		if err != nil {
+			return math.NaN()
+		}
+		return f
+	}
+	return math.NaN()
+}
+
+func toInt64(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	}
+	return 0, false
+}
+
+func compareOrdered[T int | int64 | uint32 | float64 | string](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compare compares two internal values using MongoDB's ordering rules.
+func compare(a, b any) int {
+	ta, tb := typeOrder(a), typeOrder(b)
+	if ta != tb {
+		return compareOrdered(ta, tb)
+	}
+
+	switch av := a.(type) {
+	case nil:
+		return 0
+	case int32, int64, float64, primitive.Decimal128:
+		ai, aok := toInt64(a)
+		bi, bok := toInt64(b)
+		if aok && bok {
+			return compareOrdered(ai, bi)
+		}
+		return compareOrdered(toFloat(a), toFloat(b))
+	case string:
+		return strings.Compare(av, b.(string))
+	case bson.D:
+		bv := b.(bson.D)
+		for i := 0; i < len(av) && i < len(bv); i++ {
+			if c := strings.Compare(av[i].Key, bv[i].Key); c != 0 {
+				return c
+			}
+			if c := compare(av[i].Value, bv[i].Value); c != 0 {
+				return c
+			}
+		}
+		return compareOrdered(len(av), len(bv))
+	case bson.A:
+		bv := b.(bson.A)
+		for i := 0; i < len(av) && i < len(bv); i++ {
+			if c := compare(av[i], bv[i]); c != 0 {
+				return c
+			}
+		}
+		return compareOrdered(len(av), len(bv))
+	case primitive.Binary:
+		bv := b.(primitive.Binary)
+		if av.Subtype != bv.Subtype {
+			return compareOrdered(int(av.Subtype), int(bv.Subtype))
+		}
+		return bytes.Compare(av.Data, bv.Data)
+	case primitive.ObjectID:
+		bv := b.(primitive.ObjectID)
+		return bytes.Compare(av[:], bv[:])
+	case bool:
+		bv := b.(bool)
+		if av == bv {
+			return 0
+		}
+		if !av {
+			return -1
+		}
+		return 1
+	case primitive.DateTime:
+		return compareOrdered(int64(av), int64(b.(primitive.DateTime)))
+	case primitive.Timestamp:
+		bv := b.(primitive.Timestamp)
+		if av.T != bv.T {
+			return compareOrdered(av.T, bv.T)
+		}
+		return compareOrdered(av.I, bv.I)
+	case primitive.Regex:
+		bv := b.(primitive.Regex)
+		return strings.Compare(av.Pattern+"/"+av.Options, bv.Pattern+"/"+bv.Options)
+	}
+
+	if reflect.DeepEqual(a, b) {
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func equal(a, b any) bool {
+	return compare(a, b) == 0
+}
+
+// resolve returns every value reachable through the dotted path, descending into arrays of documents
+// the same way MongoDB does when evaluating a query.
+func resolve(v any, parts []string) []any {
+	if len(parts) == 0 {
+		return []any{v}
+	}
+
+	switch t := v.(type) {
+	case bson.D:
+		for _, e := range t {
+			if e.Key == parts[0] {
+				return resolve(e.Value, parts[1:])
+			}
+		}
+	case bson.A:
+		if idx, err := strconv.Atoi(parts[0]); err == nil {
+			if idx >= 0 && idx < len(t) {
+				return resolve(t[idx], parts[1:])
+			}
+			return nil
+		}
+
+		var values []any
+		for _, el := range t {
+			if _, ok := el.(bson.D); ok {
+				values = append(values, resolve(el, parts)...)
+			}
+		}
+		return values
+	}
+
+	return nil
+}
+
+// getPath returns the value stored at the dotted path, without descending into arrays except by index.
+func getPath(doc bson.D, path string) (any, bool) {
+	var current any = doc
+	for _, part := range strings.Split(path, ".") {
+		switch t := current.(type) {
+		case bson.D:
+			var found bool
+			for _, e := range t {
+				if e.Key == part {
+					current, found = e.Value, true
+					break
+				}
+			}
+			if !found {
+				return nil, false
+			}
+		case bson.A:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(t) {
+				return nil, false
+			}
+			current = t[idx]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// setPath stores value at the dotted path, creating intermediate documents as needed.
+func setPath(doc bson.D, path string, value any) (bson.D, error) {
+	result, err := setIn(doc, strings.Split(path, "."), value)
+	if err != nil {
+		return doc, fmt.Errorf("cannot set field %q: %w", path, err)
+	}
+	return result.(bson.D), nil
+}
+
+func setIn(container any, parts []string, value any) (any, error) {
+	switch t := container.(type) {
+	case bson.D:
+		for i, e := range t {
+			if e.Key != parts[0] {
+				continue
+			}
+			if len(parts) == 1 {
+				t[i].Value = value
+				return t, nil
+			}
+			child, err := setIn(e.Value, parts[1:], value)
+			if err != nil {
+				return t, err
+			}
+			t[i].Value = child
+			return t, nil
+		}
+
+		if len(parts) == 1 {
+			return append(t, bson.E{Key: parts[0], Value: value}), nil
+		}
+		child, err := setIn(bson.D{}, parts[1:], value)
+		if err != nil {
+			return t, err
+		}
+		return append(t, bson.E{Key: parts[0], Value: child}), nil
+	case bson.A:
+		idx, err := strconv.Atoi(parts[0])
+		if err != nil || idx < 0 {
+			return t, fmt.Errorf("cannot use the part %q to traverse an array", parts[0])
+		}
+		for len(t) <= idx {
+			t = append(t, nil)
+		}
+		if len(parts) == 1 {
+			t[idx] = value
+			return t, nil
+		}
+		if t[idx] == nil {
+			t[idx] = bson.D{}
+		}
+		child, err := setIn(t[idx], parts[1:], value)
+		if err != nil {
+			return t, err
+		}
+		t[idx] = child
+		return t, nil
+	default:
+		return container, fmt.Errorf("cannot create field %q in element of type %T", parts[0], container)
+	}
+}
+
+// unsetPath removes the value stored at the dotted path, if any.
+func unsetPath(doc bson.D, path string) bson.D {
+	return unsetIn(doc, strings.Split(path, ".")).(bson.D)
+}
+
+func unsetIn(container any, parts []string) any {
+	switch t := container.(type) {
+	case bson.D:
+		for i, e := range t {
+			if e.Key != parts[0] {
+				continue
+			}
+			if len(parts) == 1 {
+				return append(t[:i:i], t[i+1:]...)
+			}
+			t[i].Value = unsetIn(e.Value, parts[1:])
+			return t
+		}
+	case bson.A:
+		idx, err := strconv.Atoi(parts[0])
+		if err != nil || idx < 0 || idx >= len(t) {
+			return t
+		}
+		if len(parts) == 1 {
+			// like MongoDB, unsetting an array element leaves a null in its place.
+			t[idx] = nil
+			return t
+		}
+		t[idx] = unsetIn(t[idx], parts[1:])
+	}
+	return container
+}
+
+// clone returns a deep copy of an internal value so stored documents are never shared with callers.
+func clone(v any) any {
+	switch t := v.(type) {
+	case bson.D:
+		var doc = make(bson.D, len(t))
+		for i, e := range t {
+			doc[i] = bson.E{Key: e.Key, Value: clone(e.Value)}
+		}
+		return doc
+	case bson.A:
+		var arr = make(bson.A, len(t))
+		for i, el := range t {
+			arr[i] = clone(el)
+		}
+		return arr
+	}
+	return v
+}
@@ -0,0 +1,79 @@
+package memrepo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/AISystemsInc/mongo-resource-repo/pkg/repo"
+	"github.com/AISystemsInc/mongo-resource-repo/pkg/repo/internal/meta"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SaveVersioned saves all fields of a model whose stored version is still the version of the model,
+// with the same semantics as repo.Repository.SaveVersioned.
+func (r *Repository[M, I]) SaveVersioned(
+	ctx context.Context,
+	document M,
+	opts ...*options.UpdateOptions,
+) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%w: %w", repo.ErrSaveVersioned, err)
+	}
+
+	var m = meta.For[M]()
+	if m.Err != nil {
+		return fmt.Errorf("%w: %w", repo.ErrSaveVersioned, m.Err)
+	}
+
+	if v, ok := hook[repo.Validator](&document); ok {
+		if err := v.Validate(); err != nil {
+			return fmt.Errorf("%w: %w: %w", repo.ErrSaveVersioned, repo.ErrValidation, err)
+		}
+	}
+
+	var now = r.settings.now()
+	m.Touch(&document, now)
+
+	id, filter, update, err := m.SaveVersioned(&document)
+	if err != nil {
+		return fmt.Errorf("%w: %w", repo.ErrSaveVersioned, err)
+	}
+
+	err = beforeUpdate[M](ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("%w: %w", repo.ErrSaveVersioned, err)
+	}
+
+	result, err := r.apply(r.visible(filter), update, false, false, now)
+	if err != nil {
+		return fmt.Errorf("%w: %w", repo.ErrSaveVersioned, err)
+	}
+
+	var expected = m.VersionOf(&document)
+
+	if result.MatchedCount == 0 {
+		docs, err := r.query(r.visible(bson.D{{Key: "_id", Value: id}}), nil, nil, nil, nil)
+		if err != nil {
+			return fmt.Errorf("%w: %w", repo.ErrSaveVersioned, err)
+		}
+		if len(docs) == 0 {
+			return r.error("SaveVersioned", fmt.Errorf("%w: %w", repo.ErrSaveVersioned, mongo.ErrNoDocuments))
+		}
+
+		var current int64
+		if v, ok := getPath(docs[0], m.Version.Name); ok {
+			current = int64(toFloat(v))
+		}
+
+		return r.error("SaveVersioned", fmt.Errorf("%w: %w", repo.ErrSaveVersioned, &repo.VersionConflictError{
+			ID:       id,
+			Expected: expected,
+			Current:  current,
+		}))
+	}
+
+	m.SetVersion(&document, expected+1)
+	return nil
+}
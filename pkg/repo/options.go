@@ -0,0 +1,81 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option configures optional behaviour of a Repository.
+type Option func(*settings)
+
+type settings struct {
+	pageTokenKey []byte
+	clock        func() time.Time
+	tenants      TenantResolver
+	tenant       func(ctx context.Context) (string, bool)
+	scope        Scope
+
+	tracerProvider trace.TracerProvider
+}
+
+// WithPageTokenKey sets the key used to sign the continuation tokens returned by FindPage.
+// Tokens signed with one key are rejected by repositories configured with another.
+func WithPageTokenKey(key []byte) Option {
+	return func(s *settings) {
+		s.pageTokenKey = key
+	}
+}
+
+// WithClock sets the clock used for the timestamps the repository manages, e.g. to make tests deterministic.
+// Defaults to time.Now.
+func WithClock(clock func() time.Time) Option {
+	return func(s *settings) {
+		s.clock = clock
+	}
+}
+
+// WithTenants routes every operation to the namespace the resolver maps the tenant of its context to.
+// Operations with a context that carries no tenant fail with ErrNoTenant instead of using the namespace of the model.
+func WithTenants(resolver TenantResolver) Option {
+	return func(s *settings) {
+		s.tenants = resolver
+	}
+}
+
+// WithTenantFromContext sets the function that extracts the tenant from the context of an operation.
+// Defaults to TenantFromContext.
+func WithTenantFromContext(tenant func(ctx context.Context) (string, bool)) Option {
+	return func(s *settings) {
+		s.tenant = tenant
+	}
+}
+
+// WithScope restricts every operation to the documents matching the conditions the scope derives from its context,
+// and stamps them on inserted documents. See Scope.
+func WithScope(scope Scope) Option {
+	return func(s *settings) {
+		s.scope = scope
+	}
+}
+
+// WithTracerProvider traces every operation of the repository with a span from the provider, e.g.
+// otel.GetTracerProvider(). Operations are not traced by default.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(s *settings) {
+		s.tracerProvider = provider
+	}
+}
+
+// now returns the time of the repository's clock, truncated to the millisecond precision of BSON dates
+// so that stamped models are equal to their stored version.
+func (s *settings) now() time.Time {
+	var now time.Time
+	if s.clock != nil {
+		now = s.clock()
+	} else {
+		now = time.Now()
+	}
+	return now.Truncate(time.Millisecond)
+}
@@ -0,0 +1,638 @@
+package repo
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Page is a page of results returned by FindPage.
+type Page[M Model] struct {
+	Items     []M    // The documents on this page, in sort order.
+	NextToken string // Token for the page after this one, or empty if there are no more results.
+	PrevToken string // Token for the page before this one, or empty if this is the first page.
+	HasMore   bool   // Whether there are results after this page.
+}
+
+// FindPage returns a page of at most size documents that match the filter, ordered by sort.
+// The first page is requested with an empty token, following pages with the NextToken or PrevToken of a previous page.
+//
+// Pages are found with a range query on the sort keys of the last document seen rather than by skipping documents,
+// so every page is as fast as the first one given an index on the sort keys. _id is appended to the sort as a tiebreaker
+// when it is not already part of it. Sort keys that are null, missing or of mixed types are paged in the order MongoDB
+// sorts them. A projection in opts always keeps the sort fields, which the tokens are made of. Tokens are signed with
+// the key set by WithPageTokenKey, so they can safely be handed to clients, and are only accepted for the sort they
+// were created with.
+func (r *Repository[M, I]) FindPage(
+	ctx context.Context,
+	filter any,
+	sort bson.D,
+	size int64,
+	token string,
+	opts ...*options.FindOptions,
+) (*Page[M], error) {
+	ctx, span := r.startSpan(ctx, "FindPage", filter)
+	page, err := r.findPage(ctx, filter, sort, size, token, opts...)
+	err = r.classify(ctx, "FindPage", err)
+	if page != nil {
+		span.end(err, returnedKey.Int(len(page.Items)))
+	} else {
+		span.end(err)
+	}
+	return page, err
+}
+
+func (r *Repository[M, I]) findPage(
+	ctx context.Context,
+	filter any,
+	sort bson.D,
+	size int64,
+	token string,
+	opts ...*options.FindOptions,
+) (*Page[M], error) {
+	if len(r.settings.pageTokenKey) == 0 {
+		return nil, fmt.Errorf("%w: no page token key configured", ErrFindPage)
+	}
+
+	if size <= 0 {
+		return nil, fmt.Errorf("%w: page size must be positive", ErrFindPage)
+	}
+
+	keys, err := pageSortKeys(sort)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFindPage, err)
+	}
+
+	var position *pageToken
+	if token != "" {
+		position, err = decodePageToken(r.settings.pageTokenKey, token, keys)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrFindPage, err)
+		}
+	}
+
+	query, err := r.scoped(ctx, r.visible(filter))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFindPage, err)
+	}
+
+	var backward = position != nil && position.Backward
+	if position != nil {
+		query = andFilters(query, keysetFilter(keys, position.Values, backward))
+	}
+
+	var findSort = make(bson.D, len(keys))
+	for i, k := range keys {
+		var direction = k.direction
+		if backward {
+			direction = -direction
+		}
+		findSort[i] = bson.E{Key: k.field, Value: direction}
+	}
+
+	var pageOptions = options.Find().SetSort(findSort).SetSkip(0).SetLimit(size + 1)
+	if o := options.MergeFindOptions(opts...); o.Projection != nil {
+		projection, err := pageProjection(o.Projection, keys)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrFindPage, err)
+		}
+		pageOptions.SetProjection(projection)
+	}
+
+	opts = append(opts[:len(opts):len(opts)], pageOptions)
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFindPage, err)
+	}
+
+	cursor, err := collection.Find(
+		ctx,
+		query,
+		opts...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFindPage, err)
+	}
+	defer cursor.Close(ctx)
+
+	var items []M
+	var raws []bson.Raw
+	for cursor.Next(ctx) {
+		var value M
+		err := cursor.Decode(&value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decode result: %w", ErrFindPage, &decodeError{err})
+		}
+
+		err = afterFind(ctx, &value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrFindPage, err)
+		}
+
+		items = append(items, value)
+		raws = append(raws, append(bson.Raw(nil), cursor.Current...))
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("%w: cursor ended with errors: %w", ErrFindPage, err)
+	}
+
+	var more = int64(len(items)) > size
+	if more {
+		items, raws = items[:size], raws[:size]
+	}
+
+	if backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+			raws[i], raws[j] = raws[j], raws[i]
+		}
+	}
+
+	var page = &Page[M]{Items: items}
+	if len(items) == 0 {
+		return page, nil
+	}
+
+	// moving forward, there is a previous page whenever we started from a token.
+	// moving backward, there is always a next page: the one the token came from.
+	var hasPrev = position != nil
+	page.HasMore = more
+	if backward {
+		hasPrev, page.HasMore = more, true
+	}
+
+	if page.HasMore {
+		page.NextToken, err = encodePageToken(r.settings.pageTokenKey, keys, raws[len(raws)-1], false)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrFindPage, err)
+		}
+	}
+
+	if hasPrev {
+		page.PrevToken, err = encodePageToken(r.settings.pageTokenKey, keys, raws[0], true)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrFindPage, err)
+		}
+	}
+
+	return page, nil
+}
+
+// PagedResult is a page of results returned by FindPaged.
+type PagedResult[M Model] struct {
+	Items   []M   // The documents on this page.
+	Total   int64 // The number of documents that match the filter.
+	Pages   int64 // The number of pages.
+	Page    int64 // The current page, starting at 1.
+	PerPage int64 // The maximum number of documents per page.
+}
+
+// FindPaged returns the given page of documents that match the filter, ordered by sort, along with the total number
+// of matching documents. Pages start at 1.
+//
+// Items and total are computed by a single $facet aggregation, so they come from the same snapshot of the collection.
+// Because the result of the aggregation is a single document, a page must fit in the 16MB document limit.
+// For deep pagination through large collections, prefer FindPage.
+func (r *Repository[M, I]) FindPaged(
+	ctx context.Context,
+	filter any,
+	page int64,
+	perPage int64,
+	sort bson.D,
+	opts ...*options.AggregateOptions,
+) (*PagedResult[M], error) {
+	ctx, span := r.startSpan(ctx, "FindPaged", filter)
+	result, err := r.findPaged(ctx, filter, page, perPage, sort, opts...)
+	err = r.classify(ctx, "FindPaged", err)
+	if result != nil {
+		span.end(err, returnedKey.Int(len(result.Items)), countKey.Int64(result.Total))
+	} else {
+		span.end(err)
+	}
+	return result, err
+}
+
+func (r *Repository[M, I]) findPaged(
+	ctx context.Context,
+	filter any,
+	page int64,
+	perPage int64,
+	sort bson.D,
+	opts ...*options.AggregateOptions,
+) (*PagedResult[M], error) {
+	if page < 1 || perPage < 1 {
+		return nil, fmt.Errorf("%w: page and perPage must be positive", ErrFindPaged)
+	}
+
+	filter, err := r.scoped(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFindPaged, err)
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFindPaged, err)
+	}
+
+	cursor, err := collection.Aggregate(
+		ctx,
+		pagedPipeline(r.visible(filter), page, perPage, sort),
+		opts...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFindPaged, err)
+	}
+	defer cursor.Close(ctx)
+
+	var facets []struct {
+		Items []M `bson:"items"`
+		Total []struct {
+			Count int64 `bson:"count"`
+		} `bson:"total"`
+	}
+	err = cursor.All(ctx, &facets)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode results: %w", ErrFindPaged, &decodeError{err})
+	}
+
+	var result = &PagedResult[M]{
+		Page:    page,
+		PerPage: perPage,
+	}
+
+	if len(facets) == 0 {
+		return result, nil
+	}
+
+	result.Items = facets[0].Items
+	for i := range result.Items {
+		err := afterFind(ctx, &result.Items[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrFindPaged, err)
+		}
+	}
+	if len(facets[0].Total) > 0 {
+		result.Total = facets[0].Total[0].Count
+	}
+	result.Pages = (result.Total + perPage - 1) / perPage
+
+	return result, nil
+}
+
+func pagedPipeline(filter any, page int64, perPage int64, sort bson.D) mongo.Pipeline {
+	if filter == nil {
+		filter = bson.D{}
+	}
+
+	var items = bson.A{}
+	if len(sort) > 0 {
+		items = append(items, bson.D{{Key: "$sort", Value: sort}})
+	}
+	items = append(items,
+		bson.D{{Key: "$skip", Value: (page - 1) * perPage}},
+		bson.D{{Key: "$limit", Value: perPage}},
+	)
+
+	return mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$facet", Value: bson.D{
+			{Key: "items", Value: items},
+			{Key: "total", Value: bson.A{bson.D{{Key: "$count", Value: "count"}}}},
+		}}},
+	}
+}
+
+type pageSortKey struct {
+	field     string
+	direction int
+}
+
+// pageSortKeys validates the sort and appends _id as a tiebreaker.
+func pageSortKeys(sort bson.D) ([]pageSortKey, error) {
+	var keys = make([]pageSortKey, 0, len(sort)+1)
+	var hasID bool
+
+	for _, e := range sort {
+		var direction int
+		switch v := e.Value.(type) {
+		case int:
+			direction = v
+		case int32:
+			direction = int(v)
+		case int64:
+			direction = int(v)
+		case float64:
+			direction = int(v)
+		}
+
+		if direction != 1 && direction != -1 {
+			return nil, fmt.Errorf("sort direction for %q must be 1 or -1, got %v", e.Key, e.Value)
+		}
+
+		keys = append(keys, pageSortKey{field: e.Key, direction: direction})
+		hasID = hasID || e.Key == "_id"
+	}
+
+	if !hasID {
+		keys = append(keys, pageSortKey{field: "_id", direction: 1})
+	}
+
+	return keys, nil
+}
+
+// pageProjection returns the projection with the sort fields kept, since the tokens hold the sort key values of the
+// first and last documents of the page: exclusions of the sort fields are removed, and inclusion projections
+// include them.
+func pageProjection(projection any, keys []pageSortKey) (bson.D, error) {
+	raw, err := bson.Marshal(projection)
+	if err != nil {
+		return nil, fmt.Errorf("invalid projection: %w", err)
+	}
+
+	var doc bson.D
+	err = bson.Unmarshal(raw, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid projection: %w", err)
+	}
+
+	var excludes = func(v any) bool {
+		switch n := v.(type) {
+		case bool:
+			return !n
+		case int32, int64, float64:
+			return normalizeKeyValue(n) == int64(0)
+		}
+		return false
+	}
+
+	// paths overlap when one is the other or one of its parents.
+	var overlaps = func(a, b string) bool {
+		return a == b || strings.HasPrefix(a, b+".") || strings.HasPrefix(b, a+".")
+	}
+
+	var inclusion bool
+	var result = make(bson.D, 0, len(doc)+len(keys))
+	for _, e := range doc {
+		if e.Key != "_id" && !excludes(e.Value) {
+			inclusion = true
+		}
+
+		var dropped bool
+		for _, k := range keys {
+			dropped = dropped || (excludes(e.Value) && overlaps(e.Key, k.field))
+		}
+		if !dropped {
+			result = append(result, e)
+		}
+	}
+
+	if !inclusion {
+		return result, nil
+	}
+
+	for _, k := range keys {
+		var included = k.field == "_id"
+		for _, e := range result {
+			included = included || (!excludes(e.Value) && (e.Key == k.field || strings.HasPrefix(k.field, e.Key+".")))
+		}
+		if included {
+			continue
+		}
+
+		// a projection of a child path would collide with the sort field, which includes it anyway.
+		result = slices.DeleteFunc(result, func(e bson.E) bool { return strings.HasPrefix(e.Key, k.field+".") })
+		result = append(result, bson.E{Key: k.field, Value: 1})
+	}
+
+	return result, nil
+}
+
+// keysetFilter matches the documents strictly after (or before, when moving backward) the given sort key values.
+// e.g. for the sort {a: 1, _id: 1} and string values it produces
+// {$or: [{$or: [{a: {$gt: va}}, {a: {$type: [...]}}]}, {a: va, $or: [{_id: {$gt: vid}}, {_id: {$type: [...]}}]}]},
+// where the $type clauses match the values of the types sorting after strings and object IDs.
+//
+// Null values and missing fields sort as equal, so the equality {a: null} matching both is intended.
+func keysetFilter(keys []pageSortKey, values []bson.RawValue, backward bool) bson.D {
+	var clauses = make(bson.A, 0, len(keys))
+
+	for i, k := range keys {
+		var ascending = (k.direction > 0) != backward
+
+		var after = keysetAfter(k.field, values[i], ascending)
+		if len(after) == 0 {
+			continue
+		}
+
+		var clause = make(bson.D, 0, i+1)
+		for j := 0; j < i; j++ {
+			clause = append(clause, bson.E{Key: keys[j].field, Value: values[j]})
+		}
+
+		if len(after) == 1 {
+			clause = append(clause, after[0].(bson.D)...)
+		} else {
+			clause = append(clause, bson.E{Key: "$or", Value: after})
+		}
+
+		clauses = append(clauses, clause)
+	}
+
+	if len(clauses) == 0 {
+		return bson.D{{Key: "$expr", Value: false}}
+	}
+
+	return bson.D{{Key: "$or", Value: clauses}}
+}
+
+// sortTypeOrder holds the $type aliases of the BSON types, grouped in the brackets that compare with each other and
+// in the order MongoDB sorts the brackets. Missing fields sort as null.
+var sortTypeOrder = [][]string{
+	{"minKey"},
+	{"null"},
+	{"int", "long", "double", "decimal"},
+	{"symbol", "string"},
+	{"object"},
+	{"array"},
+	{"binData"},
+	{"objectId"},
+	{"bool"},
+	{"date"},
+	{"timestamp"},
+	{"regex"},
+	{"maxKey"},
+}
+
+// the brackets of sortTypeOrder values are not compared within.
+const (
+	minKeyBracket = 0
+	nullBracket   = 1
+	maxKeyBracket = 12
+)
+
+// sortTypeBracket returns the index in sortTypeOrder of a BSON type, or -1 for types that are not sorted by
+// bracket, such as JavaScript code.
+func sortTypeBracket(t bsontype.Type) int {
+	switch t {
+	case bsontype.MinKey:
+		return minKeyBracket
+	case bsontype.Null, bsontype.Undefined:
+		return nullBracket
+	case bsontype.Int32, bsontype.Int64, bsontype.Double, bsontype.Decimal128:
+		return 2
+	case bsontype.Symbol, bsontype.String:
+		return 3
+	case bsontype.EmbeddedDocument:
+		return 4
+	case bsontype.Array:
+		return 5
+	case bsontype.Binary:
+		return 6
+	case bsontype.ObjectID:
+		return 7
+	case bsontype.Boolean:
+		return 8
+	case bsontype.DateTime:
+		return 9
+	case bsontype.Timestamp:
+		return 10
+	case bsontype.Regex:
+		return 11
+	case bsontype.MaxKey:
+		return maxKeyBracket
+	}
+	return -1
+}
+
+// keysetAfter returns the alternative filters matching the values of field sorting strictly after value, in
+// ascending or descending order. Range operators only match values of the same type bracket, so the values of the
+// brackets sorting after are matched by $type, and null values and missing fields by {field: null}.
+func keysetAfter(field string, value bson.RawValue, ascending bool) bson.A {
+	var operator = "$gt"
+	if !ascending {
+		operator = "$lt"
+	}
+
+	var bracket = sortTypeBracket(value.Type)
+	if bracket < 0 {
+		return bson.A{bson.D{{Key: field, Value: bson.D{{Key: operator, Value: value}}}}}
+	}
+
+	var alternatives = bson.A{}
+	if bracket != minKeyBracket && bracket != nullBracket && bracket != maxKeyBracket {
+		alternatives = append(alternatives, bson.D{{Key: field, Value: bson.D{{Key: operator, Value: value}}}})
+	}
+
+	var types = bson.A{}
+	var null bool
+	for b, aliases := range sortTypeOrder {
+		if (ascending && b <= bracket) || (!ascending && b >= bracket) {
+			continue
+		}
+		if b == nullBracket {
+			null = true
+			continue
+		}
+		for _, alias := range aliases {
+			types = append(types, alias)
+		}
+	}
+
+	if len(types) > 0 {
+		alternatives = append(alternatives, bson.D{{Key: field, Value: bson.D{{Key: "$type", Value: types}}}})
+	}
+	if null {
+		alternatives = append(alternatives, bson.D{{Key: field, Value: nil}})
+	}
+
+	return alternatives
+}
+
+type pageToken struct {
+	Backward bool            `bson:"b"`
+	Sort     string          `bson:"s"`
+	Values   []bson.RawValue `bson:"v"`
+}
+
+func sortSignature(keys []pageSortKey) string {
+	var parts = make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s:%d", k.field, k.direction)
+	}
+	return strings.Join(parts, ",")
+}
+
+// encodePageToken creates a signed token holding the sort key values of the document.
+func encodePageToken(key []byte, keys []pageSortKey, document bson.Raw, backward bool) (string, error) {
+	var token = pageToken{
+		Backward: backward,
+		Sort:     sortSignature(keys),
+		Values:   make([]bson.RawValue, len(keys)),
+	}
+
+	for i, k := range keys {
+		value, err := document.LookupErr(strings.Split(k.field, ".")...)
+		if err != nil {
+			value = bson.RawValue{Type: bsontype.Null}
+		}
+		token.Values[i] = value
+	}
+
+	payload, err := bson.Marshal(token)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode page token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(signPageToken(key, payload)), nil
+}
+
+// decodePageToken verifies the token's signature and that it was created for the same sort.
+func decodePageToken(key []byte, encoded string, keys []pageSortKey) (*pageToken, error) {
+	payloadPart, signaturePart, ok := strings.Cut(encoded, ".")
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidPageToken)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(payloadPart)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidPageToken)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(signaturePart)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidPageToken)
+	}
+
+	if !hmac.Equal(signature, signPageToken(key, payload)) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidPageToken)
+	}
+
+	var token pageToken
+	err = bson.Unmarshal(payload, &token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPageToken, err)
+	}
+
+	if token.Sort != sortSignature(keys) || len(token.Values) != len(keys) {
+		return nil, fmt.Errorf("%w: token was created for a different sort", ErrInvalidPageToken)
+	}
+
+	return &token, nil
+}
+
+func signPageToken(key []byte, payload []byte) []byte {
+	var mac = hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
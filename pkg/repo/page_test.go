@@ -0,0 +1,473 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestPageToken(t *testing.T) {
+	var key = []byte("secret")
+	var id = primitive.NewObjectID()
+
+	keys, err := pageSortKeys(bson.D{{Key: "name", Value: -1}})
+	if err != nil {
+		t.Errorf("pageSortKeys() error = %v", err)
+		return
+	}
+
+	document, err := bson.Marshal(bson.M{"_id": id, "name": "model 1"})
+	if err != nil {
+		t.Errorf("error marshalling document: %v", err)
+		return
+	}
+
+	token, err := encodePageToken(key, keys, document, true)
+	if err != nil {
+		t.Errorf("encodePageToken() error = %v", err)
+		return
+	}
+
+	t.Run("should decode a valid token", func(t *testing.T) {
+		got, err := decodePageToken(key, token, keys)
+		if err != nil {
+			t.Errorf("decodePageToken() error = %v", err)
+			return
+		}
+		if !got.Backward || got.Values[0].StringValue() != "model 1" || got.Values[1].ObjectID() != id {
+			t.Errorf("decodePageToken() got = %+v", got)
+		}
+	})
+
+	tests := []struct {
+		name  string
+		key   []byte
+		token string
+		sort  bson.D
+	}{
+		{
+			name:  "should reject a token signed with another key",
+			key:   []byte("other secret"),
+			token: token,
+			sort:  bson.D{{Key: "name", Value: -1}},
+		},
+		{
+			name:  "should reject a tampered token",
+			key:   key,
+			token: "x" + token,
+			sort:  bson.D{{Key: "name", Value: -1}},
+		},
+		{
+			name:  "should reject a token created for another sort",
+			key:   key,
+			token: token,
+			sort:  bson.D{{Key: "name", Value: 1}},
+		},
+		{
+			name:  "should reject a malformed token",
+			key:   key,
+			token: "not a token",
+			sort:  bson.D{{Key: "name", Value: -1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := pageSortKeys(tt.sort)
+			if err != nil {
+				t.Errorf("pageSortKeys() error = %v", err)
+				return
+			}
+
+			_, err = decodePageToken(tt.key, tt.token, keys)
+			if !errors.Is(err, ErrInvalidPageToken) {
+				t.Errorf("decodePageToken() error = %v, wantErr %v", err, ErrInvalidPageToken)
+			}
+		})
+	}
+}
+
+func TestKeysetFilter(t *testing.T) {
+	var name = bson.RawValue{Type: bsontype.String}
+	var null = bson.RawValue{Type: bsontype.Null}
+	var id = bson.RawValue{Type: bsontype.ObjectID}
+
+	var afterID = bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: id}}}},
+		bson.D{{Key: "_id", Value: bson.D{{Key: "$type", Value: bson.A{"bool", "date", "timestamp", "regex", "maxKey"}}}}},
+	}}}
+
+	tests := []struct {
+		name     string
+		sort     bson.D
+		values   []bson.RawValue
+		backward bool
+		want     bson.D
+	}{
+		{
+			name:   "descending string",
+			sort:   bson.D{{Key: "name", Value: -1}},
+			values: []bson.RawValue{name, id},
+			want: bson.D{{Key: "$or", Value: bson.A{
+				bson.D{{Key: "$or", Value: bson.A{
+					bson.D{{Key: "name", Value: bson.D{{Key: "$lt", Value: name}}}},
+					bson.D{{Key: "name", Value: bson.D{{Key: "$type", Value: bson.A{"minKey", "int", "long", "double", "decimal"}}}}},
+					bson.D{{Key: "name", Value: nil}},
+				}}},
+				append(bson.D{{Key: "name", Value: name}}, afterID...),
+			}}},
+		},
+		{
+			name:   "ascending null",
+			sort:   bson.D{{Key: "name", Value: 1}},
+			values: []bson.RawValue{null, id},
+			want: bson.D{{Key: "$or", Value: bson.A{
+				bson.D{{Key: "name", Value: bson.D{{Key: "$type", Value: bson.A{
+					"int", "long", "double", "decimal", "symbol", "string", "object", "array", "binData", "objectId",
+					"bool", "date", "timestamp", "regex", "maxKey",
+				}}}}},
+				append(bson.D{{Key: "name", Value: null}}, afterID...),
+			}}},
+		},
+		{
+			name:     "backward from null",
+			sort:     bson.D{{Key: "name", Value: 1}},
+			values:   []bson.RawValue{null, id},
+			backward: true,
+			want: bson.D{{Key: "$or", Value: bson.A{
+				bson.D{{Key: "name", Value: bson.D{{Key: "$type", Value: bson.A{"minKey"}}}}},
+				bson.D{{Key: "name", Value: null}, {Key: "$or", Value: bson.A{
+					bson.D{{Key: "_id", Value: bson.D{{Key: "$lt", Value: id}}}},
+					bson.D{{Key: "_id", Value: bson.D{{Key: "$type", Value: bson.A{
+						"minKey", "int", "long", "double", "decimal", "symbol", "string", "object", "array", "binData",
+					}}}}},
+					bson.D{{Key: "_id", Value: nil}},
+				}}},
+			}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := pageSortKeys(tt.sort)
+			if err != nil {
+				t.Fatalf("pageSortKeys() error = %v", err)
+			}
+
+			got := keysetFilter(keys, tt.values, tt.backward)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("keysetFilter() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type FindPageModel struct {
+	ID   primitive.ObjectID `bson:"_id"`
+	Rank int                `bson:"rank"`
+}
+
+func (f *FindPageModel) GetDatabaseName() string {
+	return "find_page_model_db"
+}
+
+func (f *FindPageModel) GetCollectionName() string {
+	return "find_page_model_col"
+}
+
+func TestPageProjection(t *testing.T) {
+	var keys = []pageSortKey{{field: "score", direction: -1}, {field: "_id", direction: 1}}
+
+	tests := []struct {
+		name       string
+		projection any
+		want       bson.D
+	}{
+		{
+			name:       "inclusion",
+			projection: bson.D{{Key: "name", Value: 1}},
+			want:       bson.D{{Key: "name", Value: int32(1)}, {Key: "score", Value: 1}},
+		},
+		{
+			name:       "inclusion without _id",
+			projection: bson.M{"_id": 0, "score": true},
+			want:       bson.D{{Key: "score", Value: true}},
+		},
+		{
+			name:       "inclusion of a child path",
+			projection: bson.D{{Key: "name", Value: 1}, {Key: "score.total", Value: 1}},
+			want:       bson.D{{Key: "name", Value: int32(1)}, {Key: "score", Value: 1}},
+		},
+		{
+			name:       "exclusion",
+			projection: bson.D{{Key: "score", Value: 0}, {Key: "bio", Value: 0}, {Key: "_id", Value: false}},
+			want:       bson.D{{Key: "bio", Value: int32(0)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pageProjection(tt.projection, keys)
+			if err != nil {
+				t.Fatalf("pageProjection() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pageProjection() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepository_FindPage(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var repository = NewRepository[*FindPageModel, primitive.ObjectID](mongoClient, WithPageTokenKey([]byte("secret")))
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		err := mongoClient.Database("find_page_model_db").Collection("find_page_model_col").Drop(context.Background())
+		if err != nil {
+			t.Errorf("error dropping collection: %v", err)
+		}
+	}()
+
+	var inserted []*FindPageModel
+	for i := 0; i < 7; i++ {
+		inserted = append(inserted, &FindPageModel{ID: primitive.NewObjectID(), Rank: i / 2})
+	}
+
+	_, err = repository.InsertMany(ctx, inserted)
+	if err != nil {
+		t.Errorf("error inserting models: %v", err)
+		return
+	}
+
+	var sort = bson.D{{Key: "rank", Value: 1}}
+	var pages [][]*FindPageModel
+	var page = &Page[*FindPageModel]{}
+	for {
+		page, err = repository.FindPage(ctx, bson.M{}, sort, 3, page.NextToken)
+		if err != nil {
+			t.Errorf("FindPage() error = %v", err)
+			return
+		}
+		pages = append(pages, page.Items)
+		if !page.HasMore {
+			break
+		}
+	}
+
+	want := [][]*FindPageModel{inserted[0:3], inserted[3:6], inserted[6:7]}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("FindPage() got = %v, want %v", pages, want)
+		return
+	}
+
+	page, err = repository.FindPage(ctx, bson.M{}, sort, 3, page.PrevToken)
+	if err != nil {
+		t.Errorf("FindPage() error = %v", err)
+		return
+	}
+	if !reflect.DeepEqual(page.Items, inserted[3:6]) || page.PrevToken == "" || !page.HasMore {
+		t.Errorf("FindPage() previous page got = %+v, want %v", page, inserted[3:6])
+	}
+}
+
+func TestPagedPipeline(t *testing.T) {
+	got := pagedPipeline(bson.M{"rank": 1}, 3, 10, bson.D{{Key: "rank", Value: -1}})
+	want := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"rank": 1}}},
+		{{Key: "$facet", Value: bson.D{
+			{Key: "items", Value: bson.A{
+				bson.D{{Key: "$sort", Value: bson.D{{Key: "rank", Value: -1}}}},
+				bson.D{{Key: "$skip", Value: int64(20)}},
+				bson.D{{Key: "$limit", Value: int64(10)}},
+			}},
+			{Key: "total", Value: bson.A{bson.D{{Key: "$count", Value: "count"}}}},
+		}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pagedPipeline() got = %v, want %v", got, want)
+	}
+}
+
+func TestRepository_FindPaged(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var repository = NewRepository[*FindPageModel, primitive.ObjectID](mongoClient)
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		err := mongoClient.Database("find_page_model_db").Collection("find_page_model_col").Drop(context.Background())
+		if err != nil {
+			t.Errorf("error dropping collection: %v", err)
+		}
+	}()
+
+	var inserted []*FindPageModel
+	for i := 0; i < 7; i++ {
+		inserted = append(inserted, &FindPageModel{ID: primitive.NewObjectID(), Rank: i})
+	}
+
+	_, err = repository.InsertMany(ctx, inserted)
+	if err != nil {
+		t.Errorf("error inserting models: %v", err)
+		return
+	}
+
+	got, err := repository.FindPaged(ctx, bson.M{}, 3, 3, bson.D{{Key: "rank", Value: 1}})
+	if err != nil {
+		t.Errorf("FindPaged() error = %v", err)
+		return
+	}
+
+	want := &PagedResult[*FindPageModel]{Items: inserted[6:7], Total: 7, Pages: 3, Page: 3, PerPage: 3}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindPaged() got = %+v, want %+v", got, want)
+	}
+}
+
+type MixedPageModel struct {
+	ID    primitive.ObjectID `bson:"_id"`
+	Label any                `bson:"label,omitempty"`
+}
+
+func (m *MixedPageModel) GetDatabaseName() string {
+	return "mixed_page_model_db"
+}
+
+func (m *MixedPageModel) GetCollectionName() string {
+	return "mixed_page_model_col"
+}
+
+func TestRepository_FindPage_mixedTypes(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var repository = NewRepository[*MixedPageModel, primitive.ObjectID](mongoClient, WithPageTokenKey([]byte("secret")))
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var collection = mongoClient.Database("mixed_page_model_db").Collection("mixed_page_model_col")
+	defer func() {
+		err := collection.Drop(context.Background())
+		if err != nil {
+			t.Errorf("error dropping collection: %v", err)
+		}
+	}()
+
+	// null, missing, numbers, strings and dates, inserted out of order.
+	var documents = []any{
+		bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "label", Value: "b"}},
+		bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "label", Value: nil}},
+		bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "label", Value: 2}},
+		bson.D{{Key: "_id", Value: primitive.NewObjectID()}},
+		bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "label", Value: "a"}},
+		bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "label", Value: time.Now()}},
+		bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "label", Value: 1.5}},
+		bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "label", Value: nil}},
+		bson.D{{Key: "_id", Value: primitive.NewObjectID()}},
+	}
+	_, err = collection.InsertMany(ctx, documents)
+	if err != nil {
+		t.Errorf("error inserting documents: %v", err)
+		return
+	}
+
+	for _, direction := range []int{1, -1} {
+		var sort = bson.D{{Key: "label", Value: direction}}
+
+		var want []primitive.ObjectID
+		all, err := repository.Find(ctx, bson.M{}, options.Find().SetSort(append(sort, bson.E{Key: "_id", Value: 1})))
+		if err != nil {
+			t.Errorf("Find() error = %v", err)
+			return
+		}
+		for _, document := range all {
+			want = append(want, document.ID)
+		}
+
+		var got []primitive.ObjectID
+		var page = &Page[*MixedPageModel]{}
+		for {
+			page, err = repository.FindPage(ctx, bson.M{}, sort, 2, page.NextToken)
+			if err != nil {
+				t.Errorf("FindPage() error = %v", err)
+				return
+			}
+			for _, document := range page.Items {
+				got = append(got, document.ID)
+			}
+			if !page.HasMore {
+				break
+			}
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("FindPage() direction %d got = %v, want %v", direction, got, want)
+		}
+
+		// walking back from the last page visits the same documents.
+		var last = len(page.Items)
+		var back []primitive.ObjectID
+		for page.PrevToken != "" {
+			page, err = repository.FindPage(ctx, bson.M{}, sort, 2, page.PrevToken)
+			if err != nil {
+				t.Errorf("FindPage() error = %v", err)
+				return
+			}
+
+			var ids []primitive.ObjectID
+			for _, document := range page.Items {
+				ids = append(ids, document.ID)
+			}
+			back = append(ids, back...)
+		}
+
+		if !reflect.DeepEqual(back, want[:len(want)-last]) {
+			t.Errorf("FindPage() direction %d backward got = %v, want %v", direction, back, want[:len(want)-last])
+		}
+	}
+}
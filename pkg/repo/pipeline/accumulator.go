@@ -0,0 +1,65 @@
+package pipeline
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// Accumulator computes an output field of a $group or $bucket stage.
+// Accumulators are created with the functions of this package, e.g. Sum("total", "$amount").
+type Accumulator struct {
+	Field      string // The output field.
+	Operator   string // The accumulator operator, e.g. $sum.
+	Expression any    // The expression the operator is applied to.
+}
+
+func (a Accumulator) element() bson.E {
+	return bson.E{Key: a.Field, Value: bson.D{{Key: a.Operator, Value: a.Expression}}}
+}
+
+// Sum returns the sum of the expression, e.g. Sum("count", 1) counts documents.
+func Sum(field string, expression any) Accumulator {
+	return Accumulator{Field: field, Operator: "$sum", Expression: expression}
+}
+
+// Avg returns the average of the expression.
+func Avg(field string, expression any) Accumulator {
+	return Accumulator{Field: field, Operator: "$avg", Expression: expression}
+}
+
+// Min returns the lowest value of the expression.
+func Min(field string, expression any) Accumulator {
+	return Accumulator{Field: field, Operator: "$min", Expression: expression}
+}
+
+// Max returns the highest value of the expression.
+func Max(field string, expression any) Accumulator {
+	return Accumulator{Field: field, Operator: "$max", Expression: expression}
+}
+
+// First returns the value of the expression for the first document of the group.
+func First(field string, expression any) Accumulator {
+	return Accumulator{Field: field, Operator: "$first", Expression: expression}
+}
+
+// Last returns the value of the expression for the last document of the group.
+func Last(field string, expression any) Accumulator {
+	return Accumulator{Field: field, Operator: "$last", Expression: expression}
+}
+
+// Push returns an array of the values of the expression.
+func Push(field string, expression any) Accumulator {
+	return Accumulator{Field: field, Operator: "$push", Expression: expression}
+}
+
+// AddToSet returns an array of the unique values of the expression.
+func AddToSet(field string, expression any) Accumulator {
+	return Accumulator{Field: field, Operator: "$addToSet", Expression: expression}
+}
+
+// StdDevPop returns the population standard deviation of the expression.
+func StdDevPop(field string, expression any) Accumulator {
+	return Accumulator{Field: field, Operator: "$stdDevPop", Expression: expression}
+}
+
+// StdDevSamp returns the sample standard deviation of the expression.
+func StdDevSamp(field string, expression any) Accumulator {
+	return Accumulator{Field: field, Operator: "$stdDevSamp", Expression: expression}
+}
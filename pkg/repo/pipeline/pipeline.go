@@ -0,0 +1,470 @@
+// Package pipeline provides a fluent builder for aggregation pipelines.
+//
+// Stages are added with one method per stage, and Build validates the stages and their order before
+// returning a mongo.Pipeline that can be passed to repo.Aggregate or repo.AggregateStream.
+//
+// example:
+//
+//	p, err := pipeline.New().
+//		Match(bson.M{"active": true}).
+//		Group("$country", pipeline.Sum("count", 1), pipeline.Avg("age", "$age")).
+//		Sort(bson.D{{Key: "count", Value: -1}}).
+//		Limit(10).
+//		Build()
+//	if err != nil {
+//		return err
+//	}
+//
+//	results, err := repo.Aggregate[UsersPerCountry](ctx, usersRepo, p)
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrInvalidStage = fmt.Errorf("invalid stage")
+	ErrStageOrder   = fmt.Errorf("invalid stage order")
+)
+
+type stage struct {
+	name string
+	spec any
+	err  error
+}
+
+// Builder builds an aggregation pipeline.
+// Invalid stages do not stop the chain; their errors are reported by Build.
+type Builder struct {
+	stages []stage
+}
+
+// New returns an empty pipeline builder.
+func New() *Builder {
+	return &Builder{}
+}
+
+func (b *Builder) add(name string, spec any, err error) *Builder {
+	if err != nil {
+		err = fmt.Errorf("%w: %s: %w", ErrInvalidStage, name, err)
+	}
+	b.stages = append(b.stages, stage{name: name, spec: spec, err: err})
+	return b
+}
+
+// Match filters the documents, e.g. Match(bson.M{"status": "active"}).
+func (b *Builder) Match(filter any) *Builder {
+	if filter == nil {
+		filter = bson.D{}
+	}
+	return b.add("$match", filter, nil)
+}
+
+// Project reshapes the documents, e.g. Project(bson.D{{Key: "name", Value: 1}}).
+func (b *Builder) Project(projection any) *Builder {
+	var err error
+	if projection == nil {
+		err = fmt.Errorf("projection must not be nil")
+	}
+	return b.add("$project", projection, err)
+}
+
+// Group groups the documents by the id expression and computes the accumulators for each group.
+// Use nil as id to compute the accumulators over all documents.
+func (b *Builder) Group(id any, accumulators ...Accumulator) *Builder {
+	var spec = bson.D{{Key: "_id", Value: id}}
+	for _, a := range accumulators {
+		spec = append(spec, a.element())
+	}
+	return b.add("$group", spec, validateAccumulators(accumulators))
+}
+
+// Sort sorts the documents. Directions must be 1, -1 or a $meta expression.
+func (b *Builder) Sort(sort bson.D) *Builder {
+	var err error
+	if len(sort) == 0 {
+		err = fmt.Errorf("sort must have at least one key")
+	}
+	for _, e := range sort {
+		switch v := e.Value.(type) {
+		case int:
+			if v != 1 && v != -1 {
+				err = fmt.Errorf("sort direction for %q must be 1 or -1", e.Key)
+			}
+		case int32:
+			if v != 1 && v != -1 {
+				err = fmt.Errorf("sort direction for %q must be 1 or -1", e.Key)
+			}
+		case int64:
+			if v != 1 && v != -1 {
+				err = fmt.Errorf("sort direction for %q must be 1 or -1", e.Key)
+			}
+		case bson.D, bson.M:
+		default:
+			err = fmt.Errorf("sort direction for %q must be 1, -1 or a $meta expression", e.Key)
+		}
+	}
+	return b.add("$sort", sort, err)
+}
+
+// Limit passes at most n documents to the next stage.
+func (b *Builder) Limit(n int64) *Builder {
+	var err error
+	if n <= 0 {
+		err = fmt.Errorf("limit must be positive")
+	}
+	return b.add("$limit", n, err)
+}
+
+// Skip skips the first n documents.
+func (b *Builder) Skip(n int64) *Builder {
+	var err error
+	if n < 0 {
+		err = fmt.Errorf("skip must not be negative")
+	}
+	return b.add("$skip", n, err)
+}
+
+// Unwind outputs one document per element of the array at path, e.g. Unwind("$tags").
+func (b *Builder) Unwind(path string) *Builder {
+	return b.UnwindWith(Unwind{Path: path})
+}
+
+// Unwind configures an $unwind stage.
+type Unwind struct {
+	Path                       string // The array field, prefixed with $.
+	IncludeArrayIndex          string // Optional field that receives the element's index.
+	PreserveNullAndEmptyArrays bool   // Whether documents without elements are kept.
+}
+
+// UnwindWith adds an $unwind stage with options.
+func (b *Builder) UnwindWith(u Unwind) *Builder {
+	var err error
+	if !strings.HasPrefix(u.Path, "$") {
+		err = fmt.Errorf("path %q must be prefixed with $", u.Path)
+	}
+	if strings.HasPrefix(u.IncludeArrayIndex, "$") {
+		err = fmt.Errorf("includeArrayIndex %q must not be prefixed with $", u.IncludeArrayIndex)
+	}
+
+	var spec = bson.D{{Key: "path", Value: u.Path}}
+	if u.IncludeArrayIndex != "" {
+		spec = append(spec, bson.E{Key: "includeArrayIndex", Value: u.IncludeArrayIndex})
+	}
+	if u.PreserveNullAndEmptyArrays {
+		spec = append(spec, bson.E{Key: "preserveNullAndEmptyArrays", Value: true})
+	}
+	return b.add("$unwind", spec, err)
+}
+
+// Lookup configures a $lookup stage.
+// Either LocalField and ForeignField, or Pipeline (optionally with Let), or both must be set.
+type Lookup struct {
+	From         string   // The collection to join.
+	LocalField   string   // The field of the input documents.
+	ForeignField string   // The field of the joined documents.
+	Let          bson.D   // Variables usable in Pipeline.
+	Pipeline     *Builder // The pipeline run on the joined collection.
+	As           string   // The output array field.
+}
+
+// Lookup joins documents from another collection.
+func (b *Builder) Lookup(l Lookup) *Builder {
+	var errs []error
+	if l.From == "" {
+		errs = append(errs, fmt.Errorf("from is required"))
+	}
+	if l.As == "" {
+		errs = append(errs, fmt.Errorf("as is required"))
+	}
+	if (l.LocalField == "") != (l.ForeignField == "") {
+		errs = append(errs, fmt.Errorf("localField and foreignField must be set together"))
+	}
+	if l.LocalField == "" && l.Pipeline == nil {
+		errs = append(errs, fmt.Errorf("either localField and foreignField or pipeline is required"))
+	}
+
+	var spec = bson.D{{Key: "from", Value: l.From}}
+	if l.LocalField != "" {
+		spec = append(spec,
+			bson.E{Key: "localField", Value: l.LocalField},
+			bson.E{Key: "foreignField", Value: l.ForeignField},
+		)
+	}
+	if l.Let != nil {
+		spec = append(spec, bson.E{Key: "let", Value: l.Let})
+	}
+	if l.Pipeline != nil {
+		sub, err := l.Pipeline.build(nested)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("pipeline: %w", err))
+		}
+		spec = append(spec, bson.E{Key: "pipeline", Value: sub})
+	}
+	spec = append(spec, bson.E{Key: "as", Value: l.As})
+
+	return b.add("$lookup", spec, errors.Join(errs...))
+}
+
+// Facet runs several sub-pipelines on the same input documents, each output in its own field.
+// Fields are output in alphabetical order.
+func (b *Builder) Facet(facets map[string]*Builder) *Builder {
+	var errs []error
+	if len(facets) == 0 {
+		errs = append(errs, fmt.Errorf("at least one facet is required"))
+	}
+
+	var names = make([]string, 0, len(facets))
+	for name := range facets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var spec = make(bson.D, 0, len(facets))
+	for _, name := range names {
+		if err := validateFieldName(name); err != nil {
+			errs = append(errs, err)
+		}
+
+		sub, err := facets[name].build(inFacet)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("facet %q: %w", name, err))
+		}
+		spec = append(spec, bson.E{Key: name, Value: sub})
+	}
+
+	return b.add("$facet", spec, errors.Join(errs...))
+}
+
+// AddFields adds or replaces fields, e.g. AddFields(bson.D{{Key: "total", Value: bson.D{{Key: "$add", Value: bson.A{"$a", "$b"}}}}}).
+func (b *Builder) AddFields(fields bson.D) *Builder {
+	var err error
+	if len(fields) == 0 {
+		err = fmt.Errorf("at least one field is required")
+	}
+	return b.add("$addFields", fields, err)
+}
+
+// ReplaceRoot replaces each document with the result of the expression, e.g. ReplaceRoot("$profile").
+func (b *Builder) ReplaceRoot(newRoot any) *Builder {
+	var err error
+	if newRoot == nil {
+		err = fmt.Errorf("newRoot is required")
+	}
+	return b.add("$replaceRoot", bson.D{{Key: "newRoot", Value: newRoot}}, err)
+}
+
+// Count outputs a single document with the number of input documents in field.
+func (b *Builder) Count(field string) *Builder {
+	return b.add("$count", field, validateFieldName(field))
+}
+
+// Bucket configures a $bucket stage.
+type Bucket struct {
+	GroupBy    any           // The expression documents are grouped by.
+	Boundaries bson.A        // The sorted lower bounds of each bucket, followed by the upper bound of the last one.
+	Default    any           // Optional bucket for documents outside the boundaries.
+	Output     []Accumulator // Optional output fields; defaults to a count.
+}
+
+// Bucket groups documents into buckets by ranges of the GroupBy expression.
+func (b *Builder) Bucket(bucket Bucket) *Builder {
+	var errs []error
+	if bucket.GroupBy == nil {
+		errs = append(errs, fmt.Errorf("groupBy is required"))
+	}
+	if len(bucket.Boundaries) < 2 {
+		errs = append(errs, fmt.Errorf("at least two boundaries are required"))
+	}
+	if err := validateAccumulators(bucket.Output); err != nil {
+		errs = append(errs, err)
+	}
+
+	var spec = bson.D{
+		{Key: "groupBy", Value: bucket.GroupBy},
+		{Key: "boundaries", Value: bucket.Boundaries},
+	}
+	if bucket.Default != nil {
+		spec = append(spec, bson.E{Key: "default", Value: bucket.Default})
+	}
+	if len(bucket.Output) > 0 {
+		var output = make(bson.D, len(bucket.Output))
+		for i, a := range bucket.Output {
+			output[i] = a.element()
+		}
+		spec = append(spec, bson.E{Key: "output", Value: output})
+	}
+
+	return b.add("$bucket", spec, errors.Join(errs...))
+}
+
+// Merge configures a $merge stage.
+type Merge struct {
+	Database       string   // Optional output database; defaults to the current one.
+	Collection     string   // The output collection.
+	On             []string // Optional fields that identify a document; defaults to _id.
+	Let            bson.D   // Optional variables usable in a WhenMatched pipeline.
+	WhenMatched    any      // "replace", "keepExisting", "merge", "fail" or a pipeline.
+	WhenNotMatched string   // "insert", "discard" or "fail".
+}
+
+// Merge writes the results into a collection, merging them with existing documents. It must be the last stage.
+func (b *Builder) Merge(m Merge) *Builder {
+	var err error
+	if m.Collection == "" {
+		err = fmt.Errorf("collection is required")
+	}
+
+	var into any = m.Collection
+	if m.Database != "" {
+		into = bson.D{{Key: "db", Value: m.Database}, {Key: "coll", Value: m.Collection}}
+	}
+
+	var spec = bson.D{{Key: "into", Value: into}}
+	if len(m.On) == 1 {
+		spec = append(spec, bson.E{Key: "on", Value: m.On[0]})
+	} else if len(m.On) > 1 {
+		spec = append(spec, bson.E{Key: "on", Value: m.On})
+	}
+	if m.Let != nil {
+		spec = append(spec, bson.E{Key: "let", Value: m.Let})
+	}
+	if m.WhenMatched != nil {
+		spec = append(spec, bson.E{Key: "whenMatched", Value: m.WhenMatched})
+	}
+	if m.WhenNotMatched != "" {
+		spec = append(spec, bson.E{Key: "whenNotMatched", Value: m.WhenNotMatched})
+	}
+
+	return b.add("$merge", spec, err)
+}
+
+// Out writes the results into a collection of the current database, replacing it. It must be the last stage.
+func (b *Builder) Out(collection string) *Builder {
+	var err error
+	if collection == "" {
+		err = fmt.Errorf("collection is required")
+	}
+	return b.add("$out", collection, err)
+}
+
+// OutTo works like Out, but writes into a collection of another database.
+func (b *Builder) OutTo(database, collection string) *Builder {
+	var err error
+	if database == "" || collection == "" {
+		err = fmt.Errorf("database and collection are required")
+	}
+	return b.add("$out", bson.D{{Key: "db", Value: database}, {Key: "coll", Value: collection}}, err)
+}
+
+// Stage adds a stage the builder has no method for, e.g. Stage("$sample", bson.D{{Key: "size", Value: 5}}).
+func (b *Builder) Stage(name string, spec any) *Builder {
+	var err error
+	if !strings.HasPrefix(name, "$") {
+		err = fmt.Errorf("stage name must be prefixed with $")
+	}
+	return b.add(name, spec, err)
+}
+
+// Build validates the stages and returns the pipeline.
+// All invalid stages are reported, each wrapping ErrInvalidStage or ErrStageOrder.
+func (b *Builder) Build() (mongo.Pipeline, error) {
+	return b.build(topLevel)
+}
+
+// MustBuild works like Build, but panics if the pipeline is invalid.
+// It is meant for pipelines defined once, e.g. in package level variables.
+func (b *Builder) MustBuild() mongo.Pipeline {
+	p, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+type placement int
+
+const (
+	topLevel placement = iota
+	inFacet
+	nested
+)
+
+// stages that can only be the last stage of a top level pipeline.
+var outputStages = map[string]bool{"$out": true, "$merge": true}
+
+// stages that are not allowed inside $facet.
+var facetForbidden = map[string]bool{
+	"$out": true, "$merge": true, "$facet": true, "$collStats": true,
+	"$indexStats": true, "$geoNear": true, "$changeStream": true,
+}
+
+func (b *Builder) build(where placement) (mongo.Pipeline, error) {
+	if b == nil {
+		return nil, fmt.Errorf("%w: pipeline is nil", ErrInvalidStage)
+	}
+
+	var errs []error
+	var p = make(mongo.Pipeline, 0, len(b.stages))
+
+	for i, s := range b.stages {
+		if s.err != nil {
+			errs = append(errs, fmt.Errorf("stage %d: %w", i, s.err))
+		}
+
+		switch {
+		case where == inFacet && facetForbidden[s.name]:
+			errs = append(errs, fmt.Errorf("%w: stage %d: %s is not allowed in $facet", ErrStageOrder, i, s.name))
+		case where == nested && outputStages[s.name]:
+			errs = append(errs, fmt.Errorf("%w: stage %d: %s is not allowed in a sub-pipeline", ErrStageOrder, i, s.name))
+		case outputStages[s.name] && i != len(b.stages)-1:
+			errs = append(errs, fmt.Errorf("%w: stage %d: %s must be the last stage", ErrStageOrder, i, s.name))
+		case s.name == "$geoNear" && i != 0:
+			errs = append(errs, fmt.Errorf("%w: stage %d: $geoNear must be the first stage", ErrStageOrder, i))
+		}
+
+		p = append(p, bson.D{{Key: s.name, Value: s.spec}})
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return p, nil
+}
+
+func validateFieldName(field string) error {
+	if field == "" {
+		return fmt.Errorf("field name must not be empty")
+	}
+	if strings.HasPrefix(field, "$") || strings.Contains(field, ".") {
+		return fmt.Errorf("field name %q must not start with $ or contain a dot", field)
+	}
+	return nil
+}
+
+func validateAccumulators(accumulators []Accumulator) error {
+	var errs []error
+	var seen = make(map[string]bool)
+
+	for _, a := range accumulators {
+		if err := validateFieldName(a.Field); err != nil {
+			errs = append(errs, err)
+		}
+		if a.Field == "_id" {
+			errs = append(errs, fmt.Errorf("accumulator field must not be _id"))
+		}
+		if seen[a.Field] {
+			errs = append(errs, fmt.Errorf("duplicate accumulator field %q", a.Field))
+		}
+		seen[a.Field] = true
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,136 @@
+package pipeline
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestBuilder_Build(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *Builder
+		want    mongo.Pipeline
+		wantErr error
+	}{
+		{
+			name: "should build match, group, sort and limit stages",
+			builder: New().
+				Match(bson.M{"active": true}).
+				Group("$country", Sum("count", 1), Avg("age", "$age")).
+				Sort(bson.D{{Key: "count", Value: -1}}).
+				Limit(10),
+			want: mongo.Pipeline{
+				{{Key: "$match", Value: bson.M{"active": true}}},
+				{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: "$country"},
+					{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+					{Key: "age", Value: bson.D{{Key: "$avg", Value: "$age"}}},
+				}}},
+				{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}}}},
+				{{Key: "$limit", Value: int64(10)}},
+			},
+		},
+		{
+			name: "should build lookup, unwind and facet stages",
+			builder: New().
+				Lookup(Lookup{From: "orders", LocalField: "_id", ForeignField: "userId", As: "orders"}).
+				UnwindWith(Unwind{Path: "$orders", PreserveNullAndEmptyArrays: true}).
+				Facet(map[string]*Builder{
+					"total": New().Count("count"),
+					"top":   New().Skip(0).Limit(3),
+				}),
+			want: mongo.Pipeline{
+				{{Key: "$lookup", Value: bson.D{
+					{Key: "from", Value: "orders"},
+					{Key: "localField", Value: "_id"},
+					{Key: "foreignField", Value: "userId"},
+					{Key: "as", Value: "orders"},
+				}}},
+				{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$orders"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}},
+				{{Key: "$facet", Value: bson.D{
+					{Key: "top", Value: mongo.Pipeline{
+						{{Key: "$skip", Value: int64(0)}},
+						{{Key: "$limit", Value: int64(3)}},
+					}},
+					{Key: "total", Value: mongo.Pipeline{
+						{{Key: "$count", Value: "count"}},
+					}},
+				}}},
+			},
+		},
+		{
+			name: "should build a merge stage as the last stage",
+			builder: New().
+				AddFields(bson.D{{Key: "processed", Value: true}}).
+				Merge(Merge{Collection: "archive", On: []string{"_id"}, WhenMatched: "replace"}),
+			want: mongo.Pipeline{
+				{{Key: "$addFields", Value: bson.D{{Key: "processed", Value: true}}}},
+				{{Key: "$merge", Value: bson.D{
+					{Key: "into", Value: "archive"},
+					{Key: "on", Value: "_id"},
+					{Key: "whenMatched", Value: "replace"},
+				}}},
+			},
+		},
+		{
+			name:    "should reject $out before the last stage",
+			builder: New().Out("archive").Limit(1),
+			wantErr: ErrStageOrder,
+		},
+		{
+			name:    "should reject $merge inside $facet",
+			builder: New().Facet(map[string]*Builder{"out": New().Merge(Merge{Collection: "archive"})}),
+			wantErr: ErrStageOrder,
+		},
+		{
+			name:    "should reject $out inside a $lookup pipeline",
+			builder: New().Lookup(Lookup{From: "orders", Pipeline: New().Out("archive"), As: "orders"}),
+			wantErr: ErrStageOrder,
+		},
+		{
+			name:    "should reject duplicate accumulators",
+			builder: New().Group(nil, Sum("total", "$a"), Max("total", "$b")),
+			wantErr: ErrInvalidStage,
+		},
+		{
+			name:    "should reject an unwind path without $",
+			builder: New().Unwind("tags"),
+			wantErr: ErrInvalidStage,
+		},
+		{
+			name:    "should reject a non positive limit",
+			builder: New().Limit(0),
+			wantErr: ErrInvalidStage,
+		},
+		{
+			name:    "should reject a bucket with a single boundary",
+			builder: New().Bucket(Bucket{GroupBy: "$age", Boundaries: bson.A{0}}),
+			wantErr: ErrInvalidStage,
+		},
+		{
+			name:    "should reject a lookup without as",
+			builder: New().Lookup(Lookup{From: "orders", LocalField: "_id", ForeignField: "userId"}),
+			wantErr: ErrInvalidStage,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.builder.Build()
+			if tt.wantErr != nil && (err == nil || !errors.Is(err, tt.wantErr)) {
+				t.Errorf("Build() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("Build() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Build() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,24 +2,59 @@ package repo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"github.com/AISystemsInc/mongo-resource-repo/pkg/repo/internal/meta"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
-	ErrFindOne    = fmt.Errorf("find one error")
-	ErrFind       = fmt.Errorf("find error")
-	ErrFindStream = fmt.Errorf("find stream error")
-	ErrInsertOne  = fmt.Errorf("insert one error")
-	ErrInsertMany = fmt.Errorf("insert many error")
-	ErrUpdateOne  = fmt.Errorf("update one error")
-	ErrUpdateByID = fmt.Errorf("update by ID error")
-	ErrUpdateMany = fmt.Errorf("update many error")
-	ErrDeleteOne  = fmt.Errorf("delete one error")
-	ErrDeleteMany = fmt.Errorf("delete many error")
-	ErrCount      = fmt.Errorf("count error")
+	ErrFindOne     = fmt.Errorf("find one error")
+	ErrFind        = fmt.Errorf("find error")
+	ErrFindStream  = fmt.Errorf("find stream error")
+	ErrIterate     = fmt.Errorf("iterate error")
+	ErrInsertOne   = fmt.Errorf("insert one error")
+	ErrInsertMany  = fmt.Errorf("insert many error")
+	ErrUpdateOne   = fmt.Errorf("update one error")
+	ErrUpdateByID  = fmt.Errorf("update by ID error")
+	ErrUpdateMany  = fmt.Errorf("update many error")
+	ErrDeleteOne   = fmt.Errorf("delete one error")
+	ErrDeleteMany  = fmt.Errorf("delete many error")
+	ErrCount       = fmt.Errorf("count error")
+	ErrFindPage    = fmt.Errorf("find page error")
+	ErrFindPaged   = fmt.Errorf("find paged error")
+	ErrAggregate   = fmt.Errorf("aggregate error")
+	ErrTransaction = fmt.Errorf("transaction error")
+
+	ErrFindWithDeleted = fmt.Errorf("find with deleted error")
+	ErrRestore         = fmt.Errorf("restore error")
+	ErrPurgeDeleted    = fmt.Errorf("purge deleted error")
+	ErrSaveVersioned   = fmt.Errorf("save versioned error")
+	ErrAudit           = fmt.Errorf("audit error")
+	ErrWatch           = fmt.Errorf("watch error")
+	ErrEnsureIndexes   = fmt.Errorf("ensure indexes error")
+	ErrCache           = fmt.Errorf("cache error")
+	ErrSchema          = fmt.Errorf("schema error")
+	ErrInsertStream    = fmt.Errorf("insert stream error")
+	ErrBulkWrite       = fmt.Errorf("bulk write error")
+
+	ErrFindOneAndUpdate  = fmt.Errorf("find one and update error")
+	ErrFindOneAndReplace = fmt.Errorf("find one and replace error")
+	ErrFindOneAndDelete  = fmt.Errorf("find one and delete error")
+
+	ErrInvalidPageToken = fmt.Errorf("invalid page token")
+	ErrHook             = fmt.Errorf("hook error")
+	ErrValidation       = fmt.Errorf("validation error")
+	ErrNoSoftDelete     = fmt.Errorf("model is not soft deleted")
+	ErrVersionConflict  = fmt.Errorf("version conflict")
+	ErrNoTenant         = fmt.Errorf("no tenant in context")
+	ErrInvalidTenant    = fmt.Errorf("invalid tenant")
+	ErrScope            = fmt.Errorf("scope error")
+	ErrNotFound         = fmt.Errorf("not found")
+	ErrDuplicateKey     = fmt.Errorf("duplicate key")
 )
 
 // Repository is a generic repository for a model.
@@ -27,18 +62,26 @@ type Repository[M Model, I any] struct {
 	client         *mongo.Client
 	databaseName   string
 	collectionName string
+	settings       settings
 }
 
 // NewRepository creates a new repository for a model.
 // The model must implement the Model interface.
+// Optional behaviour can be enabled by passing options.
 // e.g. usersRepo := NewRepository[*User](client)
-func NewRepository[M Model, I any](client *mongo.Client) *Repository[M, I] {
+func NewRepository[M Model, I any](client *mongo.Client, opts ...Option) *Repository[M, I] {
 	var v M
-	return &Repository[M, I]{
+	var r = &Repository[M, I]{
 		client:         client,
 		databaseName:   v.GetDatabaseName(),
 		collectionName: v.GetCollectionName(),
 	}
+
+	for _, opt := range opts {
+		opt(&r.settings)
+	}
+
+	return r
 }
 
 // FindOne returns the first document that matches the filter.
@@ -47,114 +90,278 @@ func (r *Repository[M, I]) FindOne(
 	filter any,
 	opts ...*options.FindOneOptions,
 ) (M, error) {
-	result := r.client.Database(r.databaseName).Collection(r.collectionName).FindOne(
+	ctx, span := r.startSpan(ctx, "FindOne", filter)
+	value, err := r.findOne(ctx, filter, opts...)
+	err = r.classify(ctx, "FindOne", err)
+	span.end(err, returnedKey.Int(single(err)))
+	return value, err
+}
+
+func (r *Repository[M, I]) findOne(
+	ctx context.Context,
+	filter any,
+	opts ...*options.FindOneOptions,
+) (M, error) {
+	var value M
+
+	filter, err := r.scoped(ctx, filter)
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOne, err)
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return value, fmt.Errorf("%w: %w", ErrFindOne, err)
+	}
+
+	result := collection.FindOne(
 		ctx,
-		filter,
+		r.visible(filter),
 		opts...,
 	)
 
-	var value M
-
 	if result.Err() != nil {
 		return value, fmt.Errorf("%w: %w", ErrFindOne, result.Err())
 	}
 
-	err := result.Decode(&value)
+	err = result.Decode(&value)
+	if err != nil {
+		return value, fmt.Errorf("%w: failed to decode result: %w", ErrFindOne, &decodeError{err})
+	}
+
+	err = afterFind(ctx, &value)
 	if err != nil {
-		return value, fmt.Errorf("%w: failed to decode result: %w", ErrFindOne, err)
+		return value, fmt.Errorf("%w: %w", ErrFindOne, err)
 	}
 
 	return value, nil
 }
 
+// FindByID returns the document with the given ID.
+func (r *Repository[M, I]) FindByID(
+	ctx context.Context,
+	id I,
+	opts ...*options.FindOneOptions,
+) (M, error) {
+	return r.FindOne(ctx, bson.D{{Key: "_id", Value: id}}, opts...)
+}
+
 // Find returns all documents that match the filter.
 func (r *Repository[M, I]) Find(
 	ctx context.Context,
 	filter any,
 	opts ...*options.FindOptions,
 ) ([]M, error) {
-	cursor, err := r.client.Database(r.databaseName).Collection(r.collectionName).Find(
+	ctx, span := r.startSpan(ctx, "Find", filter)
+	values, err := r.find(ctx, ErrFind, r.visible(filter), opts...)
+	err = r.classify(ctx, "Find", err)
+	span.end(err, returnedKey.Int(len(values)))
+	return values, err
+}
+
+func (r *Repository[M, I]) find(
+	ctx context.Context,
+	sentinel error,
+	filter any,
+	opts ...*options.FindOptions,
+) ([]M, error) {
+	filter, err := r.scoped(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", sentinel, err)
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", sentinel, err)
+	}
+
+	cursor, err := collection.Find(
 		ctx,
 		filter,
 		opts...,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %w", ErrFind, err)
+		return nil, fmt.Errorf("%w: %w", sentinel, err)
 	}
 
 	var values []M
 	err = cursor.All(ctx, &values)
 	if err != nil {
-		return nil, fmt.Errorf("%w: failed to decode results: %w", ErrFind, err)
+		return nil, fmt.Errorf("%w: failed to decode results: %w", sentinel, &decodeError{err})
+	}
+
+	for i := range values {
+		err := afterFind(ctx, &values[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", sentinel, err)
+		}
 	}
 
 	return values, nil
 }
 
+// Iterate returns a Cursor over all documents that match the filter.
+// Unlike Find, documents are decoded one at a time as the caller advances the cursor.
+func (r *Repository[M, I]) Iterate(
+	ctx context.Context,
+	filter any,
+	opts ...*options.FindOptions,
+) (*Cursor[M], error) {
+	ctx, span := r.startSpan(ctx, "Iterate", filter)
+	cursor, err := r.iterate(ctx, ErrIterate, filter, opts...)
+	err = r.classify(ctx, "Iterate", err)
+	if cursor != nil {
+		cursor.op, cursor.namespace = "Iterate", r.operationNamespace(ctx)
+	}
+	span.end(err)
+	return cursor, err
+}
+
+func (r *Repository[M, I]) iterate(
+	ctx context.Context,
+	sentinel error,
+	filter any,
+	opts ...*options.FindOptions,
+) (*Cursor[M], error) {
+	filter, err := r.scoped(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", sentinel, err)
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", sentinel, err)
+	}
+
+	cursor, err := collection.Find(
+		ctx,
+		r.visible(filter),
+		opts...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", sentinel, err)
+	}
+
+	return newCursor[M](cursor, sentinel, true), nil
+}
+
 // FindStream works like Find, but returns a channel of results and a channel of errors.
-// both values and error channels are closed when the cursor is exhausted, an error occurs or the cancel channel is closed.
+// both values and error channels are closed when the cursor is exhausted, an error occurs, the context is done
+// or the cancel channel is closed.
 // the cancel channel can be used to stop the stream before it is exhausted by closing it.
-// the caller is responsible for closing the cancel channel.
+// the caller is responsible for closing the cancel channel, exactly once.
+//
+// Deprecated: use Iterate, which does not need a goroutine or channels.
 func (r *Repository[M, I]) FindStream(
 	ctx context.Context,
 	filter any,
 	opts ...*options.FindOptions,
 ) (chan M, chan error, chan struct{}, error) {
-	cursor, err := r.client.Database(r.databaseName).Collection(r.collectionName).Find(
-		ctx,
-		filter,
-		opts...,
-	)
+	ctx, span := r.startSpan(ctx, "FindStream", filter)
+	cursor, err := r.iterate(ctx, ErrFindStream, filter, opts...)
+	err = r.classify(ctx, "FindStream", err)
+	if cursor != nil {
+		cursor.op, cursor.namespace = "FindStream", r.operationNamespace(ctx)
+	}
+	span.end(err)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("%w: %w", ErrFindStream, err)
+		return nil, nil, nil, err
 	}
 
-	var values = make(chan M)
+	values, errors, cancel := stream(ctx, cursor)
+	return values, errors, cancel, nil
+}
+
+// stream feeds the cursor into channels, as returned by FindStream.
+// the goroutine never blocks on a send once the context is done or the cancel channel is closed,
+// and the cursor is always closed when it returns.
+func stream[T any](ctx context.Context, cursor *Cursor[T]) (chan T, chan error, chan struct{}) {
+	var values = make(chan T)
 	var errors = make(chan error)
 	var cancel = make(chan struct{})
 
 	go func() {
 		defer close(values)
 		defer close(errors)
+		defer cursor.close(ctx)
 
-	mainLoop:
-		for {
-			select {
-			case <-cancel:
-				break mainLoop
-			default:
-				if !cursor.Next(ctx) {
-					break mainLoop
-				}
-
-				var value M
-
-				err := cursor.Decode(&value)
-				if err != nil {
-					errors <- fmt.Errorf("%w: failed to decode result: %w", ErrFindStream, err)
+		for cursor.Next(ctx) {
+			value, err := cursor.Decode()
+			if err != nil {
+				select {
+				case errors <- err:
 					continue
+				case <-cancel:
+					return
+				case <-ctx.Done():
+					return
 				}
-				values <- value
+			}
+
+			select {
+			case values <- value:
+			case <-cancel:
+				return
+			case <-ctx.Done():
+				return
 			}
 		}
 
 		if err := cursor.Err(); err != nil {
-			errors <- fmt.Errorf("%w: cursor ended with errors: %w", ErrFindStream, err)
+			select {
+			case errors <- err:
+			case <-cancel:
+			case <-ctx.Done():
+			}
 		}
 	}()
 
-	return values, errors, cancel, nil
+	return values, errors, cancel
 }
 
 // InsertOne inserts a single document into the collection.
+// Fields tagged `repo:"createdAt"` and `repo:"updatedAt"`, which may be time.Time, *time.Time or primitive.DateTime,
+// are set to the current time, keeping a createdAt that is already set.
 func (r *Repository[M, I]) InsertOne(
 	ctx context.Context,
 	document M,
 	opts ...*options.InsertOneOptions,
+) (I, error) {
+	ctx, span := r.startSpan(ctx, "InsertOne", nil)
+	insertedID, err := r.insertOne(ctx, document, opts...)
+	err = r.classify(ctx, "InsertOne", err)
+	span.end(err, insertedKey.Int(single(err)))
+	return insertedID, err
+}
+
+func (r *Repository[M, I]) insertOne(
+	ctx context.Context,
+	document M,
+	opts ...*options.InsertOneOptions,
 ) (I, error) {
 	var insertedID I
 
-	result, err := r.client.Database(r.databaseName).Collection(r.collectionName).InsertOne(
+	err := r.stampInsert(&document)
+	if err != nil {
+		return insertedID, fmt.Errorf("%w: %w", ErrInsertOne, err)
+	}
+
+	err = r.stampScope(ctx, &document)
+	if err != nil {
+		return insertedID, fmt.Errorf("%w: %w", ErrInsertOne, err)
+	}
+
+	err = beforeInsert(ctx, &document)
+	if err != nil {
+		return insertedID, fmt.Errorf("%w: %w", ErrInsertOne, err)
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return insertedID, fmt.Errorf("%w: %w", ErrInsertOne, err)
+	}
+
+	result, err := collection.InsertOne(
 		ctx,
 		document,
 		opts...,
@@ -169,31 +376,84 @@ func (r *Repository[M, I]) InsertOne(
 		return insertedID, fmt.Errorf("%w: failed to convert inserted ID to %T", ErrInsertOne, insertedID)
 	}
 
+	err = afterInsert(ctx, &document)
+	if err != nil {
+		return insertedID, fmt.Errorf("%w: %w", ErrInsertOne, err)
+	}
+
 	return insertedID, nil
 }
 
 // InsertMany inserts multiple documents into the collection.
+// When some of the documents cannot be inserted, InsertMany returns the IDs of the inserted ones by input index,
+// with zero values for the others, and an error wrapping a *BulkError that lists the documents that were not.
+// AfterInsert hooks only run when every document was inserted. Timestamps are set like InsertOne does.
 func (r *Repository[M, I]) InsertMany(
 	ctx context.Context,
 	documents []M,
 	opts ...*options.InsertManyOptions,
+) ([]I, error) {
+	ctx, span := r.startSpan(ctx, "InsertMany", nil)
+	insertedIDs, err := r.insertMany(ctx, documents, opts...)
+	err = r.classify(ctx, "InsertMany", err)
+	span.end(err, insertedKey.Int(insertedCount(len(insertedIDs), err)))
+	return insertedIDs, err
+}
+
+func (r *Repository[M, I]) insertMany(
+	ctx context.Context,
+	documents []M,
+	opts ...*options.InsertManyOptions,
 ) ([]I, error) {
 	var interfaceSlice = make([]any, len(documents))
-	for i, d := range documents {
-		interfaceSlice[i] = d
+	for i := range documents {
+		err := r.stampInsert(&documents[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInsertMany, err)
+		}
+
+		err = r.stampScope(ctx, &documents[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInsertMany, err)
+		}
+
+		err = beforeInsert(ctx, &documents[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: document %d: %w", ErrInsertMany, i, err)
+		}
+		interfaceSlice[i] = documents[i]
 	}
 
-	result, err := r.client.Database(r.databaseName).Collection(r.collectionName).InsertMany(
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInsertMany, err)
+	}
+
+	result, err := collection.InsertMany(
 		ctx,
 		interfaceSlice,
 		opts...,
 	)
-	if err != nil {
+
+	var exception mongo.BulkWriteException
+	if err != nil && (result == nil || !errors.As(err, &exception)) {
 		return nil, fmt.Errorf("%w: %w", ErrInsertMany, err)
 	}
 
+	// when some documents failed, the IDs of the others are reported by input index, with zero values
+	// for the failed ones.
+	var written []bool
+	var bulkErr *BulkError
+	if err != nil {
+		bulkErr = NewBulkError("InsertMany", r.operationNamespace(ctx), len(documents), insertManyOrdered(opts...), exception)
+		written = bulkErr.written(len(documents))
+	}
+
 	var insertedIDs = make([]I, len(result.InsertedIDs))
 	for i, id := range result.InsertedIDs {
+		if written != nil && !written[i] {
+			continue
+		}
 		if oid, ok := id.(I); ok {
 			insertedIDs[i] = oid
 		} else {
@@ -202,19 +462,69 @@ func (r *Repository[M, I]) InsertMany(
 		}
 	}
 
+	if bulkErr != nil {
+		return insertedIDs, fmt.Errorf("%w: %w", ErrInsertMany, bulkErr)
+	}
+
+	for i := range documents {
+		err := afterInsert(ctx, &documents[i])
+		if err != nil {
+			return insertedIDs, fmt.Errorf("%w: document %d: %w", ErrInsertMany, i, err)
+		}
+	}
+
 	return insertedIDs, nil
 }
 
-// UpdateByID updates a single document by its ID.
+// insertManyOrdered reports whether an InsertMany stops at the first failure, which is the default.
+func insertManyOrdered(opts ...*options.InsertManyOptions) bool {
+	var ordered = options.MergeInsertManyOptions(opts...).Ordered
+	return ordered == nil || *ordered
+}
+
+// UpdateByID updates a single document by its ID. Timestamps are set like UpdateOne does.
 func (r *Repository[M, I]) UpdateByID(
 	ctx context.Context,
 	id I,
 	update any,
 	opts ...*options.UpdateOptions,
 ) (*UpdateResult[I], error) {
-	result, err := r.client.Database(r.databaseName).Collection(r.collectionName).UpdateByID(
+	ctx, span := r.startSpan(ctx, "UpdateByID", bson.D{{Key: "_id", Value: id}})
+	result, err := r.updateByID(ctx, id, update, opts...)
+	err = r.classify(ctx, "UpdateByID", err)
+	span.end(err, updateAttributes(result)...)
+	return result, err
+}
+
+func (r *Repository[M, I]) updateByID(
+	ctx context.Context,
+	id I,
+	update any,
+	opts ...*options.UpdateOptions,
+) (*UpdateResult[I], error) {
+	err := beforeUpdate[M](ctx, bson.D{{Key: "_id", Value: id}}, update)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUpdateByID, err)
+	}
+
+	update, err = r.stampUpdate(update, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUpdateByID, err)
+	}
+
+	filter, err := r.scoped(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUpdateByID, err)
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUpdateByID, err)
+	}
+
+	result, err := collection.UpdateOne(
 		ctx,
-		id,
+		filter,
 		update,
 		opts...,
 	)
@@ -241,13 +551,48 @@ func (r *Repository[M, I]) UpdateByID(
 }
 
 // UpdateOne updates a single document by its filter.
+// The updatedAt field is added to the $set of update documents, or in a $set stage to pipelines, and createdAt is set
+// when an upsert inserts a document. Fields the update already modifies are left alone.
 func (r *Repository[M, I]) UpdateOne(
 	ctx context.Context,
 	filter any,
 	update any,
 	opts ...*options.UpdateOptions,
 ) (*UpdateResult[I], error) {
-	result, err := r.client.Database(r.databaseName).Collection(r.collectionName).UpdateOne(
+	ctx, span := r.startSpan(ctx, "UpdateOne", filter)
+	result, err := r.updateOne(ctx, filter, update, opts...)
+	err = r.classify(ctx, "UpdateOne", err)
+	span.end(err, updateAttributes(result)...)
+	return result, err
+}
+
+func (r *Repository[M, I]) updateOne(
+	ctx context.Context,
+	filter any,
+	update any,
+	opts ...*options.UpdateOptions,
+) (*UpdateResult[I], error) {
+	err := beforeUpdate[M](ctx, filter, update)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUpdateOne, err)
+	}
+
+	update, err = r.stampUpdate(update, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUpdateOne, err)
+	}
+
+	filter, err = r.scoped(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUpdateOne, err)
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUpdateOne, err)
+	}
+
+	result, err := collection.UpdateOne(
 		ctx,
 		filter,
 		update,
@@ -276,14 +621,47 @@ func (r *Repository[M, I]) UpdateOne(
 	}, nil
 }
 
-// UpdateMany updates multiple documents by their filter.
+// UpdateMany updates multiple documents by their filter. Timestamps are set like UpdateOne does.
 func (r *Repository[M, I]) UpdateMany(
 	ctx context.Context,
 	filter any,
 	update any,
 	opts ...*options.UpdateOptions,
 ) (*UpdateResult[I], error) {
-	result, err := r.client.Database(r.databaseName).Collection(r.collectionName).UpdateMany(
+	ctx, span := r.startSpan(ctx, "UpdateMany", filter)
+	result, err := r.updateMany(ctx, filter, update, opts...)
+	err = r.classify(ctx, "UpdateMany", err)
+	span.end(err, updateAttributes(result)...)
+	return result, err
+}
+
+func (r *Repository[M, I]) updateMany(
+	ctx context.Context,
+	filter any,
+	update any,
+	opts ...*options.UpdateOptions,
+) (*UpdateResult[I], error) {
+	err := beforeUpdate[M](ctx, filter, update)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUpdateMany, err)
+	}
+
+	update, err = r.stampUpdate(update, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUpdateMany, err)
+	}
+
+	filter, err = r.scoped(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUpdateMany, err)
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUpdateMany, err)
+	}
+
+	result, err := collection.UpdateMany(
 		ctx,
 		filter,
 		update,
@@ -313,12 +691,50 @@ func (r *Repository[M, I]) UpdateMany(
 }
 
 // DeleteOne deletes a single document by its filter.
+// Models with a time field tagged `repo:"deletedAt"`, which must be omitempty, are soft deleted by setting the field
+// instead. FindOne, Find, FindStream, Iterate, FindPage, FindPaged and Count then only match documents where it does
+// not exist, while Aggregate and CountEstimate do not filter them.
 func (r *Repository[M, I]) DeleteOne(
 	ctx context.Context,
 	filter any,
 	opts ...*options.DeleteOptions,
 ) (*mongo.DeleteResult, error) {
-	result, err := r.client.Database(r.databaseName).Collection(r.collectionName).DeleteOne(
+	ctx, span := r.startSpan(ctx, "DeleteOne", filter)
+	result, err := r.deleteOne(ctx, filter, opts...)
+	err = r.classify(ctx, "DeleteOne", err)
+	span.end(err, deleteAttributes(result)...)
+	return result, err
+}
+
+func (r *Repository[M, I]) deleteOne(
+	ctx context.Context,
+	filter any,
+	opts ...*options.DeleteOptions,
+) (*mongo.DeleteResult, error) {
+	filter, err := r.scoped(ctx, r.visible(filter))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDeleteOne, err)
+	}
+
+	filter, err = r.beforeDelete(ctx, filter, false, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDeleteOne, err)
+	}
+
+	if meta.For[M]().SoftDelete() {
+		result, err := r.softDelete(ctx, filter, false, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDeleteOne, err)
+		}
+		return result, nil
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDeleteOne, err)
+	}
+
+	result, err := collection.DeleteOne(
 		ctx,
 		filter,
 		opts...,
@@ -330,13 +746,48 @@ func (r *Repository[M, I]) DeleteOne(
 	return result, nil
 }
 
-// DeleteMany deletes multiple documents by their filter.
+// DeleteMany deletes multiple documents by their filter. Models are soft deleted like DeleteOne does.
 func (r *Repository[M, I]) DeleteMany(
 	ctx context.Context,
 	filter any,
 	opts ...*options.DeleteOptions,
 ) (*mongo.DeleteResult, error) {
-	result, err := r.client.Database(r.databaseName).Collection(r.collectionName).DeleteMany(
+	ctx, span := r.startSpan(ctx, "DeleteMany", filter)
+	result, err := r.deleteMany(ctx, filter, opts...)
+	err = r.classify(ctx, "DeleteMany", err)
+	span.end(err, deleteAttributes(result)...)
+	return result, err
+}
+
+func (r *Repository[M, I]) deleteMany(
+	ctx context.Context,
+	filter any,
+	opts ...*options.DeleteOptions,
+) (*mongo.DeleteResult, error) {
+	filter, err := r.scoped(ctx, r.visible(filter))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDeleteMany, err)
+	}
+
+	filter, err = r.beforeDelete(ctx, filter, true, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDeleteMany, err)
+	}
+
+	if meta.For[M]().SoftDelete() {
+		result, err := r.softDelete(ctx, filter, true, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDeleteMany, err)
+		}
+		return result, nil
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDeleteMany, err)
+	}
+
+	result, err := collection.DeleteMany(
 		ctx,
 		filter,
 		opts...,
@@ -358,16 +809,62 @@ type UpdateResult[I any] struct {
 
 // Count returns the number of documents that match the filter.
 func (r *Repository[M, I]) Count(ctx context.Context, filter any, opts ...*options.CountOptions) (int64, error) {
-	count, err := r.client.Database(r.databaseName).Collection(r.collectionName).CountDocuments(ctx, filter, opts...)
+	ctx, span := r.startSpan(ctx, "Count", filter)
+	count, err := r.count(ctx, filter, opts...)
+	err = r.classify(ctx, "Count", err)
+	span.end(err, countKey.Int64(count))
+	return count, err
+}
+
+func (r *Repository[M, I]) count(ctx context.Context, filter any, opts ...*options.CountOptions) (int64, error) {
+	filter, err := r.scoped(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrCount, err)
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrCount, err)
+	}
+
+	count, err := collection.CountDocuments(ctx, r.visible(filter), opts...)
 	if err != nil {
 		return 0, fmt.Errorf("%w: %w", ErrCount, err)
 	}
 	return count, nil
 }
 
-// CountEstimate returns the estimated number of documents that match the filter.
+// CountEstimate returns the estimated number of documents in the collection, including soft deleted ones.
+// When the repository has a scope, the documents in scope are counted exactly instead, since the estimate
+// covers the whole collection.
 func (r *Repository[M, I]) CountEstimate(ctx context.Context, opts ...*options.EstimatedDocumentCountOptions) (int64, error) {
-	count, err := r.client.Database(r.databaseName).Collection(r.collectionName).EstimatedDocumentCount(ctx, opts...)
+	ctx, span := r.startSpan(ctx, "CountEstimate", nil)
+	count, err := r.countEstimate(ctx, opts...)
+	err = r.classify(ctx, "CountEstimate", err)
+	span.end(err, countKey.Int64(count))
+	return count, err
+}
+
+func (r *Repository[M, I]) countEstimate(ctx context.Context, opts ...*options.EstimatedDocumentCountOptions) (int64, error) {
+	conditions, err := r.scopeFilter(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrCount, err)
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrCount, err)
+	}
+
+	if conditions != nil {
+		count, err := collection.CountDocuments(ctx, conditions)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %w", ErrCount, err)
+		}
+		return count, nil
+	}
+
+	count, err := collection.EstimatedDocumentCount(ctx, opts...)
 	if err != nil {
 		return 0, fmt.Errorf("%w: %w", ErrCount, err)
 	}
@@ -0,0 +1,112 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/AISystemsInc/mongo-resource-repo/pkg/repo/internal/meta"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ValidationLevel sets which writes the server validates against the schema of a collection.
+type ValidationLevel string
+
+const (
+	ValidationStrict   ValidationLevel = "strict"   // All inserts and updates are validated.
+	ValidationModerate ValidationLevel = "moderate" // Updates of documents that are already invalid are not validated.
+	ValidationOff      ValidationLevel = "off"      // Nothing is validated.
+)
+
+// ValidationAction sets what the server does with writes that fail validation.
+type ValidationAction string
+
+const (
+	ValidationError ValidationAction = "error" // Invalid writes are rejected.
+	ValidationWarn  ValidationAction = "warn"  // Invalid writes are applied and logged.
+)
+
+// JSONSchema returns the $jsonSchema describing the documents of the model M, generated from its fields and their
+// bson tags:
+//
+//   - fields are required unless they have the omitempty bson option
+//   - pointers, slices and maps may be null, since nil values are encoded as null
+//   - primitive.ObjectID, time.Time, slices, maps and nested structs map to their bson types
+//
+// Fields can be constrained further with the `schema` struct tag, which takes min, max, enum and pattern options:
+//
+//	type User struct {
+//		Name  string   `bson:"name" schema:"min=1,max=100"`
+//		Age   int      `bson:"age" schema:"min=0"`
+//		Role  string   `bson:"role" schema:"enum=admin|member"`
+//		Email string   `bson:"email" schema:"pattern=^[^@]+@[^@]+$"`
+//		Tags  []string `bson:"tags,omitempty" schema:"max=10"`
+//	}
+//
+// min and max bound numbers, the length of strings and the number of items of arrays. enum values are separated by
+// "|", and also allow null for fields that may be null. pattern must be the last option since the pattern may contain
+// commas.
+func JSONSchema[M any]() (bson.D, error) {
+	schema, err := meta.Schema(reflect.TypeOf((*M)(nil)).Elem())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSchema, err)
+	}
+	return schema, nil
+}
+
+// ApplySchemaValidation installs the $jsonSchema of the model, see JSONSchema, as the validator of its collection,
+// creating the collection when it does not exist.
+func (r *Repository[M, I]) ApplySchemaValidation(
+	ctx context.Context,
+	level ValidationLevel,
+	action ValidationAction,
+) error {
+	ctx, span := r.startSpan(ctx, "ApplySchemaValidation", nil)
+	err := r.applySchemaValidation(ctx, level, action)
+	err = r.classify(ctx, "ApplySchemaValidation", err)
+	span.end(err)
+	return err
+}
+
+func (r *Repository[M, I]) applySchemaValidation(
+	ctx context.Context,
+	level ValidationLevel,
+	action ValidationAction,
+) error {
+	schema, err := JSONSchema[M]()
+	if err != nil {
+		return err
+	}
+
+	namespace, err := r.namespace(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSchema, err)
+	}
+
+	var validator = bson.D{{Key: "$jsonSchema", Value: schema}}
+	var database = r.client.Database(namespace.Database)
+
+	err = database.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: namespace.Collection},
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: string(level)},
+		{Key: "validationAction", Value: string(action)},
+	}).Err()
+
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && commandErr.Name == "NamespaceNotFound" {
+		err = database.CreateCollection(ctx, namespace.Collection, options.CreateCollection().
+			SetValidator(validator).
+			SetValidationLevel(string(level)).
+			SetValidationAction(string(action)),
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSchema, err)
+	}
+
+	return nil
+}
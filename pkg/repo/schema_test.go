@@ -0,0 +1,80 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SchemaModel struct {
+	ID   primitive.ObjectID `bson:"_id"`
+	Name string             `bson:"name" schema:"min=1"`
+	Age  int                `bson:"age" schema:"min=0"`
+}
+
+func (s *SchemaModel) GetDatabaseName() string {
+	return "schema_model_db"
+}
+
+func (s *SchemaModel) GetCollectionName() string {
+	return "schema_model_col"
+}
+
+func TestRepository_ApplySchemaValidation(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var repository = NewRepository[*SchemaModel, primitive.ObjectID](mongoClient)
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		err := mongoClient.Database("schema_model_db").Collection("schema_model_col").Drop(context.Background())
+		if err != nil {
+			t.Errorf("error dropping collection: %v", err)
+		}
+	}()
+
+	// the first call creates the collection, the second one modifies it
+	for _, level := range []ValidationLevel{ValidationModerate, ValidationStrict} {
+		err = repository.ApplySchemaValidation(ctx, level, ValidationError)
+		if err != nil {
+			t.Errorf("ApplySchemaValidation(%s) error = %v", level, err)
+			return
+		}
+	}
+
+	_, err = repository.InsertOne(ctx, &SchemaModel{ID: primitive.NewObjectID(), Name: "apple", Age: 3})
+	if err != nil {
+		t.Errorf("InsertOne() valid document error = %v", err)
+	}
+
+	_, err = repository.InsertOne(ctx, &SchemaModel{ID: primitive.NewObjectID(), Name: "", Age: 3})
+	if err == nil {
+		t.Errorf("InsertOne() empty name error = nil, want validation error")
+	}
+
+	_, err = mongoClient.Database("schema_model_db").Collection("schema_model_col").InsertOne(ctx, bson.M{
+		"_id":  primitive.NewObjectID(),
+		"name": "banana",
+	})
+	if err == nil {
+		t.Errorf("InsertOne() missing age error = nil, want validation error")
+	}
+}
@@ -0,0 +1,133 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/AISystemsInc/mongo-resource-repo/pkg/repo/internal/meta"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Scope derives the conditions restricting the documents an operation may read or write from its context,
+// e.g. to restrict users to the documents they own. The conditions are ANDed into the filter of every read, update
+// and delete, prepended as a $match stage to aggregation pipelines (after a leading $geoNear or $search stage), and
+// the fields they set to a single value are stamped on inserted documents. A scope returns an error to deny the operation, e.g. when the context carries no
+// user, and nil conditions to leave it unrestricted.
+//
+// Watch and EnsureIndexes are not scoped. Use Unscoped to bypass the scope, e.g. in admin jobs.
+//
+// example:
+//
+//	usersRepo := repo.NewRepository[*Note, primitive.ObjectID](client, repo.WithScope(func(ctx context.Context) (bson.D, error) {
+//		user, ok := auth.UserFromContext(ctx)
+//		if !ok {
+//			return nil, errors.New("no user in context")
+//		}
+//		return bson.D{{Key: "ownerId", Value: user.ID}}, nil
+//	}))
+type Scope func(ctx context.Context) (bson.D, error)
+
+type unscopedKey struct{}
+
+// Unscoped returns a context whose operations are not restricted by the scope of the repository.
+func Unscoped(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unscopedKey{}, true)
+}
+
+// scopeFilter returns the conditions of the scope for the context, or nil when the operation is not scoped.
+func (r *Repository[M, I]) scopeFilter(ctx context.Context) (bson.D, error) {
+	if r.settings.scope == nil {
+		return nil, nil
+	}
+
+	if unscoped, _ := ctx.Value(unscopedKey{}).(bool); unscoped {
+		return nil, nil
+	}
+
+	conditions, err := r.settings.scope(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrScope, err)
+	}
+
+	return conditions, nil
+}
+
+// scoped restricts the filter to the documents in the scope of the context.
+func (r *Repository[M, I]) scoped(ctx context.Context, filter any) (any, error) {
+	conditions, err := r.scopeFilter(ctx)
+	if err != nil || conditions == nil {
+		return filter, err
+	}
+	return andFilters(filter, conditions), nil
+}
+
+// scopedPipeline prepends a $match stage restricting the pipeline to the documents in the scope of the context.
+// The $match goes after a leading stage that must be the first of the pipeline, e.g. $geoNear or $search.
+func (r *Repository[M, I]) scopedPipeline(ctx context.Context, pipeline any) (any, error) {
+	conditions, err := r.scopeFilter(ctx)
+	if err != nil || conditions == nil {
+		return pipeline, err
+	}
+
+	var match = bson.D{{Key: "$match", Value: conditions}}
+	switch p := pipeline.(type) {
+	case mongo.Pipeline:
+		return slices.Insert(slices.Clone(p), matchPosition(p), match), nil
+	case []bson.D:
+		return slices.Insert(slices.Clone(p), matchPosition(p), match), nil
+	case bson.A:
+		return slices.Insert(slices.Clone(p), matchPosition(p), any(match)), nil
+	case []any:
+		return slices.Insert(slices.Clone(p), matchPosition(p), any(match)), nil
+	}
+
+	return nil, fmt.Errorf("%w: cannot scope a pipeline of type %T", ErrScope, pipeline)
+}
+
+// firstStages are the stages that must be the first of a pipeline.
+var firstStages = map[string]bool{
+	"$geoNear":           true,
+	"$search":            true,
+	"$searchMeta":        true,
+	"$vectorSearch":      true,
+	"$collStats":         true,
+	"$indexStats":        true,
+	"$listSearchIndexes": true,
+	"$listSessions":      true,
+	"$planCacheStats":    true,
+}
+
+// matchPosition returns where the $match stage of the scope goes in the pipeline: after a leading stage that must
+// be the first, otherwise at the start.
+func matchPosition[S any](pipeline []S) int {
+	if len(pipeline) == 0 {
+		return 0
+	}
+
+	raw, err := bson.Marshal(pipeline[0])
+	if err != nil {
+		return 0
+	}
+	elements, err := bson.Raw(raw).Elements()
+	if err != nil || len(elements) != 1 || !firstStages[elements[0].Key()] {
+		return 0
+	}
+	return 1
+}
+
+// stampScope sets the fields the scope of the context restricts to a single value on the document.
+func (r *Repository[M, I]) stampScope(ctx context.Context, document *M) error {
+	conditions, err := r.scopeFilter(ctx)
+	if err != nil || conditions == nil {
+		return err
+	}
+
+	err = meta.SetFields(document, conditions)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrScope, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ScopedModel struct {
+	ID      primitive.ObjectID `bson:"_id"`
+	Name    string             `bson:"name"`
+	OwnerID string             `bson:"ownerId"`
+}
+
+func (m *ScopedModel) GetDatabaseName() string {
+	return "scoped_model_db"
+}
+
+func (m *ScopedModel) GetCollectionName() string {
+	return "scoped_model_col"
+}
+
+type userKey struct{}
+
+func ownerScope(ctx context.Context) (bson.D, error) {
+	user, ok := ctx.Value(userKey{}).(string)
+	if !ok {
+		return nil, errors.New("no user in context")
+	}
+	return bson.D{{Key: "ownerId", Value: user}}, nil
+}
+
+func TestRepository_scoped(t *testing.T) {
+	var repository = NewRepository[*ScopedModel, primitive.ObjectID](nil, WithScope(ownerScope))
+	var alice = context.WithValue(context.Background(), userKey{}, "alice")
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		want    any
+		wantErr error
+	}{
+		{
+			name: "scoped",
+			ctx:  alice,
+			want: bson.D{{Key: "$and", Value: bson.A{bson.M{"name": "apple"}, bson.D{{Key: "ownerId", Value: "alice"}}}}},
+		},
+		{
+			name: "unscoped",
+			ctx:  Unscoped(context.Background()),
+			want: bson.M{"name": "apple"},
+		},
+		{
+			name:    "denied",
+			ctx:     context.Background(),
+			wantErr: ErrScope,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repository.scoped(tt.ctx, bson.M{"name": "apple"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("scoped() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scoped() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	pipeline, err := repository.scopedPipeline(alice, mongo.Pipeline{{{Key: "$count", Value: "n"}}})
+	if err != nil {
+		t.Fatalf("scopedPipeline() error = %v", err)
+	}
+	want := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "ownerId", Value: "alice"}}}},
+		{{Key: "$count", Value: "n"}},
+	}
+	if !reflect.DeepEqual(pipeline, want) {
+		t.Errorf("scopedPipeline() = %v, want %v", pipeline, want)
+	}
+
+	pipeline, err = repository.scopedPipeline(alice, bson.A{
+		bson.M{"$geoNear": bson.M{"near": bson.A{0, 0}, "distanceField": "distance"}},
+		bson.M{"$limit": 10},
+	})
+	if err != nil {
+		t.Fatalf("scopedPipeline() error = %v", err)
+	}
+	wantA := bson.A{
+		bson.M{"$geoNear": bson.M{"near": bson.A{0, 0}, "distanceField": "distance"}},
+		bson.D{{Key: "$match", Value: bson.D{{Key: "ownerId", Value: "alice"}}}},
+		bson.M{"$limit": 10},
+	}
+	if !reflect.DeepEqual(pipeline, wantA) {
+		t.Errorf("scopedPipeline() = %v, want %v", pipeline, wantA)
+	}
+
+	var document = &ScopedModel{OwnerID: "mallory"}
+	err = repository.stampScope(alice, &document)
+	if err != nil || document.OwnerID != "alice" {
+		t.Errorf("stampScope() = %q, %v, want alice", document.OwnerID, err)
+	}
+}
+
+func TestRepository_Scope(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var repository = NewRepository[*ScopedModel, primitive.ObjectID](mongoClient, WithScope(ownerScope))
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		err := mongoClient.Database("scoped_model_db").Collection("scoped_model_col").Drop(context.Background())
+		if err != nil {
+			t.Errorf("error dropping collection: %v", err)
+		}
+	}()
+
+	var alice = context.WithValue(ctx, userKey{}, "alice")
+	var bob = context.WithValue(ctx, userKey{}, "bob")
+
+	id, err := repository.InsertOne(alice, &ScopedModel{ID: primitive.NewObjectID(), Name: "apple"})
+	if err != nil {
+		t.Errorf("InsertOne() error = %v", err)
+		return
+	}
+
+	_, err = repository.InsertOne(bob, &ScopedModel{ID: primitive.NewObjectID(), Name: "banana", OwnerID: "alice"})
+	if err != nil {
+		t.Errorf("InsertOne() error = %v", err)
+		return
+	}
+
+	_, err = repository.Find(ctx, bson.M{})
+	if !errors.Is(err, ErrScope) {
+		t.Errorf("Find() without user error = %v, want ErrScope", err)
+	}
+
+	found, err := repository.Find(alice, bson.M{})
+	if err != nil || len(found) != 1 || found[0].Name != "apple" {
+		t.Errorf("Find(alice) = %v, %v, want apple only", found, err)
+	}
+
+	result, err := repository.UpdateByID(bob, id, bson.M{"$set": bson.M{"name": "stolen"}})
+	if err != nil || result.MatchedCount != 0 {
+		t.Errorf("UpdateByID(bob) = %+v, %v, want no match", result, err)
+	}
+
+	deleted, err := repository.DeleteMany(bob, bson.M{})
+	if err != nil || deleted.DeletedCount != 1 {
+		t.Errorf("DeleteMany(bob) = %+v, %v, want 1 deleted", deleted, err)
+	}
+
+	count, err := repository.Count(Unscoped(ctx), bson.M{})
+	if err != nil || count != 1 {
+		t.Errorf("Count(Unscoped) = %v, %v, want 1", count, err)
+	}
+}
@@ -0,0 +1,194 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AISystemsInc/mongo-resource-repo/pkg/repo/internal/meta"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// visible restricts the filter to the documents that are not soft deleted.
+func (r *Repository[M, I]) visible(filter any) any {
+	return andFilters(filter, meta.For[M]().NotDeleted())
+}
+
+// softDelete sets the deletedAt field of the documents matching the filter.
+func (r *Repository[M, I]) softDelete(
+	ctx context.Context,
+	filter any,
+	many bool,
+	opts ...*options.DeleteOptions,
+) (*mongo.DeleteResult, error) {
+	var m = meta.For[M]()
+	var now = r.settings.now()
+
+	update, err := m.StampUpdate(m.DeleteUpdate(now), now, false)
+	if err != nil {
+		return nil, err
+	}
+
+	o := options.MergeDeleteOptions(opts...)
+	var updateOptions = options.Update()
+	if o.Collation != nil {
+		updateOptions.SetCollation(o.Collation)
+	}
+	if o.Hint != nil {
+		updateOptions.SetHint(o.Hint)
+	}
+	if o.Let != nil {
+		updateOptions.SetLet(o.Let)
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *mongo.UpdateResult
+	if many {
+		result, err = collection.UpdateMany(ctx, filter, update, updateOptions)
+	} else {
+		result, err = collection.UpdateOne(ctx, filter, update, updateOptions)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &mongo.DeleteResult{DeletedCount: result.ModifiedCount}, nil
+}
+
+// FindWithDeleted works like Find, but also returns soft deleted documents.
+func (r *Repository[M, I]) FindWithDeleted(
+	ctx context.Context,
+	filter any,
+	opts ...*options.FindOptions,
+) ([]M, error) {
+	ctx, span := r.startSpan(ctx, "FindWithDeleted", filter)
+	values, err := r.find(ctx, ErrFindWithDeleted, filter, opts...)
+	err = r.classify(ctx, "FindWithDeleted", err)
+	span.end(err, returnedKey.Int(len(values)))
+	return values, err
+}
+
+// Restore restores the soft deleted documents that match the filter, and returns how many were restored.
+func (r *Repository[M, I]) Restore(
+	ctx context.Context,
+	filter any,
+	opts ...*options.UpdateOptions,
+) (int64, error) {
+	ctx, span := r.startSpan(ctx, "Restore", filter)
+	restored, err := r.restore(ctx, filter, opts...)
+	err = r.classify(ctx, "Restore", err)
+	span.end(err, modifiedKey.Int64(restored))
+	return restored, err
+}
+
+func (r *Repository[M, I]) restore(
+	ctx context.Context,
+	filter any,
+	opts ...*options.UpdateOptions,
+) (int64, error) {
+	var m = meta.For[M]()
+	if !m.SoftDelete() {
+		return 0, fmt.Errorf("%w: %w", ErrRestore, ErrNoSoftDelete)
+	}
+
+	update, err := m.StampUpdate(m.RestoreUpdate(), r.settings.now(), false)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrRestore, err)
+	}
+
+	filter, err = r.scoped(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrRestore, err)
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrRestore, err)
+	}
+
+	result, err := collection.UpdateMany(
+		ctx,
+		andFilters(filter, bson.D{{Key: m.DeletedAt.Name, Value: bson.D{{Key: "$exists", Value: true}}}}),
+		update,
+		opts...,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrRestore, err)
+	}
+
+	return result.ModifiedCount, nil
+}
+
+// PurgeDeleted permanently deletes the documents that were soft deleted more than olderThan ago,
+// and returns how many were deleted. BeforeDelete hooks are not called, since they ran when the documents
+// were soft deleted.
+func (r *Repository[M, I]) PurgeDeleted(
+	ctx context.Context,
+	olderThan time.Duration,
+	opts ...*options.DeleteOptions,
+) (int64, error) {
+	return r.purgeNarrowed(ctx, olderThan, nil, opts...)
+}
+
+// purgeNarrowed runs a PurgeDeleted deleting the documents of the filter returned by narrow, if not nil, which
+// decorators use to record the documents matching the filter of the cutoff and delete only those.
+func (r *Repository[M, I]) purgeNarrowed(
+	ctx context.Context,
+	olderThan time.Duration,
+	narrow func(ctx context.Context, filter any) (any, error),
+	opts ...*options.DeleteOptions,
+) (int64, error) {
+	ctx, span := r.startSpan(ctx, "PurgeDeleted", nil)
+	purged, err := r.purgeDeleted(ctx, olderThan, narrow, opts...)
+	err = r.classify(ctx, "PurgeDeleted", err)
+	span.end(err, deletedKey.Int64(purged))
+	return purged, err
+}
+
+func (r *Repository[M, I]) purgeDeleted(
+	ctx context.Context,
+	olderThan time.Duration,
+	narrow func(ctx context.Context, filter any) (any, error),
+	opts ...*options.DeleteOptions,
+) (int64, error) {
+	var m = meta.For[M]()
+	if !m.SoftDelete() {
+		return 0, fmt.Errorf("%w: %w", ErrPurgeDeleted, ErrNoSoftDelete)
+	}
+
+	var filter any = m.Deleted(r.settings.now().Add(-olderThan))
+	if narrow != nil {
+		var err error
+		filter, err = narrow(ctx, filter)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	filter, err := r.scoped(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrPurgeDeleted, err)
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrPurgeDeleted, err)
+	}
+
+	result, err := collection.DeleteMany(
+		ctx,
+		filter,
+		opts...,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrPurgeDeleted, err)
+	}
+
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,102 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SoftDeleteModel struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Name      string             `bson:"name"`
+	DeletedAt *time.Time         `bson:"deletedAt,omitempty" repo:"deletedAt"`
+}
+
+func (s *SoftDeleteModel) GetDatabaseName() string {
+	return "soft_delete_model_db"
+}
+
+func (s *SoftDeleteModel) GetCollectionName() string {
+	return "soft_delete_model_col"
+}
+
+func TestRepository_SoftDelete(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var now = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var repository = NewRepository[*SoftDeleteModel, primitive.ObjectID](mongoClient, WithClock(func() time.Time {
+		return now
+	}))
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		err := mongoClient.Database("soft_delete_model_db").Collection("soft_delete_model_col").Drop(context.Background())
+		if err != nil {
+			t.Errorf("error dropping collection: %v", err)
+		}
+	}()
+
+	_, err = repository.InsertMany(ctx, []*SoftDeleteModel{
+		{ID: primitive.NewObjectID(), Name: "apple"},
+		{ID: primitive.NewObjectID(), Name: "banana"},
+	})
+	if err != nil {
+		t.Errorf("error inserting models: %v", err)
+		return
+	}
+
+	result, err := repository.DeleteOne(ctx, bson.M{"name": "apple"})
+	if err != nil {
+		t.Errorf("DeleteOne() error = %v", err)
+		return
+	}
+	if result.DeletedCount != 1 {
+		t.Errorf("DeleteOne() deleted = %d, want 1", result.DeletedCount)
+	}
+
+	count, err := repository.Count(ctx, bson.M{})
+	if err != nil || count != 1 {
+		t.Errorf("Count() = %d, %v, want 1", count, err)
+	}
+
+	all, err := repository.FindWithDeleted(ctx, bson.M{})
+	if err != nil || len(all) != 2 {
+		t.Errorf("FindWithDeleted() = %d documents, %v, want 2", len(all), err)
+	}
+
+	restored, err := repository.Restore(ctx, bson.M{"name": "apple"})
+	if err != nil || restored != 1 {
+		t.Errorf("Restore() = %d, %v, want 1", restored, err)
+	}
+
+	_, err = repository.DeleteMany(ctx, bson.M{})
+	if err != nil {
+		t.Errorf("DeleteMany() error = %v", err)
+		return
+	}
+
+	now = now.Add(48 * time.Hour)
+
+	purged, err := repository.PurgeDeleted(ctx, 24*time.Hour)
+	if err != nil || purged != 2 {
+		t.Errorf("PurgeDeleted() = %d, %v, want 2", purged, err)
+	}
+}
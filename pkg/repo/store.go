@@ -0,0 +1,34 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Store is the set of operations offered by a Repository.
+// Code that depends on Store instead of *Repository can be tested against an in-memory implementation
+// such as the one in the memrepo package, without a running MongoDB.
+type Store[M Model, I any] interface {
+	FindOne(ctx context.Context, filter any, opts ...*options.FindOneOptions) (M, error)
+	Find(ctx context.Context, filter any, opts ...*options.FindOptions) ([]M, error)
+	FindStream(ctx context.Context, filter any, opts ...*options.FindOptions) (chan M, chan error, chan struct{}, error)
+	Iterate(ctx context.Context, filter any, opts ...*options.FindOptions) (*Cursor[M], error)
+	InsertOne(ctx context.Context, document M, opts ...*options.InsertOneOptions) (I, error)
+	InsertMany(ctx context.Context, documents []M, opts ...*options.InsertManyOptions) ([]I, error)
+	UpdateByID(ctx context.Context, id I, update any, opts ...*options.UpdateOptions) (*UpdateResult[I], error)
+	UpdateOne(ctx context.Context, filter any, update any, opts ...*options.UpdateOptions) (*UpdateResult[I], error)
+	UpdateMany(ctx context.Context, filter any, update any, opts ...*options.UpdateOptions) (*UpdateResult[I], error)
+	DeleteOne(ctx context.Context, filter any, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+	DeleteMany(ctx context.Context, filter any, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+	Count(ctx context.Context, filter any, opts ...*options.CountOptions) (int64, error)
+	CountEstimate(ctx context.Context, opts ...*options.EstimatedDocumentCountOptions) (int64, error)
+	FindWithDeleted(ctx context.Context, filter any, opts ...*options.FindOptions) ([]M, error)
+	Restore(ctx context.Context, filter any, opts ...*options.UpdateOptions) (int64, error)
+	PurgeDeleted(ctx context.Context, olderThan time.Duration, opts ...*options.DeleteOptions) (int64, error)
+	SaveVersioned(ctx context.Context, document M, opts ...*options.UpdateOptions) error
+}
+
+var _ Store[Model, any] = (*Repository[Model, any])(nil)
@@ -0,0 +1,123 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Namespace is the database and collection documents are stored in.
+type Namespace struct {
+	Database   string
+	Collection string
+}
+
+// String returns the namespace as "<database>.<collection>".
+func (n Namespace) String() string {
+	return n.Database + "." + n.Collection
+}
+
+// TenantResolver maps a tenant to the namespace of its documents, given the namespace declared by the model.
+//
+// example, storing each tenant in its own database:
+//
+//	usersRepo := repo.NewRepository[*User, primitive.ObjectID](client, repo.WithTenants(repo.TenantDatabasePrefix("_")))
+//	users, err := usersRepo.Find(repo.ContextWithTenant(ctx, "acme"), bson.M{}) // reads acme_users_db.users_col
+type TenantResolver func(tenant string, namespace Namespace) (Namespace, error)
+
+// TenantDatabasePrefix stores each tenant in its own database, named "<tenant><separator><database>".
+func TenantDatabasePrefix(separator string) TenantResolver {
+	return func(tenant string, namespace Namespace) (Namespace, error) {
+		if err := validTenant(tenant, `/\. "$*<>:|?`); err != nil {
+			return namespace, err
+		}
+		namespace.Database = tenant + separator + namespace.Database
+		return namespace, nil
+	}
+}
+
+// TenantDatabaseSuffix stores each tenant in its own database, named "<database><separator><tenant>".
+func TenantDatabaseSuffix(separator string) TenantResolver {
+	return func(tenant string, namespace Namespace) (Namespace, error) {
+		if err := validTenant(tenant, `/\. "$*<>:|?`); err != nil {
+			return namespace, err
+		}
+		namespace.Database = namespace.Database + separator + tenant
+		return namespace, nil
+	}
+}
+
+// TenantCollectionPrefix stores each tenant in its own collection, named "<tenant><separator><collection>".
+func TenantCollectionPrefix(separator string) TenantResolver {
+	return func(tenant string, namespace Namespace) (Namespace, error) {
+		if err := validTenant(tenant, "$"); err != nil {
+			return namespace, err
+		}
+		namespace.Collection = tenant + separator + namespace.Collection
+		return namespace, nil
+	}
+}
+
+// TenantCollectionSuffix stores each tenant in its own collection, named "<collection><separator><tenant>".
+func TenantCollectionSuffix(separator string) TenantResolver {
+	return func(tenant string, namespace Namespace) (Namespace, error) {
+		if err := validTenant(tenant, "$"); err != nil {
+			return namespace, err
+		}
+		namespace.Collection = namespace.Collection + separator + tenant
+		return namespace, nil
+	}
+}
+
+// validTenant rejects tenants that would make an invalid name, or a name of another namespace.
+func validTenant(tenant string, invalid string) error {
+	if strings.ContainsAny(tenant, invalid+"\x00") {
+		return fmt.Errorf("%w: %q", ErrInvalidTenant, tenant)
+	}
+	return nil
+}
+
+type tenantKey struct{}
+
+// ContextWithTenant returns a context carrying the tenant of the operations made with it.
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant set by ContextWithTenant.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok
+}
+
+// namespace returns the namespace of the documents: the one declared by the model, or the one of the tenant of the
+// context when tenant routing is enabled.
+func (r *Repository[M, I]) namespace(ctx context.Context) (Namespace, error) {
+	var namespace = Namespace{Database: r.databaseName, Collection: r.collectionName}
+	if r.settings.tenants == nil {
+		return namespace, nil
+	}
+
+	var tenantFromContext = r.settings.tenant
+	if tenantFromContext == nil {
+		tenantFromContext = TenantFromContext
+	}
+
+	tenant, ok := tenantFromContext(ctx)
+	if !ok || tenant == "" {
+		return namespace, ErrNoTenant
+	}
+
+	return r.settings.tenants(tenant, namespace)
+}
+
+// collection returns the collection of the documents, see namespace.
+func (r *Repository[M, I]) collection(ctx context.Context) (*mongo.Collection, error) {
+	namespace, err := r.namespace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.client.Database(namespace.Database).Collection(namespace.Collection), nil
+}
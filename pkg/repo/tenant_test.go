@@ -0,0 +1,184 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type TenantModel struct {
+	ID   primitive.ObjectID `bson:"_id"`
+	Name string             `bson:"name"`
+}
+
+func (m *TenantModel) GetDatabaseName() string {
+	return "tenant_model_db"
+}
+
+func (m *TenantModel) GetCollectionName() string {
+	return "tenant_model_col"
+}
+
+type tenantHeader struct{}
+
+func TestRepository_namespace(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		ctx     context.Context
+		want    Namespace
+		wantErr error
+	}{
+		{
+			name: "no tenant routing",
+			ctx:  context.Background(),
+			want: Namespace{Database: "tenant_model_db", Collection: "tenant_model_col"},
+		},
+		{
+			name: "database prefix",
+			opts: []Option{WithTenants(TenantDatabasePrefix("_"))},
+			ctx:  ContextWithTenant(context.Background(), "acme"),
+			want: Namespace{Database: "acme_tenant_model_db", Collection: "tenant_model_col"},
+		},
+		{
+			name: "database suffix",
+			opts: []Option{WithTenants(TenantDatabaseSuffix("-"))},
+			ctx:  ContextWithTenant(context.Background(), "acme"),
+			want: Namespace{Database: "tenant_model_db-acme", Collection: "tenant_model_col"},
+		},
+		{
+			name: "collection prefix",
+			opts: []Option{WithTenants(TenantCollectionPrefix("."))},
+			ctx:  ContextWithTenant(context.Background(), "acme"),
+			want: Namespace{Database: "tenant_model_db", Collection: "acme.tenant_model_col"},
+		},
+		{
+			name: "collection suffix",
+			opts: []Option{WithTenants(TenantCollectionSuffix("_"))},
+			ctx:  ContextWithTenant(context.Background(), "acme"),
+			want: Namespace{Database: "tenant_model_db", Collection: "tenant_model_col_acme"},
+		},
+		{
+			name: "custom resolver",
+			opts: []Option{WithTenants(func(tenant string, namespace Namespace) (Namespace, error) {
+				return Namespace{Database: "db_" + tenant, Collection: namespace.Collection}, nil
+			})},
+			ctx:  ContextWithTenant(context.Background(), "acme"),
+			want: Namespace{Database: "db_acme", Collection: "tenant_model_col"},
+		},
+		{
+			name: "custom tenant from context",
+			opts: []Option{
+				WithTenants(TenantDatabasePrefix("_")),
+				WithTenantFromContext(func(ctx context.Context) (string, bool) {
+					tenant, ok := ctx.Value(tenantHeader{}).(string)
+					return tenant, ok
+				}),
+			},
+			ctx:  context.WithValue(context.Background(), tenantHeader{}, "globex"),
+			want: Namespace{Database: "globex_tenant_model_db", Collection: "tenant_model_col"},
+		},
+		{
+			name:    "missing tenant",
+			opts:    []Option{WithTenants(TenantDatabasePrefix("_"))},
+			ctx:     context.Background(),
+			wantErr: ErrNoTenant,
+		},
+		{
+			name:    "empty tenant",
+			opts:    []Option{WithTenants(TenantDatabasePrefix("_"))},
+			ctx:     ContextWithTenant(context.Background(), ""),
+			wantErr: ErrNoTenant,
+		},
+		{
+			name:    "invalid database tenant",
+			opts:    []Option{WithTenants(TenantDatabasePrefix("_"))},
+			ctx:     ContextWithTenant(context.Background(), "acme.other"),
+			wantErr: ErrInvalidTenant,
+		},
+		{
+			name:    "invalid collection tenant",
+			opts:    []Option{WithTenants(TenantCollectionSuffix("_"))},
+			ctx:     ContextWithTenant(context.Background(), "$acme"),
+			wantErr: ErrInvalidTenant,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var repository = NewRepository[*TenantModel, primitive.ObjectID](nil, tt.opts...)
+
+			got, err := repository.namespace(tt.ctx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("namespace() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr == nil && got != tt.want {
+				t.Errorf("namespace() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepository_Tenants(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var repository = NewRepository[*TenantModel, primitive.ObjectID](mongoClient, WithTenants(TenantDatabasePrefix("_")))
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		for _, database := range []string{"acme_tenant_model_db", "globex_tenant_model_db"} {
+			err := mongoClient.Database(database).Drop(context.Background())
+			if err != nil {
+				t.Errorf("error dropping database: %v", err)
+			}
+		}
+	}()
+
+	var acme = ContextWithTenant(ctx, "acme")
+	var globex = ContextWithTenant(ctx, "globex")
+
+	_, err = repository.InsertOne(acme, &TenantModel{ID: primitive.NewObjectID(), Name: "apple"})
+	if err != nil {
+		t.Errorf("InsertOne() error = %v", err)
+		return
+	}
+
+	_, err = repository.InsertOne(ctx, &TenantModel{ID: primitive.NewObjectID(), Name: "banana"})
+	if !errors.Is(err, ErrNoTenant) || !errors.Is(err, ErrInsertOne) {
+		t.Errorf("InsertOne() without tenant error = %v, want ErrNoTenant", err)
+	}
+
+	count, err := repository.Count(acme, bson.M{})
+	if err != nil || count != 1 {
+		t.Errorf("Count(acme) = %v, %v, want 1", count, err)
+	}
+
+	count, err = repository.Count(globex, bson.M{})
+	if err != nil || count != 0 {
+		t.Errorf("Count(globex) = %v, %v, want 0", count, err)
+	}
+
+	count, err = mongoClient.Database("acme_tenant_model_db").Collection("tenant_model_col").CountDocuments(ctx, bson.M{})
+	if err != nil || count != 1 {
+		t.Errorf("acme_tenant_model_db.tenant_model_col has %v documents, %v, want 1", count, err)
+	}
+}
@@ -0,0 +1,28 @@
+package repo
+
+import (
+	"github.com/AISystemsInc/mongo-resource-repo/pkg/repo/internal/meta"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// stampInsert sets the timestamps of a document about to be inserted.
+func (r *Repository[M, I]) stampInsert(document *M) error {
+	var m = meta.For[M]()
+	if m.Err != nil {
+		return m.Err
+	}
+
+	m.StampInsert(document, r.settings.now())
+	return nil
+}
+
+// stampUpdate adds the timestamps to an update.
+func (r *Repository[M, I]) stampUpdate(update any, opts ...*options.UpdateOptions) (any, error) {
+	var m = meta.For[M]()
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	o := options.MergeUpdateOptions(opts...)
+	return m.StampUpdate(update, r.settings.now(), o.Upsert != nil && *o.Upsert)
+}
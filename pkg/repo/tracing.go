@@ -0,0 +1,230 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the name of the instrumentation library, as reported in spans.
+const tracerName = "github.com/AISystemsInc/mongo-resource-repo/pkg/repo"
+
+// the attributes of repository spans, besides the database semantic conventions.
+const (
+	filterKey   = attribute.Key("db.mongodb.filter")
+	returnedKey = attribute.Key("repo.returned")
+	insertedKey = attribute.Key("repo.inserted")
+	matchedKey  = attribute.Key("repo.matched")
+	modifiedKey = attribute.Key("repo.modified")
+	upsertedKey = attribute.Key("repo.upserted")
+	deletedKey  = attribute.Key("repo.deleted")
+	countKey    = attribute.Key("repo.count")
+	errorKey    = attribute.Key("error.type")
+)
+
+// operationSpan is the span of a repository operation, or nil when tracing is disabled.
+type operationSpan struct {
+	span trace.Span
+}
+
+// startSpan starts the span of an operation, named like "repo.FindOne users_db.users_col", when a TracerProvider
+// is configured. The filter is recorded with its values stripped, so that spans do not leak document data.
+func (r *Repository[M, I]) startSpan(ctx context.Context, operation string, filter any) (context.Context, *operationSpan) {
+	if r.settings.tracerProvider == nil {
+		return ctx, nil
+	}
+
+	var namespace = r.operationNamespace(ctx)
+
+	var attributes = []attribute.KeyValue{
+		attribute.String("db.system", "mongodb"),
+		attribute.String("db.name", namespace.Database),
+		attribute.String("db.collection", namespace.Collection),
+		attribute.String("db.operation", operation),
+	}
+	if filter != nil {
+		attributes = append(attributes, filterKey.String(filterShape(filter)))
+	}
+
+	ctx, span := r.settings.tracerProvider.Tracer(tracerName).Start(
+		ctx,
+		"repo."+operation+" "+namespace.String(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes...),
+	)
+
+	return ctx, &operationSpan{span: span}
+}
+
+// end records the outcome of the operation and ends the span.
+func (s *operationSpan) end(err error, attributes ...attribute.KeyValue) {
+	if s == nil {
+		return
+	}
+
+	s.span.SetAttributes(attributes...)
+	if err != nil {
+		var errorType = errorKey.String(sentinelName(err))
+		s.span.SetAttributes(errorType)
+		s.span.RecordError(err, trace.WithAttributes(errorType))
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+
+	s.span.End()
+}
+
+// sentinels are the errors spans report as error.type, the most specific first.
+var sentinels = []struct {
+	err  error
+	name string
+}{
+	{ErrVersionConflict, "ErrVersionConflict"},
+	{ErrValidation, "ErrValidation"},
+	{ErrHook, "ErrHook"},
+	{ErrNoTenant, "ErrNoTenant"},
+	{ErrInvalidTenant, "ErrInvalidTenant"},
+	{ErrScope, "ErrScope"},
+	{ErrNoSoftDelete, "ErrNoSoftDelete"},
+	{ErrInvalidPageToken, "ErrInvalidPageToken"},
+	{ErrCache, "ErrCache"},
+	{ErrAudit, "ErrAudit"},
+	{ErrSchema, "ErrSchema"},
+	{ErrNotFound, "ErrNotFound"},
+	{ErrDuplicateKey, "ErrDuplicateKey"},
+	{ErrFindOneAndUpdate, "ErrFindOneAndUpdate"},
+	{ErrFindOneAndReplace, "ErrFindOneAndReplace"},
+	{ErrFindOneAndDelete, "ErrFindOneAndDelete"},
+	{ErrFindOne, "ErrFindOne"},
+	{ErrFind, "ErrFind"},
+	{ErrFindStream, "ErrFindStream"},
+	{ErrIterate, "ErrIterate"},
+	{ErrInsertOne, "ErrInsertOne"},
+	{ErrInsertMany, "ErrInsertMany"},
+	{ErrInsertStream, "ErrInsertStream"},
+	{ErrBulkWrite, "ErrBulkWrite"},
+	{ErrUpdateOne, "ErrUpdateOne"},
+	{ErrUpdateByID, "ErrUpdateByID"},
+	{ErrUpdateMany, "ErrUpdateMany"},
+	{ErrDeleteOne, "ErrDeleteOne"},
+	{ErrDeleteMany, "ErrDeleteMany"},
+	{ErrCount, "ErrCount"},
+	{ErrFindPage, "ErrFindPage"},
+	{ErrFindPaged, "ErrFindPaged"},
+	{ErrAggregate, "ErrAggregate"},
+	{ErrTransaction, "ErrTransaction"},
+	{ErrFindWithDeleted, "ErrFindWithDeleted"},
+	{ErrRestore, "ErrRestore"},
+	{ErrPurgeDeleted, "ErrPurgeDeleted"},
+	{ErrSaveVersioned, "ErrSaveVersioned"},
+	{ErrWatch, "ErrWatch"},
+	{ErrEnsureIndexes, "ErrEnsureIndexes"},
+}
+
+// sentinelName returns the name of the most specific sentinel the error wraps, or its type.
+func sentinelName(err error) string {
+	for _, s := range sentinels {
+		if errors.Is(err, s.err) {
+			return s.name
+		}
+	}
+	return fmt.Sprintf("%T", err)
+}
+
+// filterShape returns the filter as extended JSON with every value replaced by "?", keeping field names and
+// operators, e.g. {"age": {"$gt": "?"}}.
+func filterShape(filter any) string {
+	raw, err := bson.Marshal(filter)
+	if err != nil {
+		return "?"
+	}
+
+	shape, err := bson.MarshalExtJSON(documentShape(raw), false, false)
+	if err != nil {
+		return "?"
+	}
+
+	return string(shape)
+}
+
+func documentShape(document bson.Raw) bson.D {
+	elements, _ := document.Elements()
+
+	var shape = make(bson.D, 0, len(elements))
+	for _, e := range elements {
+		shape = append(shape, bson.E{Key: e.Key(), Value: valueShape(e.Key(), e.Value())})
+	}
+	return shape
+}
+
+func valueShape(key string, value bson.RawValue) any {
+	if document, ok := value.DocumentOK(); ok {
+		return documentShape(document)
+	}
+
+	// the clauses of logical operators are filters themselves.
+	if array, ok := value.ArrayOK(); ok && (key == "$and" || key == "$or" || key == "$nor") {
+		values, _ := array.Values()
+
+		var shape = make(bson.A, 0, len(values))
+		for _, v := range values {
+			shape = append(shape, valueShape("", v))
+		}
+		return shape
+	}
+
+	return "?"
+}
+
+// single returns the number of documents returned or written by a single document operation.
+func single(err error) int {
+	if err != nil {
+		return 0
+	}
+	return 1
+}
+
+// insertedCount returns the number of documents an InsertMany inserted, given the number of IDs it returned.
+func insertedCount(ids int, err error) int {
+	var bulkErr *BulkError
+	if errors.As(err, &bulkErr) {
+		return ids - len(bulkErr.Failed())
+	}
+	return ids
+}
+
+func updateAttributes[I any](result *UpdateResult[I]) []attribute.KeyValue {
+	if result == nil {
+		return nil
+	}
+	return []attribute.KeyValue{
+		matchedKey.Int64(result.MatchedCount),
+		modifiedKey.Int64(result.ModifiedCount),
+		upsertedKey.Int64(result.UpsertedCount),
+	}
+}
+
+func deleteAttributes(result *mongo.DeleteResult) []attribute.KeyValue {
+	if result == nil {
+		return nil
+	}
+	return []attribute.KeyValue{deletedKey.Int64(result.DeletedCount)}
+}
+
+func bulkWriteAttributes[I any](result *BulkWriteResult[I]) []attribute.KeyValue {
+	if result == nil {
+		return nil
+	}
+	return []attribute.KeyValue{
+		insertedKey.Int64(result.InsertedCount),
+		matchedKey.Int64(result.MatchedCount),
+		modifiedKey.Int64(result.ModifiedCount),
+		upsertedKey.Int64(result.UpsertedCount),
+		deletedKey.Int64(result.DeletedCount),
+	}
+}
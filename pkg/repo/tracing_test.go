@@ -0,0 +1,260 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type TracedModel struct {
+	ID    primitive.ObjectID `bson:"_id"`
+	Name  string             `bson:"name"`
+	Owner string             `bson:"owner"`
+}
+
+func (t *TracedModel) GetDatabaseName() string {
+	return "traced_model_db"
+}
+
+func (t *TracedModel) GetCollectionName() string {
+	return "traced_model_col"
+}
+
+func spanAttribute(span tracetest.SpanStub, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestFilterShape(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter any
+		want   string
+	}{
+		{
+			name:   "equality",
+			filter: bson.M{"name": "alice"},
+			want:   `{"name":"?"}`,
+		},
+		{
+			name:   "operators",
+			filter: bson.D{{Key: "age", Value: bson.D{{Key: "$gt", Value: 18}, {Key: "$lt", Value: 65}}}},
+			want:   `{"age":{"$gt":"?","$lt":"?"}}`,
+		},
+		{
+			name:   "arrays",
+			filter: bson.D{{Key: "tags", Value: bson.D{{Key: "$in", Value: bson.A{"a", "b"}}}}},
+			want:   `{"tags":{"$in":"?"}}`,
+		},
+		{
+			name: "logical operators",
+			filter: bson.D{{Key: "$or", Value: bson.A{
+				bson.D{{Key: "name", Value: "alice"}},
+				bson.D{{Key: "email", Value: bson.D{{Key: "$regex", Value: "@example.com$"}}}},
+			}}},
+			want: `{"$or":[{"name":"?"},{"email":{"$regex":"?"}}]}`,
+		},
+		{
+			name:   "not a document",
+			filter: "name",
+			want:   "?",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filterShape(tt.filter); got != tt.want {
+				t.Errorf("filterShape() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSentinelName(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "operation",
+			err:  fmt.Errorf("%w: %w", ErrFindOne, errors.New("connection refused")),
+			want: "ErrFindOne",
+		},
+		{
+			name: "most specific",
+			err:  fmt.Errorf("%w: %w", ErrFindOne, ErrNoTenant),
+			want: "ErrNoTenant",
+		},
+		{
+			name: "not found",
+			err:  NewRepoError("FindOne", Namespace{}, fmt.Errorf("%w: %w", ErrFindOne, mongo.ErrNoDocuments)),
+			want: "ErrNotFound",
+		},
+		{
+			name: "conflict",
+			err:  fmt.Errorf("%w: %w", ErrSaveVersioned, &VersionConflictError{}),
+			want: "ErrVersionConflict",
+		},
+		{
+			name: "not a sentinel",
+			err:  context.Canceled,
+			want: "*errors.errorString",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sentinelName(tt.err); got != tt.want {
+				t.Errorf("sentinelName() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepository_startSpan(t *testing.T) {
+	var exporter = tracetest.NewInMemoryExporter()
+	var provider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	var repository = NewRepository[*TracedModel, primitive.ObjectID](nil,
+		WithTracerProvider(provider),
+		WithScope(func(ctx context.Context) (bson.D, error) {
+			return nil, errors.New("no user")
+		}),
+	)
+
+	_, err := repository.FindOne(context.Background(), bson.M{"name": "alice"})
+	if !errors.Is(err, ErrScope) {
+		t.Fatalf("FindOne() error = %v, want %v", err, ErrScope)
+	}
+
+	var spans = exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+
+	var span = spans[0]
+	if span.Name != "repo.FindOne traced_model_db.traced_model_col" {
+		t.Errorf("span name = %s", span.Name)
+	}
+	if span.Status.Code != codes.Error {
+		t.Errorf("span status = %v, want %v", span.Status.Code, codes.Error)
+	}
+
+	for key, want := range map[attribute.Key]string{
+		"db.system":         "mongodb",
+		"db.name":           "traced_model_db",
+		"db.collection":     "traced_model_col",
+		"db.operation":      "FindOne",
+		"db.mongodb.filter": `{"name":"?"}`,
+		"error.type":        "ErrScope",
+	} {
+		if got, _ := spanAttribute(span, key); got.AsString() != want {
+			t.Errorf("attribute %s = %q, want %q", key, got.AsString(), want)
+		}
+	}
+
+	if len(span.Events) != 1 || span.Events[0].Name != "exception" {
+		t.Errorf("span events = %v, want the recorded error", span.Events)
+	}
+}
+
+func TestRepository_Tracing(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var exporter = tracetest.NewInMemoryExporter()
+	var provider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	var repository = NewRepository[*TracedModel, primitive.ObjectID](mongoClient, WithTracerProvider(provider))
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		err := mongoClient.Database("traced_model_db").Collection("traced_model_col").Drop(context.Background())
+		if err != nil {
+			t.Errorf("error dropping collection: %v", err)
+		}
+	}()
+
+	_, err = repository.InsertMany(ctx, []*TracedModel{
+		{ID: primitive.NewObjectID(), Name: "apple", Owner: "alice"},
+		{ID: primitive.NewObjectID(), Name: "pear", Owner: "alice"},
+		{ID: primitive.NewObjectID(), Name: "plum", Owner: "bob"},
+	})
+	if err != nil {
+		t.Errorf("InsertMany() error = %v", err)
+		return
+	}
+
+	_, err = repository.Find(ctx, bson.M{"owner": "alice"})
+	if err != nil {
+		t.Errorf("Find() error = %v", err)
+		return
+	}
+
+	_, err = repository.UpdateMany(ctx, bson.M{"owner": "bob"}, bson.M{"$set": bson.M{"owner": "carol"}})
+	if err != nil {
+		t.Errorf("UpdateMany() error = %v", err)
+		return
+	}
+
+	_, err = repository.FindOne(ctx, bson.M{"owner": "dave"})
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("FindOne() error = %v, want %v", err, mongo.ErrNoDocuments)
+		return
+	}
+
+	var spans = exporter.GetSpans()
+	if len(spans) != 4 {
+		t.Errorf("got %d spans, want 4", len(spans))
+		return
+	}
+
+	tests := []struct {
+		name  string
+		key   attribute.Key
+		want  int64
+		error string
+	}{
+		{name: "repo.InsertMany traced_model_db.traced_model_col", key: insertedKey, want: 3},
+		{name: "repo.Find traced_model_db.traced_model_col", key: returnedKey, want: 2},
+		{name: "repo.UpdateMany traced_model_db.traced_model_col", key: modifiedKey, want: 1},
+		{name: "repo.FindOne traced_model_db.traced_model_col", key: returnedKey, want: 0, error: "ErrNotFound"},
+	}
+	for i, tt := range tests {
+		if spans[i].Name != tt.name {
+			t.Errorf("span %d name = %s, want %s", i, spans[i].Name, tt.name)
+			continue
+		}
+		if got, _ := spanAttribute(spans[i], tt.key); got.AsInt64() != tt.want {
+			t.Errorf("%s %s = %d, want %d", tt.name, tt.key, got.AsInt64(), tt.want)
+		}
+		if got, _ := spanAttribute(spans[i], errorKey); got.AsString() != tt.error {
+			t.Errorf("%s error.type = %q, want %q", tt.name, got.AsString(), tt.error)
+		}
+	}
+}
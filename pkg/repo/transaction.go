@@ -0,0 +1,220 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	driversession "go.mongodb.org/mongo-driver/x/mongo/driver/session"
+)
+
+const (
+	transientTransactionError      = "TransientTransactionError"
+	unknownTransactionCommitResult = "UnknownTransactionCommitResult"
+)
+
+// TransactionOptions configures WithTransaction.
+type TransactionOptions struct {
+	// MaxRetries is the number of times the transaction, or its commit, is retried after a transient error.
+	// Defaults to 5; a negative value disables retries.
+	MaxRetries int
+	// Backoff returns how long to wait before the given retry attempt, starting at 1.
+	// Defaults to an exponential backoff starting at 10ms, capped at 1s.
+	Backoff func(attempt int) time.Duration
+	// Session configures the session the transaction runs in.
+	Session *options.SessionOptions
+	// Transaction configures the transaction, e.g. its read and write concerns.
+	Transaction *options.TransactionOptions
+}
+
+// DefaultBackoff is the backoff used by WithTransaction when none is configured.
+func DefaultBackoff(attempt int) time.Duration {
+	var delay = 10 * time.Millisecond << (attempt - 1)
+	if delay <= 0 || delay > time.Second {
+		return time.Second
+	}
+	return delay
+}
+
+// WithTransaction runs fn in a transaction, and commits it if fn returns nil.
+//
+// Every Repository method called with the context passed to fn joins the transaction, whatever the repository,
+// so writes to several collections are applied atomically. The transaction is retried when it fails with
+// a TransientTransactionError label, and its commit when it fails with an UnknownTransactionCommitResult label,
+// so fn must be safe to run more than once.
+// If ctx already carries a session in a transaction, e.g. when WithTransaction is nested, fn joins the transaction
+// instead of starting a new one. A session without a transaction runs the transaction, and its session options are
+// not applied.
+//
+// example:
+//
+//	err := repo.WithTransaction(ctx, client, func(txCtx context.Context) error {
+//		if _, err := ordersRepo.InsertOne(txCtx, order); err != nil {
+//			return err
+//		}
+//		_, err := inventoryRepo.UpdateByID(txCtx, order.ItemID, bson.M{"$inc": bson.M{"stock": -1}})
+//		return err
+//	})
+func WithTransaction(
+	ctx context.Context,
+	client *mongo.Client,
+	fn func(txCtx context.Context) error,
+	opts ...*TransactionOptions,
+) error {
+	var o = mergeTransactionOptions(opts...)
+
+	if session := mongo.SessionFromContext(ctx); session != nil {
+		if inTransaction(session) {
+			return fn(ctx)
+		}
+
+		// a session without a transaction, e.g. a causally consistent one, runs the transaction itself.
+		return runTransaction(ctx, session, func(ctx context.Context) context.Context {
+			return mongo.NewSessionContext(ctx, session)
+		}, fn, o)
+	}
+
+	session, err := client.StartSession(o.Session)
+	if err != nil {
+		return fmt.Errorf("%w: failed to start session: %w", ErrTransaction, err)
+	}
+	defer session.EndSession(context.WithoutCancel(ctx))
+
+	return runTransaction(ctx, session, func(ctx context.Context) context.Context {
+		return mongo.NewSessionContext(ctx, session)
+	}, fn, o)
+}
+
+// inTransaction reports whether the session has a transaction starting or in progress. Sessions that do not expose
+// their state, which the driver's always do, are assumed to be in one.
+func inTransaction(session mongo.Session) bool {
+	x, ok := session.(interface{ ClientSession() *driversession.Client })
+	if !ok {
+		return true
+	}
+	var client = x.ClientSession()
+	return client != nil && client.TransactionRunning()
+}
+
+// transactionSession is the part of mongo.Session used to run a transaction.
+type transactionSession interface {
+	StartTransaction(...*options.TransactionOptions) error
+	AbortTransaction(context.Context) error
+	CommitTransaction(context.Context) error
+}
+
+func runTransaction(
+	ctx context.Context,
+	session transactionSession,
+	withSession func(context.Context) context.Context,
+	fn func(txCtx context.Context) error,
+	o TransactionOptions,
+) error {
+	var txCtx = withSession(ctx)
+	var attempt int
+
+	for {
+		err := session.StartTransaction(o.Transaction)
+		if err != nil {
+			return fmt.Errorf("%w: failed to start transaction: %w", ErrTransaction, err)
+		}
+
+		err = fn(txCtx)
+		if err != nil {
+			_ = session.AbortTransaction(context.WithoutCancel(txCtx))
+
+			if hasErrorLabel(err, transientTransactionError) && attempt < o.MaxRetries {
+				attempt++
+				if err := sleep(ctx, o.Backoff(attempt)); err != nil {
+					return fmt.Errorf("%w: %w", ErrTransaction, err)
+				}
+				continue
+			}
+
+			return err
+		}
+
+		err = commitTransaction(ctx, txCtx, session, &attempt, o)
+		if err == nil {
+			return nil
+		}
+
+		if hasErrorLabel(err, transientTransactionError) && attempt < o.MaxRetries {
+			attempt++
+			if err := sleep(ctx, o.Backoff(attempt)); err != nil {
+				return fmt.Errorf("%w: %w", ErrTransaction, err)
+			}
+			continue
+		}
+
+		return fmt.Errorf("%w: failed to commit transaction: %w", ErrTransaction, err)
+	}
+}
+
+func commitTransaction(
+	ctx context.Context,
+	txCtx context.Context,
+	session transactionSession,
+	attempt *int,
+	o TransactionOptions,
+) error {
+	for {
+		err := session.CommitTransaction(txCtx)
+		if err == nil || !hasErrorLabel(err, unknownTransactionCommitResult) || *attempt >= o.MaxRetries {
+			return err
+		}
+
+		*attempt++
+		if err := sleep(ctx, o.Backoff(*attempt)); err != nil {
+			return err
+		}
+	}
+}
+
+func mergeTransactionOptions(opts ...*TransactionOptions) TransactionOptions {
+	var o = TransactionOptions{
+		MaxRetries: 5,
+		Backoff:    DefaultBackoff,
+	}
+
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.MaxRetries != 0 {
+			o.MaxRetries = opt.MaxRetries
+		}
+		if opt.Backoff != nil {
+			o.Backoff = opt.Backoff
+		}
+		if opt.Session != nil {
+			o.Session = opt.Session
+		}
+		if opt.Transaction != nil {
+			o.Transaction = opt.Transaction
+		}
+	}
+
+	return o
+}
+
+// hasErrorLabel reports whether any error in err's tree carries the label.
+func hasErrorLabel(err error, label string) bool {
+	var labeled mongo.LabeledError
+	return errors.As(err, &labeled) && labeled.HasErrorLabel(label)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	var timer = time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
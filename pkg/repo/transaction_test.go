@@ -0,0 +1,194 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type fakeSession struct {
+	commitErrors []error
+	started      int
+	aborted      int
+	committed    int
+}
+
+func (f *fakeSession) StartTransaction(...*options.TransactionOptions) error {
+	f.started++
+	return nil
+}
+
+func (f *fakeSession) AbortTransaction(context.Context) error {
+	f.aborted++
+	return nil
+}
+
+func (f *fakeSession) CommitTransaction(context.Context) error {
+	f.committed++
+	if len(f.commitErrors) > 0 {
+		err := f.commitErrors[0]
+		f.commitErrors = f.commitErrors[1:]
+		return err
+	}
+	return nil
+}
+
+type txCtxKey struct{}
+
+type labeledError string
+
+func (e labeledError) Error() string {
+	return string(e)
+}
+
+func (e labeledError) HasErrorLabel(label string) bool {
+	return string(e) == label
+}
+
+func TestRunTransaction(t *testing.T) {
+	var transient = labeledError(transientTransactionError)
+	var unknownCommit = labeledError(unknownTransactionCommitResult)
+	var errCallback = errors.New("callback error")
+
+	var options = TransactionOptions{
+		MaxRetries: 2,
+		Backoff:    func(int) time.Duration { return time.Millisecond },
+	}
+
+	tests := []struct {
+		name          string
+		session       *fakeSession
+		callbackErrs  []error
+		wantErr       error
+		wantCalls     int
+		wantStarted   int
+		wantAborted   int
+		wantCommitted int
+	}{
+		{
+			name:          "should commit when the callback succeeds",
+			session:       &fakeSession{},
+			wantCalls:     1,
+			wantStarted:   1,
+			wantCommitted: 1,
+		},
+		{
+			name:          "should retry the transaction on a transient error",
+			session:       &fakeSession{},
+			callbackErrs:  []error{fmt.Errorf("%w: %w", ErrUpdateOne, transient)},
+			wantCalls:     2,
+			wantStarted:   2,
+			wantAborted:   1,
+			wantCommitted: 1,
+		},
+		{
+			name:          "should retry the commit on an unknown commit result",
+			session:       &fakeSession{commitErrors: []error{unknownCommit}},
+			wantCalls:     1,
+			wantStarted:   1,
+			wantCommitted: 2,
+		},
+		{
+			name:         "should abort and return callback errors without retrying",
+			session:      &fakeSession{},
+			callbackErrs: []error{errCallback},
+			wantErr:      errCallback,
+			wantCalls:    1,
+			wantStarted:  1,
+			wantAborted:  1,
+		},
+		{
+			name:         "should give up after the maximum number of retries",
+			session:      &fakeSession{},
+			callbackErrs: []error{transient, transient, transient},
+			wantErr:      transient,
+			wantCalls:    3,
+			wantStarted:  3,
+			wantAborted:  3,
+		},
+		{
+			name:          "should wrap commit errors",
+			session:       &fakeSession{commitErrors: []error{errCallback}},
+			wantErr:       ErrTransaction,
+			wantCalls:     1,
+			wantStarted:   1,
+			wantCommitted: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			err := runTransaction(context.Background(), tt.session, func(ctx context.Context) context.Context {
+				return context.WithValue(ctx, txCtxKey{}, true)
+			}, func(txCtx context.Context) error {
+				if txCtx.Value(txCtxKey{}) == nil {
+					t.Errorf("expected the callback to receive the session context")
+				}
+				calls++
+				if len(tt.callbackErrs) > 0 {
+					err := tt.callbackErrs[0]
+					tt.callbackErrs = tt.callbackErrs[1:]
+					return err
+				}
+				return nil
+			}, options)
+
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("runTransaction() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("runTransaction() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls || tt.session.started != tt.wantStarted ||
+				tt.session.aborted != tt.wantAborted || tt.session.committed != tt.wantCommitted {
+				t.Errorf("runTransaction() calls = %d, started = %d, aborted = %d, committed = %d, want %d, %d, %d, %d",
+					calls, tt.session.started, tt.session.aborted, tt.session.committed,
+					tt.wantCalls, tt.wantStarted, tt.wantAborted, tt.wantCommitted)
+			}
+		})
+	}
+}
+
+func TestDefaultBackoff(t *testing.T) {
+	if got := DefaultBackoff(1); got != 10*time.Millisecond {
+		t.Errorf("DefaultBackoff(1) = %v, want %v", got, 10*time.Millisecond)
+	}
+	if got := DefaultBackoff(3); got != 40*time.Millisecond {
+		t.Errorf("DefaultBackoff(3) = %v, want %v", got, 40*time.Millisecond)
+	}
+	if got := DefaultBackoff(100); got != time.Second {
+		t.Errorf("DefaultBackoff(100) = %v, want %v", got, time.Second)
+	}
+}
+
+func TestInTransaction(t *testing.T) {
+	// sessions and transactions are started client side, so no server is needed.
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+
+	session, err := client.StartSession(options.Session().SetCausalConsistency(true))
+	if err != nil {
+		t.Fatalf("StartSession() error = %v", err)
+	}
+	defer session.EndSession(context.Background())
+
+	if inTransaction(session) {
+		t.Errorf("inTransaction() = true for a session without a transaction")
+	}
+
+	err = session.StartTransaction()
+	if err != nil {
+		t.Fatalf("StartTransaction() error = %v", err)
+	}
+	if !inTransaction(session) {
+		t.Errorf("inTransaction() = false for a session with a started transaction")
+	}
+}
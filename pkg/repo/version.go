@@ -0,0 +1,138 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/AISystemsInc/mongo-resource-repo/pkg/repo/internal/meta"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// VersionConflictError is returned by SaveVersioned when the stored document was modified since it was loaded.
+// It matches ErrVersionConflict with errors.Is.
+type VersionConflictError struct {
+	ID       any   // The _id of the document.
+	Expected int64 // The version of the document that was saved.
+	Current  int64 // The version of the stored document.
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("%s: document %v has version %d, expected %d", ErrVersionConflict, e.ID, e.Current, e.Expected)
+}
+
+func (e *VersionConflictError) Unwrap() error {
+	return ErrVersionConflict
+}
+
+// SaveVersioned saves all fields of a model whose stored version is still the version of the model, and increments
+// the version, both in the database and in the model. Versions are opted into by tagging an integer field with
+// `repo:"version"`:
+//
+//	type User struct {
+//		ID      primitive.ObjectID `bson:"_id"`
+//		Version int64              `bson:"version" repo:"version"`
+//	}
+//
+// When the stored document was saved by someone else since the model was loaded, SaveVersioned returns
+// a *VersionConflictError carrying the current stored version, and the caller should reload the document and
+// retry. When there is no such document, the error wraps mongo.ErrNoDocuments.
+//
+// example:
+//
+//	user, err := usersRepo.FindOne(ctx, bson.M{"_id": id})
+//	...
+//	user.Name = "new name"
+//	err = usersRepo.SaveVersioned(ctx, user)
+//	if errors.Is(err, repo.ErrVersionConflict) {
+//		// reload and retry
+//	}
+func (r *Repository[M, I]) SaveVersioned(
+	ctx context.Context,
+	document M,
+	opts ...*options.UpdateOptions,
+) error {
+	ctx, span := r.startSpan(ctx, "SaveVersioned", nil)
+	err := r.saveVersioned(ctx, document, opts...)
+	err = r.classify(ctx, "SaveVersioned", err)
+	span.end(err)
+	return err
+}
+
+func (r *Repository[M, I]) saveVersioned(
+	ctx context.Context,
+	document M,
+	opts ...*options.UpdateOptions,
+) error {
+	var m = meta.For[M]()
+	if m.Err != nil {
+		return fmt.Errorf("%w: %w", ErrSaveVersioned, m.Err)
+	}
+
+	if v, ok := hook[Validator](&document); ok {
+		if err := v.Validate(); err != nil {
+			return fmt.Errorf("%w: %w: %w", ErrSaveVersioned, ErrValidation, err)
+		}
+	}
+
+	m.Touch(&document, r.settings.now())
+
+	// the scoped fields are saved too, so they are stamped to keep the document in scope.
+	err := r.stampScope(ctx, &document)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSaveVersioned, err)
+	}
+
+	id, filter, update, err := m.SaveVersioned(&document)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSaveVersioned, err)
+	}
+
+	err = beforeUpdate[M](ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSaveVersioned, err)
+	}
+
+	query, err := r.scoped(ctx, r.visible(filter))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSaveVersioned, err)
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSaveVersioned, err)
+	}
+
+	result, err := collection.UpdateOne(ctx, query, update, opts...)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSaveVersioned, err)
+	}
+
+	var expected = m.VersionOf(&document)
+
+	if result.MatchedCount == 0 {
+		query, err := r.scoped(ctx, r.visible(bson.D{{Key: "_id", Value: id}}))
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrSaveVersioned, err)
+		}
+
+		raw, err := collection.FindOne(
+			ctx,
+			query,
+			options.FindOne().SetProjection(bson.D{{Key: m.Version.Name, Value: 1}}),
+		).DecodeBytes()
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrSaveVersioned, err)
+		}
+
+		current, _ := raw.Lookup(m.Version.Name).AsInt64OK()
+		return fmt.Errorf("%w: %w", ErrSaveVersioned, &VersionConflictError{
+			ID:       id,
+			Expected: expected,
+			Current:  current,
+		})
+	}
+
+	m.SetVersion(&document, expected+1)
+	return nil
+}
@@ -0,0 +1,108 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type VersionedModel struct {
+	ID      primitive.ObjectID `bson:"_id"`
+	Name    string             `bson:"name"`
+	Note    string             `bson:"note,omitempty"`
+	Version int64              `bson:"version" repo:"version"`
+}
+
+func (v *VersionedModel) GetDatabaseName() string {
+	return "versioned_model_db"
+}
+
+func (v *VersionedModel) GetCollectionName() string {
+	return "versioned_model_col"
+}
+
+func TestRepository_SaveVersioned(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var repository = NewRepository[*VersionedModel, primitive.ObjectID](mongoClient)
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		err := mongoClient.Database("versioned_model_db").Collection("versioned_model_col").Drop(context.Background())
+		if err != nil {
+			t.Errorf("error dropping collection: %v", err)
+		}
+	}()
+
+	var id = primitive.NewObjectID()
+	_, err = repository.InsertOne(ctx, &VersionedModel{ID: id, Name: "apple"})
+	if err != nil {
+		t.Errorf("error inserting model: %v", err)
+		return
+	}
+
+	first, err := repository.FindOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		t.Errorf("FindOne() error = %v", err)
+		return
+	}
+	second, err := repository.FindOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		t.Errorf("FindOne() error = %v", err)
+		return
+	}
+
+	first.Name = "pear"
+	err = repository.SaveVersioned(ctx, first)
+	if err != nil || first.Version != 1 {
+		t.Errorf("SaveVersioned() error = %v, version = %d, want 1", err, first.Version)
+		return
+	}
+
+	second.Name = "plum"
+	err = repository.SaveVersioned(ctx, second)
+
+	var conflict *VersionConflictError
+	if !errors.Is(err, ErrVersionConflict) || !errors.As(err, &conflict) || conflict.Current != 1 {
+		t.Errorf("SaveVersioned() error = %v, want a conflict with current version 1", err)
+	}
+
+	first.Note = "bruised"
+	err = repository.SaveVersioned(ctx, first)
+	if err != nil {
+		t.Errorf("SaveVersioned() error = %v", err)
+		return
+	}
+
+	// clearing an omitempty field unsets it.
+	first.Note = ""
+	err = repository.SaveVersioned(ctx, first)
+	if err != nil {
+		t.Errorf("SaveVersioned() error = %v", err)
+		return
+	}
+
+	stored, err := repository.FindOne(ctx, bson.M{"_id": id})
+	if err != nil || stored.Note != "" || stored.Version != 3 {
+		t.Errorf("FindOne() = %+v, %v, want no note at version 3", stored, err)
+	}
+}
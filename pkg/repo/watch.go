@@ -0,0 +1,312 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ChangeEvent is a change to a document of the repository's collection.
+type ChangeEvent[M Model, I any] struct {
+	OperationType     string              // e.g. "insert", "update", "replace", "delete" or "invalidate".
+	DocumentKey       I                   // The _id of the changed document.
+	FullDocument      M                   // The document for inserts and replaces, and for updates with options.UpdateLookup.
+	UpdateDescription *UpdateDescription  // The changed fields, for updates.
+	ClusterTime       primitive.Timestamp // When the change happened.
+	ResumeToken       bson.Raw            // The token to resume the stream after this event.
+}
+
+// UpdateDescription describes the fields changed by an update.
+type UpdateDescription struct {
+	UpdatedFields bson.Raw `bson:"updatedFields"`
+	RemovedFields []string `bson:"removedFields"`
+}
+
+// ResumeTokenStore persists the resume tokens of change streams, so that consumers resume where they stopped
+// after a restart.
+type ResumeTokenStore interface {
+	// Load returns the token saved under the name, or nil if there is none.
+	Load(ctx context.Context, name string) (bson.Raw, error)
+	// Save saves the token under the name, replacing any previous one.
+	Save(ctx context.Context, name string, token bson.Raw) error
+}
+
+// Watch opens a change stream on the repository's collection, filtered by the pipeline, if any.
+//
+// example:
+//
+//	stream, err := usersRepo.Watch(ctx, mongo.Pipeline{}, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+//	if err != nil {
+//		return err
+//	}
+//	defer stream.Close(ctx)
+//
+//	for event, err := range stream.All(ctx) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(event.OperationType, event.DocumentKey)
+//	}
+func (r *Repository[M, I]) Watch(
+	ctx context.Context,
+	pipeline any,
+	opts ...*options.ChangeStreamOptions,
+) (*ChangeStream[M, I], error) {
+	ctx, span := r.startSpan(ctx, "Watch", nil)
+	stream, err := r.watch(ctx, pipeline, opts...)
+	err = r.classify(ctx, "Watch", err)
+	span.end(err)
+	return stream, err
+}
+
+func (r *Repository[M, I]) watch(
+	ctx context.Context,
+	pipeline any,
+	opts ...*options.ChangeStreamOptions,
+) (*ChangeStream[M, I], error) {
+	if pipeline == nil {
+		pipeline = mongo.Pipeline{}
+	}
+
+	collection, err := r.collection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWatch, err)
+	}
+
+	stream, err := collection.Watch(ctx, pipeline, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWatch, err)
+	}
+
+	return &ChangeStream[M, I]{stream: stream, ctx: context.Background()}, nil
+}
+
+// WatchResumable works like Watch, but starts after the resume token saved in the store under the name, if any.
+// Calling Commit on the returned stream saves its progress under the same name.
+func (r *Repository[M, I]) WatchResumable(
+	ctx context.Context,
+	store ResumeTokenStore,
+	name string,
+	pipeline any,
+	opts ...*options.ChangeStreamOptions,
+) (*ChangeStream[M, I], error) {
+	token, err := store.Load(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to load resume token: %w", ErrWatch, err)
+	}
+
+	if token != nil {
+		opts = append(opts, options.ChangeStream().SetStartAfter(token))
+	}
+
+	stream, err := r.Watch(ctx, pipeline, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	stream.store, stream.name = store, name
+	return stream, nil
+}
+
+// ChangeStream iterates over the change events of a collection, decoding each into a ChangeEvent.
+// Like Cursor, the stream is closed as soon as an error occurs or the context is done.
+type ChangeStream[M Model, I any] struct {
+	stream *mongo.ChangeStream
+	store  ResumeTokenStore
+	name   string
+	ctx    context.Context
+	err    error
+	closed bool
+}
+
+// Next blocks until the next event, and reports whether there is one.
+// Next returns false when an error occurred or the context is done, after which Err reports the error, if any.
+func (s *ChangeStream[M, I]) Next(ctx context.Context) bool {
+	if s.closed {
+		return false
+	}
+
+	if err := ctx.Err(); err != nil {
+		s.err = fmt.Errorf("%w: %w", ErrWatch, err)
+		s.close(ctx)
+		return false
+	}
+
+	if s.stream.Next(ctx) {
+		s.ctx = ctx
+		return true
+	}
+
+	if err := s.stream.Err(); err != nil {
+		s.err = fmt.Errorf("%w: change stream ended with errors: %w", ErrWatch, err)
+	}
+
+	s.close(ctx)
+	return false
+}
+
+// Decode decodes the current event.
+func (s *ChangeStream[M, I]) Decode() (ChangeEvent[M, I], error) {
+	return decodeChangeEvent[M, I](s.ctx, s.stream.Current)
+}
+
+// ResumeToken returns the token to resume the stream after the last event returned by Next.
+func (s *ChangeStream[M, I]) ResumeToken() bson.Raw {
+	return s.stream.ResumeToken()
+}
+
+// Commit saves the resume token of the stream, so that a stream opened by WatchResumable with the same name
+// resumes after the last event returned by Next. Commit after an event has been fully handled to process
+// every event at least once.
+func (s *ChangeStream[M, I]) Commit(ctx context.Context) error {
+	if s.store == nil {
+		return fmt.Errorf("%w: the stream was not opened by WatchResumable", ErrWatch)
+	}
+
+	var token = s.ResumeToken()
+	if token == nil {
+		return nil
+	}
+
+	err := s.store.Save(ctx, s.name, token)
+	if err != nil {
+		return fmt.Errorf("%w: failed to save resume token: %w", ErrWatch, err)
+	}
+
+	return nil
+}
+
+// Err returns the error that stopped the stream, if any.
+func (s *ChangeStream[M, I]) Err() error {
+	return s.err
+}
+
+// Close closes the change stream.
+func (s *ChangeStream[M, I]) Close(ctx context.Context) error {
+	if s.closed {
+		return nil
+	}
+
+	s.closed = true
+
+	err := s.stream.Close(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: failed to close change stream: %w", ErrWatch, err)
+	}
+
+	return nil
+}
+
+func (s *ChangeStream[M, I]) close(ctx context.Context) {
+	err := s.Close(context.WithoutCancel(ctx))
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+// All returns an iterator over the events of the stream, for use with range-over-func.
+// An event that fails to decode is yielded with its error and iteration continues;
+// an error that stops the stream is yielded last. The stream is closed when the loop ends, including on break.
+func (s *ChangeStream[M, I]) All(ctx context.Context) iter.Seq2[ChangeEvent[M, I], error] {
+	return func(yield func(ChangeEvent[M, I], error) bool) {
+		defer s.close(ctx)
+
+		for s.Next(ctx) {
+			if !yield(s.Decode()) {
+				return
+			}
+		}
+
+		if err := s.Err(); err != nil {
+			yield(ChangeEvent[M, I]{}, err)
+		}
+	}
+}
+
+func decodeChangeEvent[M Model, I any](ctx context.Context, raw bson.Raw) (ChangeEvent[M, I], error) {
+	var event struct {
+		ID            bson.Raw `bson:"_id"`
+		OperationType string   `bson:"operationType"`
+		DocumentKey   struct {
+			ID I `bson:"_id"`
+		} `bson:"documentKey"`
+		FullDocument      M                   `bson:"fullDocument"`
+		UpdateDescription *UpdateDescription  `bson:"updateDescription"`
+		ClusterTime       primitive.Timestamp `bson:"clusterTime"`
+	}
+
+	err := bson.Unmarshal(raw, &event)
+	if err != nil {
+		return ChangeEvent[M, I]{}, fmt.Errorf("%w: failed to decode event: %w", ErrWatch, err)
+	}
+
+	var result = ChangeEvent[M, I]{
+		OperationType:     event.OperationType,
+		DocumentKey:       event.DocumentKey.ID,
+		FullDocument:      event.FullDocument,
+		UpdateDescription: event.UpdateDescription,
+		ClusterTime:       event.ClusterTime,
+		ResumeToken:       event.ID,
+	}
+
+	if document, err := raw.LookupErr("fullDocument"); err == nil && document.Type == bsontype.EmbeddedDocument {
+		err := afterFind(ctx, &result.FullDocument)
+		if err != nil {
+			return result, fmt.Errorf("%w: %w", ErrWatch, err)
+		}
+	}
+
+	return result, nil
+}
+
+// MongoResumeTokenStore is a ResumeTokenStore that keeps one document per name in a collection.
+type MongoResumeTokenStore struct {
+	collection *mongo.Collection
+}
+
+var _ ResumeTokenStore = (*MongoResumeTokenStore)(nil)
+
+// NewMongoResumeTokenStore creates a ResumeTokenStore backed by the collection.
+// e.g. store := NewMongoResumeTokenStore(client.Database("app").Collection("resume_tokens"))
+func NewMongoResumeTokenStore(collection *mongo.Collection) *MongoResumeTokenStore {
+	return &MongoResumeTokenStore{collection: collection}
+}
+
+// Load returns the token saved under the name, or nil if there is none.
+func (s *MongoResumeTokenStore) Load(ctx context.Context, name string) (bson.Raw, error) {
+	var document struct {
+		Token bson.Raw `bson:"token"`
+	}
+
+	err := s.collection.FindOne(ctx, bson.D{{Key: "_id", Value: name}}).Decode(&document)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return document.Token, nil
+}
+
+// Save saves the token under the name, replacing any previous one.
+func (s *MongoResumeTokenStore) Save(ctx context.Context, name string, token bson.Raw) error {
+	_, err := s.collection.UpdateOne(
+		ctx,
+		bson.D{{Key: "_id", Value: name}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "token", Value: token},
+			{Key: "updatedAt", Value: time.Now()},
+		}}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
@@ -0,0 +1,150 @@
+package repo
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type WatchModel struct {
+	ID    primitive.ObjectID `bson:"_id"`
+	Name  string             `bson:"name"`
+	Found bool               `bson:"-"`
+}
+
+func (w *WatchModel) GetDatabaseName() string {
+	return "watch_model_db"
+}
+
+func (w *WatchModel) GetCollectionName() string {
+	return "watch_model_col"
+}
+
+func (w *WatchModel) AfterFind(ctx context.Context) error {
+	w.Found = true
+	return nil
+}
+
+func TestDecodeChangeEvent(t *testing.T) {
+	var id = primitive.NewObjectID()
+	var token = bson.Raw(bsonMarshal(t, bson.D{{Key: "_data", Value: "token"}}))
+
+	tests := []struct {
+		name  string
+		event bson.D
+		want  ChangeEvent[*WatchModel, primitive.ObjectID]
+	}{
+		{
+			name: "insert",
+			event: bson.D{
+				{Key: "_id", Value: token},
+				{Key: "operationType", Value: "insert"},
+				{Key: "documentKey", Value: bson.D{{Key: "_id", Value: id}}},
+				{Key: "fullDocument", Value: bson.D{{Key: "_id", Value: id}, {Key: "name", Value: "apple"}}},
+				{Key: "clusterTime", Value: primitive.Timestamp{T: 1, I: 2}},
+			},
+			want: ChangeEvent[*WatchModel, primitive.ObjectID]{
+				OperationType: "insert",
+				DocumentKey:   id,
+				FullDocument:  &WatchModel{ID: id, Name: "apple", Found: true},
+				ClusterTime:   primitive.Timestamp{T: 1, I: 2},
+				ResumeToken:   token,
+			},
+		},
+		{
+			name: "update without full document",
+			event: bson.D{
+				{Key: "_id", Value: token},
+				{Key: "operationType", Value: "update"},
+				{Key: "documentKey", Value: bson.D{{Key: "_id", Value: id}}},
+				{Key: "updateDescription", Value: bson.D{
+					{Key: "updatedFields", Value: bson.D{{Key: "name", Value: "pear"}}},
+					{Key: "removedFields", Value: bson.A{"color"}},
+				}},
+			},
+			want: ChangeEvent[*WatchModel, primitive.ObjectID]{
+				OperationType: "update",
+				DocumentKey:   id,
+				UpdateDescription: &UpdateDescription{
+					UpdatedFields: bsonMarshal(t, bson.D{{Key: "name", Value: "pear"}}),
+					RemovedFields: []string{"color"},
+				},
+				ResumeToken: token,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeChangeEvent[*WatchModel, primitive.ObjectID](context.Background(), bsonMarshal(t, tt.event))
+			if err != nil {
+				t.Fatalf("decodeChangeEvent() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeChangeEvent() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func bsonMarshal(t *testing.T, document any) bson.Raw {
+	t.Helper()
+
+	raw, err := bson.Marshal(document)
+	if err != nil {
+		t.Fatalf("error marshalling document: %v", err)
+	}
+	return raw
+}
+
+func TestMongoResumeTokenStore(t *testing.T) {
+	mongoClient, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:57018"))
+	if err != nil {
+		t.Errorf("error connecting to mongo: %v", err)
+		return
+	}
+
+	defer func() {
+		err := mongoClient.Disconnect(context.Background())
+		if err != nil {
+			t.Errorf("error disconnecting from mongo: %v", err)
+		}
+	}()
+
+	var collection = mongoClient.Database("watch_model_db").Collection("resume_tokens")
+	var store = NewMongoResumeTokenStore(collection)
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	defer func() {
+		err := collection.Drop(context.Background())
+		if err != nil {
+			t.Errorf("error dropping collection: %v", err)
+		}
+	}()
+
+	token, err := store.Load(ctx, "consumer")
+	if err != nil || token != nil {
+		t.Errorf("Load() = %v, %v, want no token", token, err)
+		return
+	}
+
+	var saved = bsonMarshal(t, bson.D{{Key: "_data", Value: "token"}})
+	err = store.Save(ctx, "consumer", saved)
+	if err != nil {
+		t.Errorf("Save() error = %v", err)
+		return
+	}
+
+	token, err = store.Load(ctx, "consumer")
+	if err != nil || !reflect.DeepEqual(token, saved) {
+		t.Errorf("Load() = %v, %v, want %v", token, err, saved)
+	}
+}